@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// addTarget is a module to add a replace for and what to replace it with,
+// an empty Target uses the module's default path.
+type addTarget struct {
+	Module string
+	Target string
+}
+
+// readAddFile reads the targets to add from the file at path
+func readAddFile(path string) ([]addTarget, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open replaces file")
+	}
+	defer f.Close()
+
+	return readAddTargets(f, path, filepath.Dir(path))
+}
+
+// readAddTargets reads lines of "module [path | module@version]" to add,
+// paths with spaces are double quoted.
+// Relative paths are made relative to baseDir and name is used in errors.
+// Every line is checked before anything is returned so a bad file doesn't
+// add only some of its replaces.
+func readAddTargets(r io.Reader, name, baseDir string) ([]addTarget, error) {
+	var targets []addTarget
+	seen := make(map[string]int)
+
+	scanner := bufio.NewScanner(r)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields, err := splitFields(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", name, lineNum, err)
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("%s:%d: expected a module and an optional path, got %q", name, lineNum, line)
+		}
+
+		t := addTarget{Module: fields[0]}
+		if len(fields) == 2 {
+			t.Target = fields[1]
+			if !isRemoteTarget(t.Target) && !filepath.IsAbs(t.Target) && len(baseDir) != 0 {
+				t.Target = filepath.Join(baseDir, t.Target)
+			}
+		}
+
+		if prev, ok := seen[strings.ToLower(t.Module)]; ok {
+			return nil, fmt.Errorf("%s:%d: %s is already listed on line %d", name, lineNum, t.Module, prev)
+		}
+		seen[strings.ToLower(t.Module)] = lineNum
+
+		targets = append(targets, t)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", name)
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("%s has no replaces in it", name)
+	}
+
+	return targets, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var adoptCmd = &cobra.Command{
+	Use:   "adopt [flags]",
+	Short: "Record the local replaces already in go.mod into the gomr file",
+	RunE:  adoptRun,
+}
+
+func adoptRun(cmd *cobra.Command, args []string) error {
+	profiles, err := cmd.Flags().GetStringSlice("profile")
+	if err != nil {
+		return err
+	}
+
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	lock, err := lockModule(modRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	adopted, err := adoptReplaces(modRoot, profiles)
+	if err != nil {
+		return err
+	}
+
+	if adopted == 0 {
+		infof("no local replaces to adopt")
+	}
+	return nil
+}
+
+// adoptReplaces records the local replaces in the go.mod in modRoot that
+// aren't in the gomr file yet into it, in profiles. It returns how many were
+// adopted, the caller must hold the module lock.
+func adoptReplaces(modRoot string, profiles []string) (int, error) {
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return 0, err
+	}
+	replaces, err := readGomrFile(gomrFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, err
+	}
+
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		return 0, err
+	}
+
+	adopted := 0
+	for _, rep := range mod.Replace {
+		if !isLocalPath(rep.New.Path) {
+			continue
+		}
+
+		if len(rep.Old.Version) != 0 {
+			infof("skipping versioned replace: %s %s => %s", rep.Old.Path, rep.Old.Version, rep.New.Path)
+			continue
+		}
+
+		if findReplace(replaces, rep.Old.Path) >= 0 {
+			continue
+		}
+
+		absPath := rep.New.Path
+		if !filepath.IsAbs(absPath) {
+			absPath = filepath.Join(modRoot, absPath)
+		}
+
+		replaces = append(replaces, replace{
+			ModuleName: rep.Old.Path,
+			AbsPath:    absPath,
+			Profiles:   profiles,
+			Added:      time.Now(),
+		})
+		adopted++
+
+		infof("adopted replace: %s => %s", rep.Old.Path, absPath)
+	}
+
+	if adopted == 0 {
+		return 0, nil
+	}
+
+	return adopted, writeGomrFile(gomrFilePath, replaces)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// missingPathFinding is reported for replaces whose path doesn't exist
+const missingPathFinding = "path does not exist"
+
+var auditCmd = &cobra.Command{
+	Use:   "audit [flags]",
+	Short: "Find stored replaces that are old, dirty or broken",
+	Long: `Find stored replaces that are old, dirty or broken
+
+Reports replaces that were added longer ago than --max-age, whose directory
+has uncommitted git changes, or whose directory no longer exists or no longer
+contains the module. Exits with 3 if a path doesn't exist and 2 if anything
+else was found.`,
+	RunE:         auditRun,
+	SilenceUsage: true,
+}
+
+func auditRun(cmd *cobra.Command, args []string) error {
+	maxAgeStr, err := cmd.Flags().GetString("max-age")
+	if err != nil {
+		return err
+	}
+
+	maxAge, err := parseAge(maxAgeStr)
+	if err != nil {
+		return err
+	}
+
+	_, replaces, err := loadReplaces(cmd)
+	if err != nil {
+		return err
+	}
+
+	found, missing := 0, false
+	for _, r := range replaces {
+		findings := auditReplace(r, maxAge)
+		if len(findings) == 0 {
+			continue
+		}
+
+		found += len(findings)
+		missing = missing || containsString(findings, missingPathFinding)
+		outputf("%s => %s", r.ModuleName, r.replacement())
+		for _, f := range findings {
+			outputf("  %s", f)
+		}
+	}
+
+	if found == 0 {
+		infof("no problems found")
+		return nil
+	}
+
+	err = fmt.Errorf("audit found %d problem(s)", found)
+	if missing {
+		return withExitCode(exitMissing, err)
+	}
+	return withExitCode(exitDrift, err)
+}
+
+// auditReplace returns a description of everything wrong with r
+func auditReplace(r replace, maxAge time.Duration) []string {
+	var findings []string
+
+	if !r.Added.IsZero() {
+		if age := time.Since(r.Added); age > maxAge {
+			findings = append(findings, fmt.Sprintf("added %s ago (%s)", formatAge(age), r.Added.Local().Format("2006-01-02")))
+		}
+	}
+
+	// The module proxy is responsible for remote targets and wildcards cover
+	// checkouts that come and go
+	if r.isRemote() || r.isWildcard() {
+		return findings
+	}
+
+	if _, err := os.Stat(r.AbsPath); os.IsNotExist(err) {
+		return append(findings, missingPathFinding)
+	} else if err != nil {
+		return append(findings, err.Error())
+	}
+
+	if problem := checkModulePath(r); len(problem) != 0 {
+		findings = append(findings, problem)
+	}
+
+	if isGitRepo(r.AbsPath) {
+		dirty, err := gitDirty(r.AbsPath, r.AddGoMod)
+		if err != nil {
+			findings = append(findings, err.Error())
+		} else if dirty {
+			findings = append(findings, "has uncommitted changes")
+		}
+	}
+
+	return findings
+}
+
+// checkModulePath checks that the directory of r still contains the module,
+// returning a description of the problem if it doesn't.
+func checkModulePath(r replace) string {
+	_, err := os.Stat(filepath.Join(r.AbsPath, "go.mod"))
+	if os.IsNotExist(err) {
+		// Stubs are only present while the replace is installed
+		if r.AddGoMod {
+			return ""
+		}
+		return "path has no go.mod"
+	} else if err != nil {
+		return err.Error()
+	}
+
+	mod, err := readGoMod(r.AbsPath)
+	if err != nil {
+		return err.Error()
+	}
+
+	if mod.Module.Path != r.ModuleName {
+		return fmt.Sprintf("path contains module %s", mod.Module.Path)
+	}
+
+	return ""
+}
+
+// parseAge parses a duration that can also be given in days (30d) or weeks
+// (6w), which time.ParseDuration doesn't support.
+func parseAge(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if !strings.HasSuffix(s, suffix) {
+			continue
+		}
+
+		n, err := strconv.Atoi(strings.TrimSuffix(s, suffix))
+		if err != nil {
+			return 0, fmt.Errorf("invalid age: %s", s)
+		}
+		return time.Duration(n) * unit, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid age: %s", s)
+	}
+
+	return d, nil
+}
+
+// formatAge formats a duration in whole days, or hours if it's less than one
+func formatAge(d time.Duration) string {
+	if d < 24*time.Hour {
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
+}
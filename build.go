@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/spf13/cobra"
+)
+
+var buildCmd = &cobra.Command{
+	Use:   "build [flags] [-- go build flags...]",
+	Short: "Build the module with the stored replaces applied, then restore go.mod",
+	Long: `Build the module with the stored replaces applied, then restore go.mod
+
+Runs go build ./... in the module root with the replaces applied the same way
+exec applies them, so go.mod and go.sum are put back even if the build
+fails. Arguments after -- are passed to go build. With --ephemeral=false the
+replaces are installed like up does and left in place.`,
+	RunE:         buildRun,
+	SilenceUsage: true,
+}
+
+func buildRun(cmd *cobra.Command, args []string) error {
+	ephemeral, err := cmd.Flags().GetBool("ephemeral")
+	if err != nil {
+		return err
+	}
+
+	modRoot, replaces, err := loadReplaces(cmd)
+	if err != nil {
+		return err
+	}
+
+	build := func() error {
+		c := exec.Command(goCommand(), append(append([]string{"build"}, args...), "./...")...)
+		c.Dir = modRoot
+		c.Stdout = os.Stdout
+		c.Stderr = os.Stderr
+		return c.Run()
+	}
+
+	if ephemeral {
+		return withReplaces(modRoot, replaces, build)
+	}
+
+	lock, err := lockModule(modRoot)
+	if err != nil {
+		return err
+	}
+	err = upReplaces(modRoot, replaces, nil, false)
+	lock.unlock()
+	if err != nil {
+		return err
+	}
+
+	return build()
+}
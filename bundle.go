@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// bundleDirname is where bundle copies the replaced modules by default
+const bundleDirname = ".gomr-bundle"
+
+var bundleCmd = &cobra.Command{
+	Use:   "bundle [flags]",
+	Short: "Copy the replaced modules into the module and replace them with the copies",
+	Long: `Copy the replaced modules into the module and replace them with the copies
+
+Every local replace's directory is copied, without its .git directory, into
+` + bundleDirname + ` (or --dir) in the module root, and go.mod gets replace
+lines with relative paths to the copies. The module and the bundle together
+can then be shipped to CI or a teammate to reproduce the build. gomr down
+drops the replace lines again.`,
+	RunE:         bundleRun,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+}
+
+func bundleRun(cmd *cobra.Command, args []string) error {
+	dir, err := cmd.Flags().GetString("dir")
+	if err != nil {
+		return err
+	}
+
+	modRoot, replaces, err := loadReplaces(cmd)
+	if err != nil {
+		return err
+	}
+
+	bundleDir := dir
+	if !filepath.IsAbs(bundleDir) {
+		bundleDir = filepath.Join(modRoot, bundleDir)
+	}
+	rel, err := filepath.Rel(modRoot, bundleDir)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("the bundle directory must be inside the module: %s", dir)
+	}
+
+	lock, err := lockModule(modRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		return err
+	}
+
+	var bundled []replace
+	for _, r := range expandWildcards(mod, mainReplaces(replaces)) {
+		if r.isRemote() {
+			continue
+		}
+		if info, err := os.Stat(r.AbsPath); err != nil || !info.IsDir() {
+			warnf("%s: %s does not exist, skipping it", r.ModuleName, r.AbsPath)
+			continue
+		}
+
+		dest := filepath.Join(bundleDir, filepath.FromSlash(r.ModuleName))
+		if err = bundleModule(r, dest); err != nil {
+			return err
+		}
+
+		relDest, err := filepath.Rel(modRoot, dest)
+		if err != nil {
+			return err
+		}
+		r.AbsPath = "./" + filepath.ToSlash(relDest)
+		bundled = append(bundled, r)
+	}
+
+	if len(bundled) == 0 {
+		infof("no local replaces to bundle")
+		return nil
+	}
+
+	files, err := moduleFiles(modRoot, nil)
+	if err != nil {
+		return err
+	}
+
+	err = recordOperation(modRoot, operationName("bundle", bundled), files, func() error {
+		if err := backupGoSum(modRoot); err != nil {
+			return err
+		}
+		return gomod(modRoot, append([]string{"edit"}, replaceFlags(bundled)...)...)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, r := range bundled {
+		infof("bundled: %s => %s", r.ModuleName, r.AbsPath)
+	}
+	return nil
+}
+
+// bundleModule replaces dest with a copy of the replace's directory, giving
+// the copy a go.mod if the original doesn't have one.
+func bundleModule(r replace, dest string) error {
+	if dryRun {
+		infof("would copy: %s to %s", r.AbsPath, dest)
+		return nil
+	}
+
+	if err := os.RemoveAll(dest); err != nil {
+		return errors.Wrapf(err, "failed to remove old copy of %s", r.ModuleName)
+	}
+	if err := copyTree(r.AbsPath, dest); err != nil {
+		return errors.Wrapf(err, "failed to copy %s", r.AbsPath)
+	}
+
+	if _, err := os.Stat(filepath.Join(dest, "go.mod")); os.IsNotExist(err) {
+		if err = gomod(dest, "init", r.ModuleName); err != nil {
+			return errors.Wrapf(err, "failed to go mod init in dir: %s", dest)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check [flags]",
+	Short: "Fail if go.mod or go.sum contain replaces tracked by gomr",
+	Long: `Fail if go.mod or go.sum contain replaces tracked by gomr
+
+Intended to be run in CI to stop local overrides from being merged. go.mod
+must not contain any replace tracked in the gomr file, and go.sum must have
+checksums for the required version of every tracked module (they go missing
+when go.sum is regenerated while a replace is active). Since the gomr file is
+often not committed, --local also fails on any replace pointing at a local
+directory. Exits with 2 if anything was found.`,
+	RunE:         checkRun,
+	SilenceUsage: true,
+}
+
+func checkRun(cmd *cobra.Command, args []string) error {
+	local, err := cmd.Flags().GetBool("local")
+	if err != nil {
+		return err
+	}
+
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return err
+	}
+
+	replaces, err := readGomrFile(gomrFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		return err
+	}
+
+	problems, err := checkModule(modRoot, mod, replaces, local)
+	if err != nil {
+		return err
+	}
+
+	if len(problems) == 0 {
+		infof("no gomr replaces found")
+		return nil
+	}
+
+	outputf("%s:", filepath.Join(modRoot, "go.mod"))
+	for _, p := range problems {
+		outputf("  %s", p)
+	}
+
+	return withExitCode(exitDrift, fmt.Errorf("check failed with %d problem(s)", len(problems)))
+}
+
+// checkModule returns a description of every tracked replace that has leaked
+// into the module's go.mod or go.sum.
+func checkModule(modRoot string, mod goModFile, replaces []replace, local bool) ([]string, error) {
+	var problems []string
+
+	reported := make(map[string]bool)
+	for _, r := range appliedReplaces(mod, replaces) {
+		rep, _ := mod.replacedModule(r.ModuleName)
+		problems = append(problems, fmt.Sprintf("go.mod replaces %s => %s", rep.Old.Path, rep.New.Path))
+		reported[rep.Old.Path] = true
+	}
+
+	if local {
+		for _, rep := range mod.Replace {
+			if !isLocalPath(rep.New.Path) || reported[rep.Old.Path] {
+				continue
+			}
+			problems = append(problems, fmt.Sprintf("go.mod replaces %s => local path %s", rep.Old.Path, rep.New.Path))
+		}
+	}
+
+	sums, err := readGoSumModules(filepath.Join(modRoot, "go.sum"))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range replaces {
+		for _, req := range mod.Require {
+			if strings.ToLower(req.Path) != strings.ToLower(r.ModuleName) {
+				continue
+			}
+			if !sums[req.Path+" "+req.Version] {
+				problems = append(problems, fmt.Sprintf("go.sum has no checksum for %s %s", req.Path, req.Version))
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+// readGoSumModules returns a set of "module version" keys for every module
+// that go.sum has a go.mod checksum for. A missing go.sum is an empty set.
+func readGoSumModules(path string) (map[string]bool, error) {
+	sums := make(map[string]bool)
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return sums, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to open go.sum")
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+
+		version := strings.TrimSuffix(fields[1], "/go.mod")
+		sums[fields[0]+" "+version] = true
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read go.sum")
+	}
+
+	return sums, nil
+}
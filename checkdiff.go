@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"golang.org/x/mod/modfile"
+)
+
+var checkDiffCmd = &cobra.Command{
+	Use:   "check-diff [flags] [file]",
+	Short: "Fail if a diff adds replaces tracked by gomr",
+	Long: `Fail if a diff adds replaces tracked by gomr
+
+Reads a unified diff, like git diff or a pull request's patch, from the file
+or stdin when there's none or it's -, and fails if it adds replace lines to
+any go.mod for modules tracked in the current module's gomr file. With
+--local any added replace pointing at a local directory fails too, which
+also works outside of a module or without a gomr file. Each one found is
+printed as file:line and it exits with 2 if anything was found.
+
+  git diff origin/main... | gomr check-diff --local`,
+	RunE:         checkDiffRun,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+}
+
+// diffReplace is a replace line a diff adds to a go.mod
+type diffReplace struct {
+	file        string
+	line        int
+	module      string
+	replacement string
+}
+
+func checkDiffRun(cmd *cobra.Command, args []string) error {
+	local, err := cmd.Flags().GetBool("local")
+	if err != nil {
+		return err
+	}
+
+	var stored []replace
+	if modRoot, err := findModuleRoot(); err == nil {
+		if stored, err = storedReplaces(modRoot); err != nil {
+			return err
+		}
+	} else if !local {
+		return err
+	}
+	if len(stored) == 0 && !local {
+		infof("no replaces tracked by gomr, use --local to check for any local replace")
+		return nil
+	}
+
+	in, name := io.Reader(os.Stdin), "stdin"
+	if len(args) != 0 && args[0] != "-" {
+		f, err := os.Open(args[0])
+		if err != nil {
+			return errors.Wrap(err, "failed to open diff")
+		}
+		defer f.Close()
+		in, name = f, args[0]
+	}
+
+	added, err := readDiffReplaces(in, name)
+	if err != nil {
+		return err
+	}
+
+	problems := 0
+	for _, d := range added {
+		if tracked(stored, d.module) {
+			outputf("%s:%d: adds replace %s => %s, which is tracked by gomr", d.file, d.line, d.module, d.replacement)
+		} else if local && isLocalPath(d.replacement) {
+			outputf("%s:%d: adds replace %s => local path %s", d.file, d.line, d.module, d.replacement)
+		} else {
+			continue
+		}
+		problems++
+	}
+
+	if problems == 0 {
+		infof("no gomr replaces found")
+		return nil
+	}
+	return withExitCode(exitDrift, fmt.Errorf("check-diff found %d replace(s) that shouldn't be committed", problems))
+}
+
+// tracked checks if moduleName has a stored replace, either its own or a
+// wildcard it's under
+func tracked(stored []replace, moduleName string) bool {
+	if findReplace(stored, moduleName) >= 0 {
+		return true
+	}
+
+	for _, r := range stored {
+		if r.isWildcard() && strings.HasPrefix(moduleName, strings.TrimSuffix(r.ModuleName, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// readDiffReplaces finds the replace lines that the unified diff in r adds
+// to go.mod files, with their line numbers in the new file. name is used in
+// errors.
+func readDiffReplaces(r io.Reader, name string) ([]diffReplace, error) {
+	var found []diffReplace
+	file, line := "", 0
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		text := scanner.Text()
+
+		switch {
+		case strings.HasPrefix(text, "+++ "):
+			file = strings.TrimPrefix(text, "+++ ")
+			if i := strings.IndexByte(file, '\t'); i >= 0 {
+				file = file[:i]
+			}
+			file = strings.TrimPrefix(file, "b/")
+			continue
+		case strings.HasPrefix(text, "--- "):
+			continue
+		case strings.HasPrefix(text, "@@ "):
+			start, err := hunkStart(text)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to read %s", name)
+			}
+			line = start
+			continue
+		}
+
+		if path.Base(file) != "go.mod" {
+			continue
+		}
+		// Blank context lines lose their leading space when trailing
+		// whitespace is stripped from a patch
+		if len(text) == 0 {
+			line++
+			continue
+		}
+
+		switch text[0] {
+		case '+':
+			if module, replacement, ok := parseReplaceLine(text[1:]); ok {
+				found = append(found, diffReplace{file: file, line: line, module: module, replacement: replacement})
+			}
+			line++
+		case ' ':
+			line++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", name)
+	}
+
+	return found, nil
+}
+
+// hunkStart returns the first line in the new file of the hunk with the
+// header "@@ -a,b +c,d @@"
+func hunkStart(header string) (int, error) {
+	fields := strings.Fields(header)
+	if len(fields) < 3 || !strings.HasPrefix(fields[2], "+") {
+		return 0, fmt.Errorf("malformed hunk header: %s", header)
+	}
+
+	start := strings.TrimPrefix(fields[2], "+")
+	if i := strings.IndexByte(start, ','); i >= 0 {
+		start = start[:i]
+	}
+	n, err := strconv.Atoi(start)
+	if err != nil {
+		return 0, fmt.Errorf("malformed hunk header: %s", header)
+	}
+	return n, nil
+}
+
+// parseReplaceLine reads a replace from a line of go.mod, either a single
+// line replace directive or a line inside a replace block. Only replaces
+// have a =>, so a line from a block is recognised without seeing the block.
+// The line is parsed as a replace directive of its own so quoting and
+// comments work the way they do in go.mod.
+func parseReplaceLine(text string) (module, replacement string, ok bool) {
+	if !strings.Contains(text, "=>") {
+		return "", "", false
+	}
+
+	text = strings.TrimSpace(text)
+	if fields := strings.Fields(text); len(fields) != 0 && fields[0] == "replace" {
+		text = strings.TrimSpace(strings.TrimPrefix(text, "replace"))
+	}
+	text = strings.TrimSpace(strings.TrimPrefix(text, "("))
+
+	f, err := modfile.Parse("go.mod", []byte("replace "+text+"\n"), nil)
+	if err != nil || len(f.Replace) != 1 {
+		return "", "", false
+	}
+
+	rep := f.Replace[0]
+	replacement = rep.New.Path
+	if len(rep.New.Version) != 0 {
+		replacement += "@" + rep.New.Version
+	}
+	return rep.Old.Path, replacement, true
+}
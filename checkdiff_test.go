@@ -0,0 +1,127 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHunkStart(t *testing.T) {
+	tests := []struct {
+		header string
+		want   int
+		err    bool
+	}{
+		{header: "@@ -1,3 +4,5 @@", want: 4},
+		{header: "@@ -1 +2 @@", want: 2},
+		{header: "@@ -0,0 +1,12 @@ module example.com/app", want: 1},
+		{header: "@@ -10,2 +10 @@", want: 10},
+		{header: "@@ -1,3", err: true},
+		{header: "@@ -1,3 4,5 @@", err: true},
+		{header: "@@ -1,3 +x,5 @@", err: true},
+	}
+
+	for _, test := range tests {
+		got, err := hunkStart(test.header)
+		if test.err {
+			if err == nil {
+				t.Errorf("hunkStart(%q) = %d, want an error", test.header, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("hunkStart(%q) failed: %v", test.header, err)
+		} else if got != test.want {
+			t.Errorf("hunkStart(%q) = %d, want %d", test.header, got, test.want)
+		}
+	}
+}
+
+func TestReadDiffReplaces(t *testing.T) {
+	tests := []struct {
+		name string
+		diff string
+		want []diffReplace
+	}{
+		{
+			name: "single line replace",
+			diff: `diff --git a/go.mod b/go.mod
+--- a/go.mod
++++ b/go.mod
+@@ -1,3 +1,5 @@
+ module example.com/app
+
+ go 1.13
++
++replace example.com/lib => ../lib
+`,
+			want: []diffReplace{{file: "go.mod", line: 5, module: "example.com/lib", replacement: "../lib"}},
+		},
+		{
+			name: "replace block with quotes, versions and comments",
+			diff: `--- a/tools/go.mod
++++ b/tools/go.mod
+@@ -8,4 +8,7 @@ require example.com/lib v1.0.0
+ replace (
+-	example.com/old => ../old
++	example.com/lib v1.0.0 => "/my src/lib" // local
++	example.com/remote => example.com/fork v1.2.0
+ 	example.com/kept => ../kept
++	// example.com/commented => ../commented
+ )
+`,
+			want: []diffReplace{
+				{file: "tools/go.mod", line: 9, module: "example.com/lib", replacement: "/my src/lib"},
+				{file: "tools/go.mod", line: 10, module: "example.com/remote", replacement: "example.com/fork@v1.2.0"},
+			},
+		},
+		{
+			name: "several files and hunks",
+			diff: `--- a/main.go
++++ b/main.go
+@@ -1 +1,2 @@
+ package main
++// replace example.com/lib => ../lib
+--- a/go.mod
++++ b/go.mod	2024-01-01 00:00:00
+@@ -1,2 +1,3 @@
+ module example.com/app
++replace example.com/a => ../a
+ go 1.13
+@@ -20,3 +21,4 @@
+ require (
+ 	example.com/b v1.0.0
++	example.com/c v1.0.0
+ )
++replace example.com/b => ../b
+`,
+			want: []diffReplace{
+				{file: "go.mod", line: 2, module: "example.com/a", replacement: "../a"},
+				{file: "go.mod", line: 25, module: "example.com/b", replacement: "../b"},
+			},
+		},
+		{
+			name: "removed replaces",
+			diff: `--- a/go.mod
++++ b/go.mod
+@@ -1,4 +1,2 @@
+ module example.com/app
+-
+-replace example.com/lib => ../lib
+ go 1.13
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := readDiffReplaces(strings.NewReader(test.diff), "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
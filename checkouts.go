@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// checkout is the directory a replaced module is checked out in
+type checkout struct {
+	module string
+	dir    string
+}
+
+// checkoutResult is the outcome of running a command in a checkout
+type checkoutResult struct {
+	checkout
+	output []byte
+	err    error
+}
+
+// replacedCheckouts returns the checkouts of the local replaces that exist,
+// with wildcards expanded to the modules go.mod requires. With byRepo set
+// only one checkout per git repository is returned, for commands like git
+// pull that act on the whole repository.
+func replacedCheckouts(modRoot string, replaces []replace, byRepo bool) ([]checkout, error) {
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var checkouts []checkout
+	seen := make(map[string]bool)
+	for _, r := range expandWildcards(mod, replaces) {
+		if r.isRemote() || r.isWildcard() {
+			continue
+		}
+		if info, err := os.Stat(r.AbsPath); err != nil || !info.IsDir() {
+			continue
+		}
+
+		key := r.AbsPath
+		if byRepo {
+			if top, err := gitOutput(r.AbsPath, "rev-parse", "--show-toplevel"); err == nil {
+				key = top
+			}
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		checkouts = append(checkouts, checkout{module: r.ModuleName, dir: r.AbsPath})
+	}
+
+	return checkouts, nil
+}
+
+// runInCheckouts runs the command made by command in every checkout, jobs of
+// them at a time, and returns the results in the same order as checkouts.
+// The output of each command is collected so they don't interleave.
+func runInCheckouts(checkouts []checkout, jobs int, command func(c checkout) *exec.Cmd) []checkoutResult {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	results := make([]checkoutResult, len(checkouts))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs && w < len(checkouts); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				c := command(checkouts[i])
+				c.Dir = checkouts[i].dir
+
+				var out bytes.Buffer
+				c.Stdout = &out
+				c.Stderr = &out
+				debugf("running: %s (in %s)", c.Args, c.Dir)
+				err := c.Run()
+
+				results[i] = checkoutResult{checkout: checkouts[i], output: out.Bytes(), err: err}
+			}
+		}()
+	}
+
+	for i := range checkouts {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	return results
+}
+
+// shellCommand returns a command that runs script with the system shell
+func shellCommand(script string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", script)
+	}
+	return exec.Command("/bin/sh", "-c", script)
+}
+
+// reportCheckoutResults prints whether the command worked in each checkout
+// followed by its output and returns how many failed. With summarize only
+// the last line of the output of commands that worked is shown, unless
+// --verbose is set.
+func reportCheckoutResults(results []checkoutResult, summarize bool) int {
+	failed := 0
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+			outputf("%s (%s): %s", r.module, r.dir, colorize(colorRed, "failed: "+r.err.Error()))
+		} else {
+			outputf("%s (%s): %s", r.module, r.dir, colorize(colorGreen, "ok"))
+		}
+
+		output := strings.TrimSpace(string(r.output))
+		switch {
+		case len(output) == 0:
+		case summarize && r.err == nil && !verbose:
+			outputf("  %s", output[strings.LastIndex(output, "\n")+1:])
+		default:
+			outputf("  %s", strings.Replace(output, "\n", "\n  ", -1))
+		}
+	}
+
+	return failed
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// moduleRepo is the version control repository a module is stored in
+type moduleRepo struct {
+	// VCS is the type of repository, gomr can only clone git
+	VCS string
+	// URL is where the repository can be cloned from
+	URL string
+	// Root is the import path that corresponds to the root of the repository
+	Root string
+	// Subdir is the directory of the module inside of the repository
+	Subdir string
+}
+
+var (
+	metaTagPattern  = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	metaAttrPattern = regexp.MustCompile(`(?is)(name|content)\s*=\s*["']([^"']*)["']`)
+)
+
+// findModuleRepo works out which repository a module comes from. Modules on
+// well known hosts are worked out from their path, otherwise the go tool is
+// asked for the module's origin and finally the go-get=1 meta tags that
+// vanity import paths serve are used.
+func findModuleRepo(moduleName string) (moduleRepo, error) {
+	if repoPath, subdir, err := knownHostRepo(moduleName); err == nil {
+		return moduleRepo{VCS: "git", URL: "https://" + repoPath + ".git", Root: repoPath, Subdir: subdir}, nil
+	}
+
+	if repo, ok := goListOrigin(moduleName); ok {
+		return repo, nil
+	}
+
+	return goGetMeta(moduleName)
+}
+
+// goListOrigin asks the go tool where the latest version of the module came
+// from, this only works when the proxy or VCS reports the origin.
+func goListOrigin(moduleName string) (moduleRepo, bool) {
+	cmd := exec.Command(goCommand(), "list", "-m", "-json", moduleName+"@latest")
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod")
+	b, err := cmd.Output()
+	if err != nil {
+		return moduleRepo{}, false
+	}
+
+	var info struct {
+		Origin struct {
+			VCS    string
+			URL    string
+			Subdir string
+		}
+	}
+	if err = json.Unmarshal(b, &info); err != nil || len(info.Origin.URL) == 0 {
+		return moduleRepo{}, false
+	}
+
+	repo := moduleRepo{VCS: info.Origin.VCS, URL: info.Origin.URL, Subdir: info.Origin.Subdir}
+	repo.Root = stripMajorSuffix(moduleName)
+	if len(repo.Subdir) != 0 {
+		repo.Root = strings.TrimSuffix(moduleName, "/"+repo.Subdir)
+	}
+
+	return repo, true
+}
+
+// goGetMeta fetches https://<module>?go-get=1 and reads the go-import meta
+// tag to find the repository, the same way the go tool does.
+func goGetMeta(moduleName string) (moduleRepo, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get("https://" + moduleName + "?go-get=1")
+	if err != nil {
+		return moduleRepo{}, errors.Wrapf(err, "failed to find repository for %s", moduleName)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return moduleRepo{}, errors.Wrapf(err, "failed to find repository for %s", moduleName)
+	}
+
+	var best moduleRepo
+	for _, tag := range metaTagPattern.FindAllString(string(body), -1) {
+		var name, content string
+		for _, attr := range metaAttrPattern.FindAllStringSubmatch(tag, -1) {
+			switch strings.ToLower(attr[1]) {
+			case "name":
+				name = attr[2]
+			case "content":
+				content = attr[2]
+			}
+		}
+
+		fields := strings.Fields(content)
+		if name != "go-import" || len(fields) != 3 {
+			continue
+		}
+
+		prefix := fields[0]
+		if moduleName != prefix && !strings.HasPrefix(moduleName, prefix+"/") {
+			continue
+		}
+
+		if len(prefix) > len(best.Root) {
+			best = moduleRepo{
+				VCS:    fields[1],
+				URL:    fields[2],
+				Root:   prefix,
+				Subdir: strings.TrimPrefix(strings.TrimPrefix(moduleName, prefix), "/"),
+			}
+		}
+	}
+
+	if len(best.URL) == 0 {
+		return best, fmt.Errorf("could not find the repository for %s", moduleName)
+	}
+
+	if isMajorSuffix(best.Subdir) {
+		best.Subdir = ""
+	}
+
+	return best, nil
+}
+
+// cloneModule clones the repository of a module whose checkout is missing
+// and returns the directory of the module inside of it. When dir is empty the
+// repository is cloned to where the path mappings or GOPATH expect its root.
+func cloneModule(moduleName, dir string) (string, error) {
+	repo, err := findModuleRepo(moduleName)
+	if err != nil {
+		return "", err
+	}
+
+	if repo.VCS != "git" {
+		return "", fmt.Errorf("%s is stored in %s, only git repositories can be cloned", moduleName, repo.VCS)
+	}
+
+	if len(dir) == 0 {
+		if dir, _, err = defaultModulePath(repo.Root); err != nil {
+			return "", err
+		}
+	}
+
+	if dir, err = filepath.Abs(dir); err != nil {
+		return "", err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(dir), 0775); err != nil {
+		return "", errors.Wrap(err, "failed to create clone dir")
+	}
+
+	infof("cloning %s into %s", repo.URL, dir)
+	clone := exec.Command("git", "clone", repo.URL, dir)
+	clone.Stdout = os.Stdout
+	clone.Stderr = os.Stderr
+	if err = clone.Run(); err != nil {
+		os.RemoveAll(dir)
+		return "", errors.Wrapf(err, "failed to clone %s", repo.URL)
+	}
+
+	return filepath.Join(dir, filepath.FromSlash(repo.Subdir)), nil
+}
+
+// stripMajorSuffix removes a /vN suffix from a module path
+func stripMajorSuffix(moduleName string) string {
+	i := strings.LastIndexByte(moduleName, '/')
+	if i >= 0 && isMajorSuffix(moduleName[i+1:]) {
+		return moduleName[:i]
+	}
+	return moduleName
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// ANSI color codes used in the human readable output
+const (
+	colorRed    = "31"
+	colorGreen  = "32"
+	colorYellow = "33"
+	colorDim    = "2"
+)
+
+// noColor is set by the --no-color flag or the no_color setting
+var noColor bool
+
+// loadColorConfig turns off color when the config asks for it and
+// --no-color wasn't given. A broken config is left for the command to
+// report.
+func loadColorConfig(cmd *cobra.Command, args []string) {
+	if cmd.Flags().Changed("no-color") {
+		return
+	}
+
+	cfg, err := loadCurrentConfig()
+	if err != nil {
+		debugf("not reading no_color: %v", err)
+		return
+	}
+	noColor = cfg.NoColor
+}
+
+// colorEnabled checks if output should be colored: not with --no-color or
+// NO_COLOR set (https://no-color.org), or when stdout isn't a terminal.
+func colorEnabled() bool {
+	if noColor || len(os.Getenv("NO_COLOR")) != 0 {
+		return false
+	}
+
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// colorize wraps s in the escape codes for color if color is enabled
+func colorize(color, s string) string {
+	if !colorEnabled() {
+		return s
+	}
+	return "\x1b[" + color + "m" + s + "\x1b[0m"
+}
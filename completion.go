@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+var completionCmd = &cobra.Command{
+	Use:   "completion [bash|zsh|fish|powershell]",
+	Short: "Generate a shell completion script",
+	Long: `Generate a shell completion script
+
+Load it in the current shell with, for example:
+
+  source <(gomr completion bash)
+
+Module paths are completed from the stored replaces and the current module's
+require list by asking gomr itself.`,
+	ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+	Args:                  cobra.ExactValidArgs(1),
+	DisableFlagsInUseLine: true,
+	RunE:                  completionRun,
+}
+
+func completionRun(cmd *cobra.Command, args []string) error {
+	switch args[0] {
+	case "bash":
+		return rootCmd.GenBashCompletion(os.Stdout)
+	case "zsh":
+		return rootCmd.GenZshCompletion(os.Stdout)
+	case "fish":
+		return rootCmd.GenFishCompletion(os.Stdout, true)
+	default:
+		return rootCmd.GenPowerShellCompletionWithDesc(os.Stdout)
+	}
+}
+
+// completeStoredModules completes the module paths of the stored replaces,
+// leaving out the ones already given.
+func completeStoredModules(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	replaces, err := readGomrFile(gomrFilePath)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	var modules []string
+	for _, r := range replaces {
+		if !containsString(args, r.ModuleName) {
+			modules = append(modules, r.ModuleName)
+		}
+	}
+	return modules, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeAddArgs completes the module paths the current module requires
+// for the first argument of add and a directory for the second.
+func completeAddArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 1 {
+		return nil, cobra.ShellCompDirectiveFilterDirs
+	}
+
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	var modules []string
+	for _, req := range mod.Require {
+		if !containsString(args, req.Path) {
+			modules = append(modules, req.Path)
+		}
+	}
+	return modules, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeProfiles completes the profile names used by the stored replaces
+func completeProfiles(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	replaces, err := readGomrFile(gomrFilePath)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	seen := make(map[string]bool)
+	var profiles []string
+	for _, r := range replaces {
+		for _, p := range r.Profiles {
+			if !seen[p] {
+				seen[p] = true
+				profiles = append(profiles, p)
+			}
+		}
+	}
+	sort.Strings(profiles)
+
+	return profiles, cobra.ShellCompDirectiveNoFileComp
+}
+
+// containsString checks if strs contains str
+func containsString(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
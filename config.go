@@ -0,0 +1,266 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// pathsFilename is the user level file that maps module path prefixes to
+	// the directories they're checked out in on this machine.
+	pathsFilename = "paths.toml"
+	// configFilename is the project level config file, kept next to the gomr
+	// file.
+	configFilename = ".gomr.toml"
+	// userConfigFilename is the user level config file, its settings apply
+	// to every project that doesn't set them itself.
+	userConfigFilename = "config.toml"
+)
+
+// config is the structure of the project and user config files
+type config struct {
+	// Profile is used when --profile isn't given
+	Profile string `toml:"profile"`
+	// PullCommand is run by pull instead of git pull --ff-only
+	PullCommand string `toml:"pull_command"`
+	// Tidy runs go mod tidy after add, remove, up and down
+	Tidy bool `toml:"tidy"`
+	// Relative makes add store paths relative to the module when it can
+	Relative bool `toml:"relative"`
+	// Hooks are run before and after up and down
+	Hooks lifecycleHooks `toml:"hooks"`
+	// Roots are extra directories to look for checkouts in
+	Roots []string `toml:"roots"`
+	// NoColor turns off colored output like --no-color
+	NoColor bool `toml:"no_color"`
+	// Editor is run by edit instead of $VISUAL or $EDITOR
+	Editor string `toml:"editor"`
+}
+
+// starterConfig is written by gomr init, it documents every setting. The
+// [hooks] table has to stay last.
+const starterConfig = `# gomr project configuration
+
+# The profile that up, down, exec, shell and list use when --profile isn't
+# given.
+# profile = "backend"
+
+# The command pull runs in each checkout, with the shell, instead of
+# git pull --ff-only.
+# pull_command = "git pull --rebase"
+
+# Run go mod tidy after add, remove, up and down, --tidy=false skips it.
+# tidy = true
+
+# Store the paths of new replaces relative to the module when they're inside
+# or beside the repository, so the gomr file works in other checkouts.
+# relative = true
+
+# Directories suggest and add --interactive look for checkouts in, before the
+# roots in the user's paths file.
+# roots = ["~/src", "~/work"]
+
+# Don't color the output, like --no-color.
+# no_color = true
+
+# The editor edit opens checkouts with, instead of $VISUAL or $EDITOR.
+# editor = "code"
+
+# Commands run with the shell in the module root before and after up and
+# down. A failing pre hook stops the command, --no-hooks skips them.
+# [hooks]
+# pre_up = "make deps"
+# post_up = "go mod tidy && go generate ./..."
+# pre_down = ""
+# post_down = "go mod tidy"
+`
+
+// loadConfig reads the config for the module in modRoot: the user config
+// with the project config on top, a setting in the project config wins. A
+// missing file has no settings.
+func loadConfig(modRoot string) (config, error) {
+	var cfg config
+
+	userPath, err := userConfigPath()
+	if err != nil {
+		return cfg, err
+	}
+	if err = decodeConfigFile(userPath, &cfg); err != nil {
+		return cfg, err
+	}
+
+	projectPath, err := projectConfigPath(modRoot)
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, decodeConfigFile(projectPath, &cfg)
+}
+
+// loadCurrentConfig is loadConfig for the module in the current directory,
+// or only the user config outside of a module.
+func loadCurrentConfig() (config, error) {
+	if modRoot, err := findModuleRoot(); err == nil {
+		return loadConfig(modRoot)
+	}
+
+	var cfg config
+	userPath, err := userConfigPath()
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, decodeConfigFile(userPath, &cfg)
+}
+
+// decodeConfigFile decodes the config file at path into cfg, only the
+// settings in the file are changed so files can be layered. A missing file
+// changes nothing.
+func decodeConfigFile(path string, cfg *config) error {
+	md, err := toml.DecodeFile(path, cfg)
+	if err != nil {
+		if os.IsNotExist(errors.Cause(err)) {
+			return nil
+		}
+		return errors.Wrapf(err, "failed to read %s", path)
+	}
+
+	if undecoded := md.Undecoded(); len(undecoded) != 0 {
+		return errors.Errorf("unknown key %q in %s", undecoded[0].String(), path)
+	}
+
+	return nil
+}
+
+// projectConfigPath returns the path of the config file for the module in
+// modRoot
+func projectConfigPath(modRoot string) (string, error) {
+	dir, err := storeDir(modRoot)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, configFilename), nil
+}
+
+// userConfigPath returns the path of the user's config file
+func userConfigPath() (string, error) {
+	dir, err := userConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, userConfigFilename), nil
+}
+
+// configBoolFlag returns the value of cmd's bool flag name, or the project's
+// setting for it from setting if the flag wasn't given.
+func configBoolFlag(cmd *cobra.Command, name, modRoot string, setting func(cfg config) bool) (bool, error) {
+	flag := cmd.Flags().Lookup(name)
+	if flag == nil {
+		return false, nil
+	}
+	if flag.Changed {
+		return cmd.Flags().GetBool(name)
+	}
+
+	cfg, err := loadConfig(modRoot)
+	if err != nil {
+		return false, err
+	}
+
+	return setting(cfg), nil
+}
+
+// pathsConfig is the structure of the paths file:
+//
+//	roots = ["~/src"]
+//
+//	[paths]
+//	"github.com/myorg" = "~/work/myorg"
+type pathsConfig struct {
+	// Roots are extra directories that suggest searches for checkouts
+	Roots []string          `toml:"roots"`
+	Paths map[string]string `toml:"paths"`
+}
+
+// userConfigDir returns the directory gomr's user level configuration is in
+func userConfigDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to find user config dir")
+	}
+
+	return filepath.Join(dir, "gomr"), nil
+}
+
+// readPathsConfig reads the user's paths file, a missing file is empty
+func readPathsConfig() (pathsConfig, error) {
+	var config pathsConfig
+
+	dir, err := userConfigDir()
+	if err != nil {
+		return config, err
+	}
+
+	path := filepath.Join(dir, pathsFilename)
+	if _, err = toml.DecodeFile(path, &config); err != nil {
+		if os.IsNotExist(errors.Cause(err)) {
+			return config, nil
+		}
+		return config, errors.Wrapf(err, "failed to read %s", path)
+	}
+
+	return config, nil
+}
+
+// readPathMappings reads the module prefix to directory mappings from the
+// user's paths file, a missing file has no mappings.
+func readPathMappings() (map[string]string, error) {
+	config, err := readPathsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return config.Paths, nil
+}
+
+// mapModulePath finds the directory for moduleName using the longest
+// matching prefix in mappings.
+func mapModulePath(mappings map[string]string, moduleName string) (string, bool) {
+	prefixes := make([]string, 0, len(mappings))
+	for prefix := range mappings {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+
+	for _, prefix := range prefixes {
+		trimmed := strings.TrimSuffix(prefix, "/")
+		if moduleName != trimmed && !strings.HasPrefix(moduleName, trimmed+"/") {
+			continue
+		}
+
+		rest := strings.TrimPrefix(moduleName, trimmed)
+		return filepath.Join(expandHome(mappings[prefix]), filepath.FromSlash(rest)), true
+	}
+
+	return "", false
+}
+
+// expandHome replaces a leading ~ in path with the user's home directory
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") && !strings.HasPrefix(path, `~\`) {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(home, path[1:])
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config <command>",
+	Short: "Get and set the project and user configuration",
+	Long: `Get and set the project and user configuration
+
+Settings are read from the user config file and then the project's
+` + configFilename + `, which wins for the settings it has. Keys in a table
+are written as table.key, like hooks.post_up. List values are given comma
+separated.`,
+}
+
+var configGetCmd = &cobra.Command{
+	Use:          "get [flags] <key>",
+	Short:        "Print the value of a setting",
+	RunE:         configGetRun,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+}
+
+var configSetCmd = &cobra.Command{
+	Use:          "set [flags] <key> <value>",
+	Short:        "Change a setting in the project config, or the user config with --user",
+	RunE:         configSetRun,
+	Args:         cobra.ExactArgs(2),
+	SilenceUsage: true,
+}
+
+func configGetRun(cmd *cobra.Command, args []string) error {
+	user, err := cmd.Flags().GetBool("user")
+	if err != nil {
+		return err
+	}
+
+	var cfg config
+	if user {
+		path, err := userConfigPath()
+		if err != nil {
+			return err
+		}
+		if err = decodeConfigFile(path, &cfg); err != nil {
+			return err
+		}
+	} else if cfg, err = loadCurrentConfig(); err != nil {
+		return err
+	}
+
+	value, err := configValue(&cfg, args[0])
+	if err != nil {
+		return err
+	}
+
+	switch value.Kind() {
+	case reflect.Slice:
+		outputf("%s", strings.Join(value.Interface().([]string), ","))
+	default:
+		outputf("%v", value.Interface())
+	}
+	return nil
+}
+
+func configSetRun(cmd *cobra.Command, args []string) error {
+	user, err := cmd.Flags().GetBool("user")
+	if err != nil {
+		return err
+	}
+
+	var path string
+	if user {
+		path, err = userConfigPath()
+	} else {
+		var modRoot string
+		if modRoot, err = findModuleRoot(); err != nil {
+			return err
+		}
+		path, err = projectConfigPath(modRoot)
+	}
+	if err != nil {
+		return err
+	}
+
+	key, input := args[0], args[1]
+	var cfg config
+	value, err := configValue(&cfg, key)
+	if err != nil {
+		return err
+	}
+
+	var encoded string
+	switch value.Kind() {
+	case reflect.Bool:
+		b, err := strconv.ParseBool(input)
+		if err != nil {
+			return fmt.Errorf("%s must be true or false: %s", key, input)
+		}
+		encoded = strconv.FormatBool(b)
+	case reflect.Slice:
+		var list []string
+		for _, s := range strings.Split(input, ",") {
+			if s = strings.TrimSpace(s); len(s) != 0 {
+				list = append(list, s)
+			}
+		}
+		encoded = tomlStrings(list)
+	default:
+		encoded = tomlString(input)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "failed to read %s", path)
+	}
+
+	table, name := "", key
+	if i := strings.LastIndex(key, "."); i >= 0 {
+		table, name = key[:i], key[i+1:]
+	}
+	b = setConfigLine(b, table, name, encoded)
+
+	// Make sure the edit produced a config gomr can read before writing it
+	tmp, err := ioutil.TempFile("", "gomr-config")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(b)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = decodeConfigFile(tmp.Name(), &cfg)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to set %s in %s", key, path)
+	}
+
+	if user && !dryRun {
+		if err = os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+			return errors.Wrap(err, "failed to create user config dir")
+		}
+	}
+	if err = writeFile(path, b, 0664); err != nil {
+		return errors.Wrapf(err, "failed to write %s", path)
+	}
+
+	infof("set %s = %s in %s", key, encoded, path)
+	return nil
+}
+
+// configValue finds the field of cfg for a setting's key, table keys are
+// separated with dots
+func configValue(cfg *config, key string) (reflect.Value, error) {
+	v := reflect.ValueOf(cfg).Elem()
+	for _, part := range strings.Split(key, ".") {
+		if v.Kind() != reflect.Struct {
+			return v, fmt.Errorf("unknown setting %q, the settings are: %s", key, strings.Join(configKeys(reflect.TypeOf(config{}), ""), ", "))
+		}
+
+		found := false
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).Tag.Get("toml") == part {
+				v, found = v.Field(i), true
+				break
+			}
+		}
+		if !found {
+			return v, fmt.Errorf("unknown setting %q, the settings are: %s", key, strings.Join(configKeys(reflect.TypeOf(config{}), ""), ", "))
+		}
+	}
+
+	if v.Kind() == reflect.Struct {
+		return v, fmt.Errorf("%s is a table, set one of its keys: %s", key, strings.Join(configKeys(v.Type(), key+"."), ", "))
+	}
+	return v, nil
+}
+
+// configKeys lists the keys of the settings in t, which is config or one of
+// its tables, with prefix in front of them
+func configKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := prefix + f.Tag.Get("toml")
+		if f.Type.Kind() == reflect.Struct {
+			keys = append(keys, configKeys(f.Type, name+".")...)
+		} else {
+			keys = append(keys, name)
+		}
+	}
+	return keys
+}
+
+// setConfigLine sets key to the encoded value in the table of the TOML in b,
+// an empty table is the top level. The line for the key is replaced if it's
+// there so the rest of the file, comments included, is kept as it is.
+func setConfigLine(b []byte, table, key, value string) []byte {
+	line := key + " = " + value
+	lines := strings.Split(strings.TrimRight(string(b), "\n"), "\n")
+	if len(b) == 0 {
+		lines = nil
+	}
+
+	// Find the lines of the table, the top level ends at the first header
+	start, end := 0, len(lines)
+	inTable := len(table) == 0
+	if !inTable {
+		start = -1
+	}
+	for i, l := range lines {
+		trimmed := strings.TrimSpace(l)
+		if !strings.HasPrefix(trimmed, "[") {
+			continue
+		}
+		if inTable {
+			end = i
+			break
+		}
+		if trimmed == "["+table+"]" {
+			start, inTable = i+1, true
+		}
+	}
+
+	if start < 0 {
+		if len(lines) != 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "["+table+"]", line)
+		return []byte(strings.Join(lines, "\n") + "\n")
+	}
+
+	for i := start; i < end; i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(trimmed, key) && strings.HasPrefix(strings.TrimSpace(trimmed[len(key):]), "=") {
+			lines[i] = line
+			return []byte(strings.Join(lines, "\n") + "\n")
+		}
+	}
+
+	// Add it after the last setting in the table, or if it has none before
+	// the comments leading up to the next table
+	at := end
+	if last := lastConfigSetting(lines[start:end]); last >= 0 {
+		at = start + last + 1
+	} else if end < len(lines) {
+		for at > start && len(strings.TrimSpace(lines[at-1])) != 0 {
+			at--
+		}
+	}
+
+	lines = append(lines[:at], append([]string{line}, lines[at:]...)...)
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// lastConfigSetting returns the index of the last line that sets a key, or
+// -1 if none do
+func lastConfigSetting(lines []string) int {
+	for i := len(lines) - 1; i >= 0; i-- {
+		trimmed := strings.TrimSpace(lines[i])
+		if len(trimmed) != 0 && !strings.HasPrefix(trimmed, "#") {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 3
+
+var diffCmd = &cobra.Command{
+	Use:          "diff up|down [module]...",
+	Short:        "Show the changes up or down would make to go.mod without making them",
+	RunE:         diffRun,
+	Args:         cobra.MinimumNArgs(1),
+	ValidArgs:    []string{"up", "down"},
+	SilenceUsage: true,
+}
+
+func diffRun(cmd *cobra.Command, args []string) error {
+	direction := args[0]
+	if direction != "up" && direction != "down" {
+		return errors.Errorf("expected up or down, got: %s", direction)
+	}
+
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	profile, err := profileFlag(cmd, modRoot)
+	if err != nil {
+		return err
+	}
+
+	replaces, err := readReplaces(modRoot, profile)
+	if err != nil {
+		return err
+	}
+	if replaces, err = selectReplaces(replaces, args[1:]); err != nil {
+		return err
+	}
+
+	workspace, err := cmd.Flags().GetBool("workspace")
+	if err != nil {
+		return err
+	}
+
+	var diffs []string
+	if workspace {
+		goWork, err := workspaceGoWork(modRoot)
+		if err != nil {
+			return err
+		}
+		diffs, err = goWorkDiffs(modRoot, goWork, replaces, direction == "up")
+		if err != nil {
+			return err
+		}
+	} else if diffs, err = goModDiffs(modRoot, replaces, direction == "up"); err != nil {
+		return err
+	}
+
+	if len(diffs) == 0 {
+		infof("no changes")
+		return nil
+	}
+	for _, d := range diffs {
+		outputf("%s", strings.TrimSuffix(d, "\n"))
+	}
+
+	return nil
+}
+
+// goModDiffs returns a unified diff for every go.mod that installing (or
+// removing when up is false) the replaces would change. The edits are made
+// to copies so nothing in the module is touched.
+func goModDiffs(modRoot string, replaces []replace, up bool) ([]string, error) {
+	dirs, byDir, err := targetModules(modRoot, replaces)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []string
+	addDiff := func(dir string, flags func(mod goModFile) []string) error {
+		before, after, err := previewGoModEdit(dir, flags)
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(modRoot, filepath.Join(dir, "go.mod"))
+		if err != nil {
+			return err
+		}
+		if d := unifiedDiff(filepath.ToSlash(rel), before, after); len(d) != 0 {
+			diffs = append(diffs, d)
+		}
+		return nil
+	}
+
+	err = addDiff(modRoot, func(mod goModFile) []string {
+		if up {
+			return replaceFlags(expandWildcards(mod, mainReplaces(replaces)))
+		}
+
+		flags := dropReplaceFlags(mainReplaces(expandWildcards(mod, replaces)))
+		for _, r := range replaces {
+			if len(r.Require) != 0 {
+				flags = append(flags, fmt.Sprintf("-require=%s@%s", r.ModuleName, r.Require))
+			}
+		}
+		return flags
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dir := range dirs {
+		targeted := byDir[dir]
+		err = addDiff(dir, func(mod goModFile) []string {
+			if up {
+				return replaceFlags(expandWildcards(mod, targeted))
+			}
+			return dropReplaceFlags(appliedReplaces(mod, targeted))
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return diffs, nil
+}
+
+// goWorkDiffs returns the unified diff of the changes up or down --workspace
+// would make to goWork, made to a copy of it like goModDiffs does.
+func goWorkDiffs(modRoot, goWork string, replaces []replace, up bool) ([]string, error) {
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	before, err := ioutil.ReadFile(goWork)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", goWork)
+	}
+
+	installs := expandWildcards(mod, mainReplaces(replaces))
+	flags := dropReplaceFlags(installs)
+	if up {
+		flags = replaceFlags(installs)
+	}
+
+	after, err := previewEdit("work", goWork, before, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	// A go.work usually sits above the module, so it's named without a
+	// path that climbs out of it
+	path := filepath.Base(goWork)
+	if rel, err := filepath.Rel(modRoot, goWork); err == nil && !strings.HasPrefix(rel, "..") {
+		path = rel
+	}
+	if d := unifiedDiff(filepath.ToSlash(path), before, after); len(d) != 0 {
+		return []string{d}, nil
+	}
+	return nil, nil
+}
+
+// previewGoModEdit runs go mod edit with the flags for the go.mod in dir on
+// a copy of it and returns the contents before and after.
+func previewGoModEdit(dir string, flags func(mod goModFile) []string) ([]byte, []byte, error) {
+	before, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to read go.mod")
+	}
+
+	mod, err := readGoMod(dir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	after, err := previewEdit("mod", filepath.Join(dir, "go.mod"), before, flags(mod))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return before, after, nil
+}
+
+// previewEdit runs go mod edit or go work edit, depending on tool, with
+// editFlags on a copy of the file at path holding before and returns what
+// the copy holds afterwards, regardless of --dry-run.
+func previewEdit(tool, path string, before []byte, editFlags []string) ([]byte, error) {
+	if len(editFlags) == 0 {
+		return before, nil
+	}
+
+	tmpDir, err := ioutil.TempDir("", "gomr-diff")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpFile := filepath.Join(tmpDir, filepath.Base(path))
+	if err = ioutil.WriteFile(tmpFile, before, 0664); err != nil {
+		return nil, err
+	}
+
+	args := append(append([]string{tool, "edit"}, editFlags...), tmpFile)
+	cmd := exec.Command(goCommand(), args...)
+	cmd.Dir = tmpDir
+	debugf("running: go %s (in %s)", strings.Join(args, " "), cmd.Dir)
+	if b, err := cmd.CombinedOutput(); err != nil {
+		return nil, errors.Errorf("go %s edit failed: %s", tool, strings.TrimSpace(string(b)))
+	}
+
+	return ioutil.ReadFile(tmpFile)
+}
+
+// diffLine is a line in a diff, kind is ' ' for unchanged lines and '-' or
+// '+' for removed and added ones
+type diffLine struct {
+	kind byte
+	text string
+}
+
+// unifiedDiff returns a unified diff between a and b for the file at path,
+// or an empty string if they're the same
+func unifiedDiff(path string, a, b []byte) string {
+	if bytes.Equal(a, b) {
+		return ""
+	}
+
+	lines := diffLines(splitLines(a), splitLines(b))
+
+	// aBefore[i] and bBefore[i] count the lines from a and b before lines[i]
+	aBefore := make([]int, len(lines)+1)
+	bBefore := make([]int, len(lines)+1)
+	for i, l := range lines {
+		aBefore[i+1], bBefore[i+1] = aBefore[i], bBefore[i]
+		if l.kind != '+' {
+			aBefore[i+1]++
+		}
+		if l.kind != '-' {
+			bBefore[i+1]++
+		}
+	}
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- a/%s\n+++ b/%s\n", path, path)
+
+	for i := 0; i < len(lines); i++ {
+		if lines[i].kind == ' ' {
+			continue
+		}
+
+		// Changes closer together than twice the context share a hunk
+		last := i
+		for j := i; j < len(lines) && j-last <= 2*diffContext; j++ {
+			if lines[j].kind != ' ' {
+				last = j
+			}
+		}
+
+		start, stop := i-diffContext, last+diffContext+1
+		if start < 0 {
+			start = 0
+		}
+		if stop > len(lines) {
+			stop = len(lines)
+		}
+
+		aStart, aLen := aBefore[start]+1, aBefore[stop]-aBefore[start]
+		bStart, bLen := bBefore[start]+1, bBefore[stop]-bBefore[start]
+		if aLen == 0 {
+			aStart--
+		}
+		if bLen == 0 {
+			bStart--
+		}
+
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", aStart, aLen, bStart, bLen)
+		for _, l := range lines[start:stop] {
+			fmt.Fprintf(&out, "%c%s\n", l.kind, l.text)
+		}
+
+		i = stop - 1
+	}
+
+	return out.String()
+}
+
+// splitLines splits b into lines without their line endings
+func splitLines(b []byte) []string {
+	s := strings.TrimSuffix(string(b), "\n")
+	if len(s) == 0 {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
+
+// diffLines finds the shortest edit from a to b using their longest common
+// subsequence, go.mod files are small enough for the quadratic table
+func diffLines(a, b []string) []diffLine {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, diffLine{kind: ' ', text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, diffLine{kind: '-', text: a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{kind: '+', text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, diffLine{kind: '-', text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, diffLine{kind: '+', text: b[j]})
+	}
+
+	return lines
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want []string
+	}{
+		{name: "empty"},
+		{name: "unchanged", a: []string{"a", "b"}, b: []string{"a", "b"}, want: []string{" a", " b"}},
+		{name: "insert", a: []string{"a", "c"}, b: []string{"a", "b", "c"}, want: []string{" a", "+b", " c"}},
+		{name: "insert into empty", b: []string{"a"}, want: []string{"+a"}},
+		{name: "delete", a: []string{"a", "b", "c"}, b: []string{"a", "c"}, want: []string{" a", "-b", " c"}},
+		{name: "delete everything", a: []string{"a"}, want: []string{"-a"}},
+		{name: "change", a: []string{"a", "b", "c"}, b: []string{"a", "x", "c"}, want: []string{" a", "-b", "+x", " c"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got []string
+			for _, l := range diffLines(test.a, test.b) {
+				got = append(got, string(l.kind)+l.text)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	numbered := func(replacements map[string]string) string {
+		var lines []string
+		for _, l := range strings.Fields("1 2 3 4 5 6 7 8 9 10") {
+			if r, ok := replacements[l]; ok {
+				l = r
+			}
+			lines = append(lines, l)
+		}
+		return strings.Join(lines, "\n") + "\n"
+	}
+
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{name: "unchanged", a: "module example.com/app\n", b: "module example.com/app\n"},
+		{name: "both empty"},
+		{
+			name: "from empty",
+			b:    "module example.com/app\n",
+			want: "@@ -0,0 +1,1 @@\n+module example.com/app\n",
+		},
+		{
+			name: "to empty",
+			a:    "module example.com/app\n",
+			want: "@@ -1,1 +0,0 @@\n-module example.com/app\n",
+		},
+		{
+			name: "insert",
+			a:    "module example.com/app\n\ngo 1.13\n",
+			b:    "module example.com/app\n\ngo 1.13\n\nreplace example.com/lib => ../lib\n",
+			want: "@@ -1,3 +1,5 @@\n module example.com/app\n \n go 1.13\n+\n+replace example.com/lib => ../lib\n",
+		},
+		{
+			name: "delete",
+			a:    numbered(nil),
+			b:    "1\n2\n3\n4\n6\n7\n8\n9\n10\n",
+			want: "@@ -2,7 +2,6 @@\n 2\n 3\n 4\n-5\n 6\n 7\n 8\n",
+		},
+		{
+			name: "change",
+			a:    numbered(nil),
+			b:    numbered(map[string]string{"1": "x"}),
+			want: "@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n 4\n",
+		},
+		{
+			name: "nearby changes share a hunk",
+			a:    numbered(nil),
+			b:    numbered(map[string]string{"2": "x", "8": "y"}),
+			want: "@@ -1,10 +1,10 @@\n 1\n-2\n+x\n 3\n 4\n 5\n 6\n 7\n-8\n+y\n 9\n 10\n",
+		},
+		{
+			name: "distant changes get their own hunks",
+			a:    numbered(nil),
+			b:    numbered(map[string]string{"2": "x", "9": "y"}),
+			want: "@@ -1,5 +1,5 @@\n 1\n-2\n+x\n 3\n 4\n 5\n@@ -6,5 +6,5 @@\n 6\n 7\n 8\n-9\n+y\n 10\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			want := test.want
+			if len(want) != 0 {
+				want = "--- a/go.mod\n+++ b/go.mod\n" + want
+			}
+			if got := unifiedDiff("go.mod", []byte(test.a), []byte(test.b)); got != want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var dockerCmd = &cobra.Command{
+	Use:   "docker [flags]",
+	Short: "Print what's needed to build with the stored replaces in a container",
+	Long: `Print what's needed to build with the stored replaces in a container
+
+The local replaces point at directories on this machine that a container
+can't see. Each replaced module is given a directory under --root in the
+container and --format picks what's printed:
+
+  mounts  the -v arguments for docker run that bind mount the checkouts
+  copy    the --build-context arguments for docker build and the Dockerfile
+          COPY lines that copy the checkouts into the image
+  gomod   the module's go.mod with the replaces pointing at the container
+          directories, to use in place of go.mod in the container`,
+	RunE:         dockerRun,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+}
+
+// dockerMount is a local replace and where it goes in the container
+type dockerMount struct {
+	replace
+	container string
+}
+
+func dockerRun(cmd *cobra.Command, args []string) error {
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return err
+	}
+	root, err := cmd.Flags().GetString("root")
+	if err != nil {
+		return err
+	}
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+
+	if format != "mounts" && format != "copy" && format != "gomod" {
+		return fmt.Errorf("unknown format %q, must be mounts, copy or gomod", format)
+	}
+	if !path.IsAbs(root) {
+		return fmt.Errorf("--root must be an absolute path in the container: %s", root)
+	}
+	if len(output) != 0 && format != "gomod" {
+		return errors.New("--output can only be used with --format gomod")
+	}
+
+	modRoot, replaces, err := loadReplaces(cmd)
+	if err != nil {
+		return err
+	}
+
+	mounts, err := dockerMounts(modRoot, replaces, root)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "mounts":
+		var mountArgs []string
+		for _, m := range mounts {
+			mountArgs = append(mountArgs, "-v", fmt.Sprintf("%s:%s:ro", m.AbsPath, m.container))
+		}
+		outputf("%s", strings.Join(mountArgs, " "))
+	case "copy":
+		var contextArgs []string
+		for _, m := range mounts {
+			contextArgs = append(contextArgs, "--build-context", fmt.Sprintf("%s=%s", dockerContextName(m.ModuleName), m.AbsPath))
+		}
+		outputf("# docker build %s .", strings.Join(contextArgs, " "))
+		for _, m := range mounts {
+			outputf("COPY --from=%s . %s", dockerContextName(m.ModuleName), m.container)
+		}
+	case "gomod":
+		b, err := dockerGoMod(modRoot, replaces, mounts)
+		if err != nil {
+			return err
+		}
+		if len(output) == 0 {
+			outputf("%s", strings.TrimSuffix(string(b), "\n"))
+			return nil
+		}
+		if err = writeFile(output, b, 0664); err != nil {
+			return errors.Wrapf(err, "failed to write %s", output)
+		}
+		infof("wrote: %s", output)
+	}
+
+	return nil
+}
+
+// dockerMounts gives every local replace of the module in modRoot a
+// directory under root in the container, named after the module.
+func dockerMounts(modRoot string, replaces []replace, root string) ([]dockerMount, error) {
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	var mounts []dockerMount
+	for _, r := range expandWildcards(mod, mainReplaces(replaces)) {
+		if r.isRemote() {
+			continue
+		}
+		if info, err := os.Stat(r.AbsPath); err != nil || !info.IsDir() {
+			warnf("%s: %s does not exist, skipping it", r.ModuleName, r.AbsPath)
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(r.AbsPath, "go.mod")); err != nil {
+			warnf("%s: %s has no go.mod, run gomr up first so one is generated", r.ModuleName, r.AbsPath)
+		}
+
+		mounts = append(mounts, dockerMount{replace: r, container: path.Join(root, r.ModuleName)})
+	}
+
+	return mounts, nil
+}
+
+// dockerGoMod returns the go.mod in modRoot with the replaces installed and
+// the local ones pointing at their directories in the container.
+func dockerGoMod(modRoot string, replaces []replace, mounts []dockerMount) ([]byte, error) {
+	_, after, err := previewGoModEdit(modRoot, func(mod goModFile) []string {
+		var installs []replace
+		for _, r := range expandWildcards(mod, mainReplaces(replaces)) {
+			if r.isRemote() {
+				installs = append(installs, r)
+			}
+		}
+		for _, m := range mounts {
+			r := m.replace
+			r.AbsPath = m.container
+			installs = append(installs, r)
+		}
+		return replaceFlags(installs)
+	})
+	return after, err
+}
+
+// dockerContextName is the name of the build context for a module, docker
+// only allows a few characters in them.
+func dockerContextName(moduleName string) string {
+	return "gomr-" + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, moduleName)
+}
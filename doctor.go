@@ -0,0 +1,396 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor [flags]",
+	Short: "Find and fix broken gomr state in the module",
+	Long: `Find and fix broken gomr state in the module
+
+Looks for local replaces in go.mod that the gomr file doesn't know about,
+stored replaces whose directory or go.mod is missing, generated go.mods that
+were left behind after their replace was removed, lock files left by a gomr
+process that's no longer running and go.work directives that override the
+stored replaces. With --fix each problem that has a fix is offered, --yes
+applies them all without asking. Exits with 2 if problems remain.`,
+	RunE:         doctorRun,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+}
+
+// doctorFinding is a problem doctor found and how to fix it, if it can be
+type doctorFinding struct {
+	problem string
+	fix     string
+	apply   func() error
+}
+
+func doctorRun(cmd *cobra.Command, args []string) error {
+	fix, err := cmd.Flags().GetBool("fix")
+	if err != nil {
+		return err
+	}
+	yes, err := cmd.Flags().GetBool("yes")
+	if err != nil {
+		return err
+	}
+
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	remaining := 0
+	report := func(f doctorFinding) error {
+		outputf("%s", f.problem)
+		if f.apply == nil {
+			remaining++
+			return nil
+		}
+		outputf("  fix: %s", f.fix)
+		if !fix {
+			remaining++
+			return nil
+		}
+
+		if !yes {
+			ok, err := confirm(f.fix + "?")
+			if err != nil {
+				return err
+			}
+			if !ok {
+				remaining++
+				return nil
+			}
+		}
+		if err := f.apply(); err != nil {
+			return errors.Wrapf(err, "failed to %s", f.fix)
+		}
+		infof("fixed: %s", f.problem)
+		return nil
+	}
+
+	// The lock is checked before taking it so a stale one can be removed
+	// before anything else is fixed
+	staleLock, err := doctorLock(modRoot)
+	if err != nil {
+		return err
+	}
+	if staleLock != nil {
+		if err = report(*staleLock); err != nil {
+			return err
+		}
+	}
+
+	if fix {
+		lock, err := lockModule(modRoot)
+		if err != nil {
+			return err
+		}
+		defer lock.unlock()
+	}
+
+	findings, err := doctorModule(modRoot)
+	if err != nil {
+		return err
+	}
+	for _, f := range findings {
+		if err = report(f); err != nil {
+			return err
+		}
+	}
+
+	if staleLock == nil && len(findings) == 0 {
+		infof("no problems found")
+		return nil
+	}
+	if remaining == 0 {
+		return nil
+	}
+
+	return withExitCode(exitDrift, fmt.Errorf("doctor found %d problem(s) that remain", remaining))
+}
+
+// doctorLock checks for a lock file left behind by a gomr process that isn't
+// running anymore
+func doctorLock(modRoot string) (*doctorFinding, error) {
+	dir, err := storeDir(modRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, gomrLockFilename)
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", path)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err == nil && processRunning(pid) {
+		return &doctorFinding{problem: fmt.Sprintf("%s is held by running gomr process %d", path, pid)}, nil
+	}
+
+	// A lock that was just created may not have its pid written yet
+	if info, err := os.Stat(path); err == nil && len(b) == 0 && time.Since(info.ModTime()) < lockTimeout {
+		return nil, nil
+	}
+
+	return &doctorFinding{
+		problem: fmt.Sprintf("%s was left behind by a gomr process that's no longer running", path),
+		fix:     "delete " + path,
+		apply:   func() error { return removeFile(path) },
+	}, nil
+}
+
+// processRunning checks if a process with pid exists
+func processRunning(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
+
+// doctorModule finds everything wrong with the gomr state of the module in
+// modRoot other than its lock. The fixes change the stored replaces, so they
+// have to be applied in order.
+func doctorModule(modRoot string) ([]doctorFinding, error) {
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return nil, err
+	}
+	replaces, err := readGomrFile(gomrFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every fix reads the stored replaces again since an earlier fix may
+	// have changed them
+	editStored := func(modulePath string, edit func(replaces []replace, i int) ([]replace, error)) func() error {
+		return func() error {
+			replaces, err := readGomrFile(gomrFilePath)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+
+			files, err := moduleFiles(modRoot, replaces)
+			if err != nil {
+				return err
+			}
+			tx, err := beginTransaction(files...)
+			if err != nil {
+				return err
+			}
+
+			return tx.run(func() error {
+				replaces, err := edit(replaces, findReplace(replaces, modulePath))
+				if err != nil {
+					return err
+				}
+				return writeGomrFile(gomrFilePath, replaces)
+			})
+		}
+	}
+
+	var findings []doctorFinding
+
+	managed := make(map[string]bool)
+	for _, r := range appliedReplaces(mod, replaces) {
+		managed[strings.ToLower(r.ModuleName)] = true
+	}
+	for _, rep := range mod.Replace {
+		if !isLocalPath(rep.New.Path) || len(rep.Old.Version) != 0 || managed[strings.ToLower(rep.Old.Path)] {
+			continue
+		}
+
+		absPath := rep.New.Path
+		if !filepath.IsAbs(absPath) {
+			absPath = filepath.Join(modRoot, absPath)
+		}
+		adopted := replace{ModuleName: rep.Old.Path, AbsPath: absPath, Added: time.Now()}
+
+		findings = append(findings, doctorFinding{
+			problem: fmt.Sprintf("go.mod replaces %s => %s but the gomr file has no entry for it", rep.Old.Path, rep.New.Path),
+			fix:     "adopt the replace into the gomr file",
+			apply: editStored(rep.Old.Path, func(replaces []replace, i int) ([]replace, error) {
+				if i >= 0 {
+					return replaces, nil
+				}
+				return append(replaces, adopted), nil
+			}),
+		})
+	}
+
+	for _, r := range replaces {
+		if r.isRemote() || r.isWildcard() {
+			continue
+		}
+		r := r
+
+		if _, err := os.Stat(r.AbsPath); os.IsNotExist(err) {
+			findings = append(findings, doctorFinding{
+				problem: fmt.Sprintf("%s: %s does not exist", r.ModuleName, r.AbsPath),
+				fix:     "remove the stored replace for " + r.ModuleName,
+				apply: editStored(r.ModuleName, func(replaces []replace, i int) ([]replace, error) {
+					if i < 0 {
+						return replaces, nil
+					}
+					remaining := append(append([]replace(nil), replaces[:i]...), replaces[i+1:]...)
+					if err := dropStoredReplace(modRoot, replaces[i], remaining, false); err != nil {
+						return nil, err
+					}
+					if err := forgetStub(modRoot, replaces[i].AbsPath); err != nil {
+						return nil, err
+					}
+					return remaining, restoreGoSum(modRoot)
+				}),
+			})
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if _, err := os.Stat(filepath.Join(r.AbsPath, "go.mod")); os.IsNotExist(err) && !r.AddGoMod {
+			findings = append(findings, doctorFinding{
+				problem: fmt.Sprintf("%s: %s has no go.mod", r.ModuleName, r.AbsPath),
+				fix:     "have gomr generate a go.mod for " + r.ModuleName + " when it's installed",
+				apply: editStored(r.ModuleName, func(replaces []replace, i int) ([]replace, error) {
+					if i >= 0 {
+						replaces[i].AddGoMod = true
+					}
+					return replaces, nil
+				}),
+			})
+		} else if problem := checkModulePath(r); len(problem) != 0 {
+			findings = append(findings, doctorFinding{problem: fmt.Sprintf("%s: %s", r.ModuleName, problem)})
+		}
+	}
+
+	stubs, err := doctorStubs(modRoot, mod, replaces)
+	if err != nil {
+		return nil, err
+	}
+	findings = append(findings, stubs...)
+
+	if goWork := activeGoWork(modRoot); len(goWork) != 0 {
+		overrides, err := workspaceOverrides(goWork, enabledReplaces(replaces))
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range overrides {
+			f := doctorFinding{problem: fmt.Sprintf("%s, overriding the replace with %s", o, o.replacement())}
+			if !o.use {
+				modulePath := o.ModuleName
+				f.fix = "drop the replace of " + modulePath + " from " + goWork
+				f.apply = func() error { return gowork(goWork, "edit", "-dropreplace="+modulePath) }
+			}
+			findings = append(findings, f)
+		}
+	}
+
+	return findings, nil
+}
+
+// doctorStubs finds the go.mods gomr generated that are still around though
+// no installed replace needs them, and records of stubs that are gone
+func doctorStubs(modRoot string, mod goModFile, replaces []replace) ([]doctorFinding, error) {
+	sums, err := readStubSums(modRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	installed := make(map[string]bool)
+	for _, r := range appliedReplaces(mod, replaces) {
+		installed[filepath.Clean(r.AbsPath)] = true
+	}
+	if goWork := activeGoWork(modRoot); len(goWork) != 0 {
+		if work, err := readGoWork(goWork); err == nil {
+			for _, rep := range work.Replace {
+				installed[filepath.Clean(rep.New.Path)] = true
+			}
+		}
+	}
+
+	var dirs []string
+	for dir := range sums.Stubs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	var findings []doctorFinding
+	for _, dir := range dirs {
+		if installed[filepath.Clean(dir)] {
+			continue
+		}
+		dir, sum := dir, sums.Stubs[dir]
+
+		goModPath := filepath.Join(dir, "go.mod")
+		b, err := ioutil.ReadFile(goModPath)
+		switch {
+		case os.IsNotExist(err):
+			findings = append(findings, doctorFinding{
+				problem: fmt.Sprintf("the generated go.mod in %s is recorded but no longer exists", dir),
+				fix:     "forget the generated go.mod in " + dir,
+				apply:   func() error { return forgetStub(modRoot, dir) },
+			})
+		case err != nil:
+			return nil, errors.Wrapf(err, "failed to read %s", goModPath)
+		case !isGeneratedStub(b, sum):
+			findings = append(findings, doctorFinding{
+				problem: fmt.Sprintf("%s was generated by gomr but has changed since, it's no longer treated as generated", goModPath),
+				fix:     "forget that gomr generated " + goModPath,
+				apply:   func() error { return forgetStub(modRoot, dir) },
+			})
+		default:
+			findings = append(findings, doctorFinding{
+				problem: fmt.Sprintf("%s was generated by gomr but no installed replace uses it", goModPath),
+				fix:     "delete the generated go.mod in " + dir + " and its go.sum if it hasn't changed",
+				apply: func() error {
+					if err := removeFile(goModPath); err != nil && !os.IsNotExist(err) {
+						return err
+					}
+					if err := removeStubGoSum(dir, sums, false); err != nil {
+						return err
+					}
+					return forgetStub(modRoot, dir)
+				},
+			})
+		}
+	}
+
+	return findings, nil
+}
+
+// forgetStub removes the record of the go.mod generated in dir
+func forgetStub(modRoot, dir string) error {
+	sums, err := readStubSums(modRoot)
+	if err != nil {
+		return err
+	}
+
+	delete(sums.Stubs, dir)
+	delete(sums.GoSums, dir)
+	return writeStubSums(modRoot, sums)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// dryRun is set by the --dry-run flag. The helpers in this file print what
+// they would do instead of doing it when it's set, so commands that only
+// change the module through them make no changes.
+var dryRun bool
+
+// writeFile writes b to path, creating the directory it's in if needed
+func writeFile(path string, b []byte, mode os.FileMode) error {
+	if dryRun {
+		infof("would write: %s", path)
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+		return errors.Wrapf(err, "failed to create dir for %s", path)
+	}
+
+	return ioutil.WriteFile(path, b, mode)
+}
+
+// removeFile deletes the file at path, the error is from os.Remove so
+// os.IsNotExist works on it
+func removeFile(path string) error {
+	if dryRun {
+		if _, err := os.Stat(path); err != nil {
+			return err
+		}
+		infof("would delete: %s", path)
+		return nil
+	}
+
+	return os.Remove(path)
+}
+
+// gomod runs go mod with the args in dir
+func gomod(dir string, args ...string) error {
+	if dryRun {
+		infof("would run: go mod %s (in %s)", strings.Join(args, " "), dir)
+		return nil
+	}
+
+	return runGoMod(dir, args...)
+}
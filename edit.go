@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var editCmd = &cobra.Command{
+	Use:   "edit <module>",
+	Short: "Open the checkout a module is replaced with in your editor",
+	Long: `Open the checkout a module is replaced with in your editor
+
+Runs the editor setting from the config, or $VISUAL or $EDITOR, with the
+shell in the checkout of the module's local replace, passing it the
+checkout's path.`,
+	RunE:         editRun,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+}
+
+func editRun(cmd *cobra.Command, args []string) error {
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	stored, err := storedReplaces(modRoot)
+	if err != nil {
+		return err
+	}
+	path, err := replacePath(stored, args[0])
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(path); err != nil {
+		return withExitCode(exitMissing, fmt.Errorf("the path of %s doesn't exist: %s", args[0], path))
+	}
+
+	editor, err := editorCommand(modRoot)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		infof("would run: %s %s (in %s)", editor, shellQuote(path), path)
+		return nil
+	}
+
+	c := shellCommand(editor + " " + shellQuote(path))
+	c.Dir = path
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	debugf("running: %s %s (in %s)", editor, shellQuote(path), path)
+	if err = runForwardingSignals(c); err != nil {
+		return fmt.Errorf("%s failed: %v", editor, err)
+	}
+	return nil
+}
+
+// editorCommand returns the editor to run: the editor setting, then $VISUAL
+// and then $EDITOR
+func editorCommand(modRoot string) (string, error) {
+	cfg, err := loadConfig(modRoot)
+	if err != nil {
+		return "", err
+	}
+	if len(cfg.Editor) != 0 {
+		return cfg.Editor, nil
+	}
+
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if editor := os.Getenv(name); len(editor) != 0 {
+			return editor, nil
+		}
+	}
+
+	return "", errors.New("no editor to run, set $EDITOR or the editor setting (gomr config set --user editor code)")
+}
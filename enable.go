@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var enableCmd = &cobra.Command{
+	Use:   "enable [flags] <module>...",
+	Short: "Enable disabled replaces so up installs them again",
+	RunE:  enableRun,
+	Args:  cobra.MinimumNArgs(1),
+}
+
+var disableCmd = &cobra.Command{
+	Use:   "disable [flags] <module>...",
+	Short: "Remove replaces from go.mod and have up and down skip them, keeping them in the gomr file",
+	RunE:  disableRun,
+	Args:  cobra.MinimumNArgs(1),
+}
+
+func enableRun(cmd *cobra.Command, args []string) error {
+	return setDisabled(args, false)
+}
+
+func disableRun(cmd *cobra.Command, args []string) error {
+	return setDisabled(args, true)
+}
+
+// setDisabled marks the replaces for the modules as disabled or enabled. A
+// replace that's being disabled is also removed from go.mod if it's there.
+func setDisabled(modules []string, disabled bool) error {
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	lock, err := lockModule(modRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return err
+	}
+	stored, err := readGomrFile(gomrFilePath)
+	if err != nil {
+		return err
+	}
+
+	var changed []replace
+	for _, module := range modules {
+		i := lookupReplace(stored, module)
+		if i < 0 {
+			return fmt.Errorf("could not find stored replace for module: %s", module)
+		}
+		if stored[i].Disabled != disabled {
+			changed = append(changed, stored[i])
+			stored[i].Disabled = disabled
+		}
+	}
+
+	if len(changed) == 0 {
+		infof("nothing to change")
+		return nil
+	}
+
+	files, err := moduleFiles(modRoot, changed)
+	if err != nil {
+		return err
+	}
+	tx, err := beginTransaction(files...)
+	if err != nil {
+		return err
+	}
+
+	err = tx.run(func() error {
+		if disabled {
+			mod, err := readGoMod(modRoot)
+			if err != nil {
+				return err
+			}
+
+			if applied := appliedReplaces(mod, changed); len(applied) != 0 {
+				if err = uninstallReplaces(modRoot, applied, false); err != nil {
+					return err
+				}
+				if err = restoreRequires(modRoot, applied); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := writeGomrFile(gomrFilePath, stored); err != nil {
+			return err
+		}
+		return restoreGoSum(modRoot)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, r := range changed {
+		if disabled {
+			infof("disabled replace: %s => %s", r.ModuleName, r.replacement())
+		} else {
+			infof("enabled replace: %s => %s", r.ModuleName, r.replacement())
+		}
+	}
+	if !disabled {
+		infof("run gomr up to install them")
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// flagEnvPrefix starts the name of the environment variable for every flag
+const flagEnvPrefix = "GOMR_"
+
+// noEnvFlags are the flags that are never set from the environment. They
+// confirm or widen what a single run does, so a variable left set would make
+// every command do it.
+var noEnvFlags = map[string]bool{
+	"yes":   true,
+	"force": true,
+	"all":   true,
+	"help":  true,
+}
+
+// childEnv are the variables gomr sets for the shells, commands and hooks it
+// runs. Flags named like them, such as --module and --root, aren't read from
+// them so a gomr run inside one doesn't pick up what its parent set.
+var childEnv = map[string]bool{
+	"GOMR_HOOK":    true,
+	"GOMR_MODULE":  true,
+	"GOMR_MODULES": true,
+	"GOMR_PATH":    true,
+	"GOMR_ROOT":    true,
+	"GOMR_SHELL":   true,
+}
+
+// flagEnvName returns the environment variable for a flag, --dry-run is
+// GOMR_DRY_RUN
+func flagEnvName(name string) string {
+	return flagEnvPrefix + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// loadFlagEnv sets each of cmd's flags that wasn't given on the command line
+// from its environment variable, if that's set, except for the noEnvFlags and
+// the childEnv names. They count as given, so they also win over the config.
+// --verbose is set first so setting the rest is logged when it's set.
+func loadFlagEnv(cmd *cobra.Command) error {
+	names := []string{"verbose"}
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Name != "verbose" && !noEnvFlags[f.Name] && !childEnv[flagEnvName(f.Name)] {
+			names = append(names, f.Name)
+		}
+	})
+
+	for _, name := range names {
+		f := cmd.Flags().Lookup(name)
+		if f == nil || f.Changed {
+			continue
+		}
+
+		env := flagEnvName(name)
+		value, ok := os.LookupEnv(env)
+		if !ok {
+			continue
+		}
+
+		if err := cmd.Flags().Set(name, value); err != nil {
+			return fmt.Errorf("invalid value %q in %s for --%s: %v", value, env, name, err)
+		}
+		debugf("--%s set from %s", name, env)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/spf13/cobra"
+)
+
+var execCmd = &cobra.Command{
+	Use:   "exec [flags] -- <command> [args...]",
+	Short: "Run a command with the stored replaces applied, then restore go.mod",
+	Long: `Run a command with the stored replaces applied, then restore go.mod
+
+The go.mod and go.sum files are put back exactly as they were before the
+command ran, even if the command fails.`,
+	RunE:         execRun,
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+}
+
+func execRun(cmd *cobra.Command, args []string) error {
+	modRoot, replaces, err := loadReplaces(cmd)
+	if err != nil {
+		return err
+	}
+
+	return withReplaces(modRoot, replaces, func() error {
+		c := exec.Command(args[0], args[1:]...)
+		c.Stdin = os.Stdin
+		c.Stdout = os.Stdout
+		c.Stderr = os.Stderr
+		return runForwardingSignals(c)
+	})
+}
+
+// withReplaces installs the replaces, calls fn and then puts the module back
+// exactly the way it was regardless of whether fn succeeded. Signals don't
+// kill gomr until the module is back, a signal while the replaces are being
+// installed skips fn.
+//
+// The module is only locked while the replaces are being installed and
+// removed so other gomr commands can still be used while fn runs.
+func withReplaces(modRoot string, replaces []replace, fn func() error) (err error) {
+	trap := trapSignals()
+	defer trap.stop()
+
+	lock, err := lockModule(modRoot)
+	if err != nil {
+		return err
+	}
+
+	files, err := moduleFiles(modRoot, replaces)
+	if err != nil {
+		lock.unlock()
+		return err
+	}
+	tx, err := beginTransaction(files...)
+	if err != nil {
+		lock.unlock()
+		return err
+	}
+
+	// Rolling back removes the generated go.mod files and overwrites go.mod,
+	// go.sum and gomr's own files like stubs.toml with their original
+	// contents.
+	defer func() {
+		if lock == nil {
+			var lockErr error
+			if lock, lockErr = lockModule(modRoot); lockErr != nil {
+				if err == nil {
+					err = lockErr
+				}
+				return
+			}
+		}
+		defer lock.unlock()
+
+		if rbErr := tx.rollback(); err == nil {
+			err = rbErr
+		}
+	}()
+
+	err = installReplaces(modRoot, replaces)
+	lock.unlock()
+	lock = nil
+	if err != nil {
+		return err
+	}
+	if s := trap.signal(); s != nil {
+		return fmt.Errorf("interrupted by %v, go.mod was restored", s)
+	}
+
+	return fn()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Exit codes gomr uses so that scripts can tell failures apart
+const (
+	// exitOK means the command succeeded
+	exitOK = 0
+	// exitError is any other error, including usage errors
+	exitError = 1
+	// exitDrift means check or audit found go.mod, go.sum or a replace in a
+	// state it shouldn't be in
+	exitDrift = 2
+	// exitMissing means a replace's path doesn't exist
+	exitMissing = 3
+)
+
+// codedError is an error that makes gomr exit with a specific code
+type codedError struct {
+	code int
+	err  error
+}
+
+// withExitCode makes err exit gomr with code
+func withExitCode(code int, err error) error {
+	return codedError{code: code, err: err}
+}
+
+func (c codedError) Error() string {
+	return c.err.Error()
+}
+
+// Cause returns the wrapped error for errors.Cause
+func (c codedError) Cause() error {
+	return c.err
+}
+
+// exitCode returns the code gomr should exit with for err, the code of the
+// outermost codedError it wraps or exitError if there's none.
+func exitCode(err error) int {
+	type causer interface {
+		Cause() error
+	}
+
+	for err != nil {
+		if c, ok := err.(codedError); ok {
+			return c.code
+		}
+
+		cause, ok := err.(causer)
+		if !ok {
+			break
+		}
+		err = cause.Cause()
+	}
+
+	return exitError
+}
+
+// exit prints err if there is one and exits with the code for it
+func exit(err error) {
+	if err == nil {
+		os.Exit(exitOK)
+	}
+
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(exitCode(err))
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestExitCode(t *testing.T) {
+	failed := errors.New("failed")
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"plain error", failed, exitError},
+		{"drift", withExitCode(exitDrift, failed), exitDrift},
+		{"missing", withExitCode(exitMissing, failed), exitMissing},
+		{"wrapped", errors.Wrap(withExitCode(exitMissing, failed), "context"), exitMissing},
+		{"wrapped twice", errors.Wrapf(errors.WithMessage(withExitCode(exitDrift, failed), "inner"), "outer"), exitDrift},
+		{"outermost code wins", withExitCode(exitDrift, errors.Wrap(withExitCode(exitMissing, failed), "context")), exitDrift},
+		{"formatted loses the code", fmt.Errorf("context: %v", withExitCode(exitDrift, failed)), exitError},
+	}
+
+	for _, test := range tests {
+		if got := exitCode(test.err); got != test.want {
+			t.Errorf("%s: exitCode(%v) = %d, want %d", test.name, test.err, got, test.want)
+		}
+	}
+
+	if msg := withExitCode(exitDrift, failed).Error(); msg != failed.Error() {
+		t.Errorf("withExitCode changed the message to %q", msg)
+	}
+}
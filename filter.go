@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// filterAttribute is the .gitattributes line that enables the gomr filter
+const filterAttribute = "go.mod filter=gomr"
+
+var filterCmd = &cobra.Command{
+	Use:   "filter <command>",
+	Short: "Git filter driver that keeps replaces out of committed go.mod files",
+	Long: `Git filter driver that keeps replaces out of committed go.mod files
+
+The clean filter strips the replaces managed by gomr from go.mod as it is
+staged, and the smudge filter adds them back when go.mod is checked out.
+Both read go.mod on stdin and write the result to stdout. Use filter install
+to configure git to use them.`,
+}
+
+var filterCleanCmd = &cobra.Command{
+	Use:          "clean [path/to/go.mod]",
+	Short:        "Remove gomr replaces from the go.mod on stdin",
+	RunE:         filterCleanRun,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+}
+
+var filterSmudgeCmd = &cobra.Command{
+	Use:          "smudge [path/to/go.mod]",
+	Short:        "Add gomr replaces to the go.mod on stdin",
+	RunE:         filterSmudgeRun,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+}
+
+var filterInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Configure the current git repository to use the gomr filter for go.mod",
+	RunE:  filterInstallRun,
+}
+
+func filterCleanRun(cmd *cobra.Command, args []string) error {
+	return runFilter(args, func(modRoot string, mod goModFile, replaces []replace) []string {
+		return dropReplaceFlags(appliedReplaces(mod, replaces))
+	})
+}
+
+func filterSmudgeRun(cmd *cobra.Command, args []string) error {
+	return runFilter(args, func(modRoot string, mod goModFile, replaces []replace) []string {
+		missing := unappliedReplaces(mod, enabledReplaces(replaces))
+		if err := createStubs(modRoot, missing); err != nil {
+			warnf("gomr: %v", err)
+		}
+		return replaceFlags(missing)
+	})
+}
+
+// runFilter reads a go.mod from stdin, asks edits for the go mod edit flags
+// to apply to it and writes the result to stdout. If gomr isn't in use for
+// the module or there's nothing to change the input is passed through
+// untouched so the filter never rewrites unrelated formatting.
+func runFilter(args []string, edits func(modRoot string, mod goModFile, replaces []replace) []string) error {
+	input, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return errors.Wrap(err, "failed to read stdin")
+	}
+
+	output, err := filterGoMod(args, input, edits)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.Write(output)
+	return err
+}
+
+func filterGoMod(args []string, input []byte, edits func(modRoot string, mod goModFile, replaces []replace) []string) ([]byte, error) {
+	var modRoot string
+	var err error
+	if len(args) != 0 {
+		modRoot, err = filepath.Abs(filepath.Dir(args[0]))
+	} else {
+		modRoot, err = findModuleRoot()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	replaces, err := readGomrFile(gomrFilePath)
+	if os.IsNotExist(err) {
+		return input, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	tmpDir, err := ioutil.TempDir("", "gomr-filter")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpGoMod := filepath.Join(tmpDir, "go.mod")
+	if err = ioutil.WriteFile(tmpGoMod, input, 0664); err != nil {
+		return nil, err
+	}
+
+	mod, err := readGoMod(tmpDir)
+	if err != nil {
+		return nil, err
+	}
+
+	flags := edits(modRoot, mod, replaces)
+	if len(flags) == 0 {
+		return input, nil
+	}
+
+	if err = runGoMod(tmpDir, append(append([]string{"edit"}, flags...), tmpGoMod)...); err != nil {
+		return nil, err
+	}
+
+	return ioutil.ReadFile(tmpGoMod)
+}
+
+func filterInstallRun(cmd *cobra.Command, args []string) error {
+	topLevel, err := gitOutput("", "rev-parse", "--show-toplevel")
+	if err != nil {
+		return err
+	}
+
+	gomrBin, err := os.Executable()
+	if err != nil {
+		gomrBin = "gomr"
+	}
+
+	configs := [][2]string{
+		{"filter.gomr.clean", shellQuote(gomrBin) + storeFlag() + " filter clean %f"},
+		{"filter.gomr.smudge", shellQuote(gomrBin) + storeFlag() + " filter smudge %f"},
+	}
+	for _, c := range configs {
+		if _, err = gitOutput(topLevel, "config", c[0], c[1]); err != nil {
+			return err
+		}
+	}
+
+	attrPath := filepath.Join(topLevel, ".gitattributes")
+	attrs, err := ioutil.ReadFile(attrPath)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to read .gitattributes")
+	}
+
+	for _, line := range strings.Split(string(attrs), "\n") {
+		if strings.TrimSpace(line) == filterAttribute {
+			infof("gomr filter installed")
+			return nil
+		}
+	}
+
+	if len(attrs) != 0 && !bytes.HasSuffix(attrs, []byte("\n")) {
+		attrs = append(attrs, '\n')
+	}
+	attrs = append(attrs, filterAttribute+"\n"...)
+	if err = ioutil.WriteFile(attrPath, attrs, 0664); err != nil {
+		return errors.Wrap(err, "failed to write .gitattributes")
+	}
+
+	infof("gomr filter installed")
+	return nil
+}
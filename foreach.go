@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/spf13/cobra"
+)
+
+var foreachCmd = &cobra.Command{
+	Use:   "foreach [flags] -- <command> [args...]",
+	Short: "Run a command in the directory of every replaced module",
+	Long: `Run a command in the directory of every replaced module
+
+A single argument is run with the shell so it can use pipes and the like,
+otherwise the arguments are the command and its arguments. GOMR_MODULE is set
+to the module path, GOMR_PATH to its directory and GOMR_ROOT to the root of
+the current module. --jobs runs the command in several modules at once.`,
+	RunE:         foreachRun,
+	Args:         cobra.MinimumNArgs(1),
+	SilenceUsage: true,
+}
+
+func foreachRun(cmd *cobra.Command, args []string) error {
+	jobs, err := cmd.Flags().GetInt("jobs")
+	if err != nil {
+		return err
+	}
+
+	modRoot, replaces, err := loadReplaces(cmd)
+	if err != nil {
+		return err
+	}
+
+	checkouts, err := replacedCheckouts(modRoot, replaces, false)
+	if err != nil {
+		return err
+	}
+	if len(checkouts) == 0 {
+		infof("no replaced modules to run in")
+		return nil
+	}
+
+	results := runInCheckouts(checkouts, jobs, func(c checkout) *exec.Cmd {
+		var command *exec.Cmd
+		if len(args) == 1 {
+			command = shellCommand(args[0])
+		} else {
+			command = exec.Command(args[0], args[1:]...)
+		}
+		command.Env = append(os.Environ(),
+			"GOMR_MODULE="+c.module,
+			"GOMR_PATH="+c.dir,
+			"GOMR_ROOT="+modRoot,
+		)
+		return command
+	})
+
+	if failed := reportCheckoutResults(results, false); failed != 0 {
+		return fmt.Errorf("command failed in %d of %d module(s)", failed, len(results))
+	}
+	return nil
+}
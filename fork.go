@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var forkCmd = &cobra.Command{
+	Use:   "fork [flags] <module>",
+	Short: "Fork a module's repository, clone it and replace the module with it",
+	Long: `Fork a module's repository, clone it and replace the module with it
+
+The repository is forked with the GitHub CLI (gh) and the fork is cloned to
+where gomr add would look for the module (the path mappings or GOPATH), with
+the original repository as the upstream remote. If gh isn't available, create
+the fork by hand and pass its url with --remote. The fork's url is recorded
+in the gomr file.`,
+	RunE: forkRun,
+	Args: cobra.ExactArgs(1),
+}
+
+func forkRun(cmd *cobra.Command, args []string) error {
+	moduleName := args[0]
+
+	profiles, err := cmd.Flags().GetStringSlice("profile")
+	if err != nil {
+		return err
+	}
+	note, err := cmd.Flags().GetString("note")
+	if err != nil {
+		return err
+	}
+	remote, err := cmd.Flags().GetString("remote")
+	if err != nil {
+		return err
+	}
+	dir, err := cmd.Flags().GetString("dir")
+	if err != nil {
+		return err
+	}
+
+	if err = checkAddModule(moduleName); err != nil {
+		return err
+	}
+
+	repoPath, subdir, err := knownHostRepo(moduleName)
+	if err != nil {
+		return err
+	}
+
+	mapped := false
+	if len(dir) == 0 {
+		if dir, mapped, err = defaultModulePath(repoPath); err != nil {
+			return err
+		}
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return err
+	}
+
+	if _, err = os.Stat(dir); err == nil {
+		return fmt.Errorf("%s already exists, use gomr add to replace with it", dir)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	modDir := dir
+	if len(subdir) != 0 {
+		modDir = filepath.Join(dir, filepath.FromSlash(subdir))
+	}
+
+	upstream := "https://" + repoPath + ".git"
+	if dryRun {
+		if len(remote) == 0 {
+			infof("would fork: %s with gh and clone it into %s", repoPath, dir)
+		} else {
+			infof("would clone: %s into %s with %s as upstream", remote, dir, upstream)
+		}
+		infof("would add replace: %s => %s", moduleName, modDir)
+		return nil
+	}
+
+	if len(remote) == 0 {
+		remote, err = ghFork(repoPath, dir)
+	} else {
+		err = gitCloneFork(remote, upstream, dir)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return err
+	}
+
+	r := replace{
+		ModuleName: moduleName,
+		Fork:       remote,
+		Profiles:   profiles,
+		Note:       note,
+		Added:      time.Now(),
+	}
+
+	if err = resolveAddTarget(&r, modDir, addOptions{}); err != nil {
+		return err
+	}
+	r.mapped = mapped && len(subdir) == 0
+
+	return storeReplaces([]replace{r}, false, false)
+}
+
+// ghFork forks the GitHub repository at repoPath using the gh cli and clones
+// the fork into dir, gh sets up the upstream remote itself. It returns the
+// url of the fork.
+func ghFork(repoPath, dir string) (string, error) {
+	if _, err := exec.LookPath("gh"); err != nil {
+		return "", errors.New("gh is required to fork repositories, or fork it yourself and pass --remote")
+	}
+
+	ownerRepo := strings.TrimPrefix(repoPath, "github.com/")
+	if err := os.MkdirAll(filepath.Dir(dir), 0775); err != nil {
+		return "", errors.Wrap(err, "failed to create clone dir")
+	}
+
+	gh := exec.Command("gh", "repo", "fork", ownerRepo, "--clone", "--remote", "--", dir)
+	gh.Stdout = os.Stdout
+	gh.Stderr = os.Stderr
+	if err := gh.Run(); err != nil {
+		return "", errors.Wrapf(err, "failed to fork %s", ownerRepo)
+	}
+
+	return gitOutput(dir, "remote", "get-url", "origin")
+}
+
+// gitCloneFork clones an existing fork into dir and adds the original
+// repository as the upstream remote.
+func gitCloneFork(fork, upstream, dir string) error {
+	clone := exec.Command("git", "clone", fork, dir)
+	clone.Stdout = os.Stdout
+	clone.Stderr = os.Stderr
+	if err := clone.Run(); err != nil {
+		return errors.Wrapf(err, "failed to clone %s", fork)
+	}
+
+	_, err := gitOutput(dir, "remote", "add", "upstream", upstream)
+	return err
+}
+
+// knownHostRepo splits a module path hosted on a well known code host into
+// the repository path and the directory of the module within it.
+func knownHostRepo(moduleName string) (repoPath, subdir string, err error) {
+	parts := strings.Split(moduleName, "/")
+	switch parts[0] {
+	case "github.com", "gitlab.com", "bitbucket.org":
+	default:
+		return "", "", fmt.Errorf("can only work out the repository of github.com, gitlab.com and bitbucket.org modules, not: %s", moduleName)
+	}
+
+	if len(parts) < 3 {
+		return "", "", fmt.Errorf("invalid module path: %s", moduleName)
+	}
+
+	repoPath = path.Join(parts[:3]...)
+	subdir = path.Join(parts[3:]...)
+
+	// Major version suffixes are usually branches rather than directories
+	if isMajorSuffix(subdir) {
+		subdir = ""
+	}
+
+	return repoPath, subdir, nil
+}
+
+// isMajorSuffix checks if s is a major version path element like v2
+func isMajorSuffix(s string) bool {
+	if len(s) < 2 || s[0] != 'v' || s == "v1" {
+		return false
+	}
+	for _, c := range s[1:] {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s[1] != '0'
+}
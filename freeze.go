@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var freezeCmd = &cobra.Command{
+	Use:   "freeze <module>",
+	Short: "Require the pushed commit of a replaced module and drop the replace",
+	Long: `Require the pushed commit of a replaced module and drop the replace
+
+Checks that the local checkout has no uncommitted changes and that its
+current commit has been pushed, then removes the replace the same way
+remove does and requires the version of that commit instead, a
+pseudo-version unless the commit is tagged.`,
+	RunE:         freezeRun,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+}
+
+func freezeRun(cmd *cobra.Command, args []string) error {
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	lock, err := lockModule(modRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return err
+	}
+	replaces, err := readGomrFile(gomrFilePath)
+	if err != nil {
+		return err
+	}
+
+	i := lookupReplace(replaces, args[0])
+	if i < 0 {
+		return fmt.Errorf("could not find stored replace for module: %s", args[0])
+	}
+	r := replaces[i]
+	if r.isRemote() || r.isWildcard() {
+		return fmt.Errorf("%s: only a replace with a local checkout can be frozen", r.ModuleName)
+	}
+
+	commit, err := pushedCommit(r.AbsPath)
+	if err != nil {
+		return errors.Wrapf(err, "cannot freeze %s", r.ModuleName)
+	}
+
+	out, err := goOutput(modRoot, "list", "-m", "-f", "{{.Version}}", r.ModuleName+"@"+commit)
+	if err != nil {
+		return errors.Wrapf(err, "failed to find the version of %s@%s", r.ModuleName, commit)
+	}
+	version := strings.TrimSpace(string(out))
+
+	// Dropping a replace puts back its require version, which is how the
+	// new version gets required
+	r.Require = version
+	replaces = append(replaces[:i], replaces[i+1:]...)
+
+	files, err := moduleFiles(modRoot, []replace{r})
+	if err != nil {
+		return err
+	}
+
+	err = recordOperation(modRoot, operationName("freeze", []replace{r}), files, func() error {
+		if err := dropStoredReplace(modRoot, r, replaces, false); err != nil {
+			return err
+		}
+		if err := writeGomrFile(gomrFilePath, replaces); err != nil {
+			return errors.Wrap(err, "failed to write gomr file after freeze")
+		}
+		if err := restoreGoSum(modRoot); err != nil {
+			return err
+		}
+
+		// go.sum doesn't have the new version's hashes yet
+		return gomod(modRoot, "download", r.ModuleName)
+	})
+	if err != nil {
+		return err
+	}
+
+	infof("froze %s at %s", r.ModuleName, version)
+	return nil
+}
+
+// pushedCommit returns the commit checked out in dir after making sure it
+// has no uncommitted changes and the commit is on a remote branch.
+func pushedCommit(dir string) (string, error) {
+	dirty, err := gitDirty(dir, true)
+	if err != nil {
+		return "", err
+	}
+	if dirty {
+		return "", fmt.Errorf("%s has uncommitted changes", dir)
+	}
+
+	commit, err := gitOutput(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	pushed, err := commitPushed(dir, commit)
+	if err != nil {
+		return "", err
+	}
+	if !pushed {
+		return "", fmt.Errorf("commit %s in %s has not been pushed", commit[:12], dir)
+	}
+
+	return commit, nil
+}
+
+// commitPushed checks if commit in the repository containing dir is on any
+// remote branch
+func commitPushed(dir, commit string) (bool, error) {
+	remotes, err := gitOutput(dir, "branch", "--remotes", "--contains", commit)
+	if err != nil {
+		return false, err
+	}
+	return len(remotes) != 0, nil
+}
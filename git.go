@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// gitOutput runs a git command in dir and returns its trimmed stdout
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	if len(dir) != 0 {
+		cmd.Dir = dir
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	debugf("running: git %s (in %s)", strings.Join(args, " "), cmd.Dir)
+	b, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if len(msg) == 0 {
+			return "", errors.Wrapf(err, "git %s failed", strings.Join(args, " "))
+		}
+		return "", errors.Errorf("git %s failed: %s", strings.Join(args, " "), msg)
+	}
+
+	return strings.TrimSpace(string(b)), nil
+}
+
+// isGitRepo checks if dir is inside a git work tree
+func isGitRepo(dir string) bool {
+	out, err := gitOutput(dir, "rev-parse", "--is-inside-work-tree")
+	return err == nil && out == "true"
+}
+
+// gitDirty checks if dir has uncommitted changes. The go.mod and go.sum in
+// dir are ignored when ignoreGoMod is set since gomr may have created them.
+func gitDirty(dir string, ignoreGoMod bool) (bool, error) {
+	args := []string{"status", "--porcelain", "--", "."}
+	if ignoreGoMod {
+		args = append(args, ":(exclude)go.mod", ":(exclude)go.sum")
+	}
+
+	out, err := gitOutput(dir, args...)
+	if err != nil {
+		return false, err
+	}
+
+	return len(out) != 0, nil
+}
+
+// gitCheckout checks out ref in the repository containing dir, fetching from
+// the remotes first if the ref isn't known locally yet.
+func gitCheckout(dir, ref string) error {
+	if _, err := gitOutput(dir, "checkout", "--quiet", ref); err == nil {
+		return nil
+	}
+
+	if _, err := gitOutput(dir, "fetch", "--quiet", "--all"); err != nil {
+		return err
+	}
+
+	_, err := gitOutput(dir, "checkout", "--quiet", ref)
+	return err
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// gitWorkers is how many checkouts have their git state read at once
+const gitWorkers = 8
+
+// gitState is the state of a replace's checkout
+type gitState struct {
+	// repo is false when the replace isn't a git checkout, or is remote or a
+	// wildcard, the other fields are empty then
+	repo   bool
+	branch string
+	dirty  bool
+	// upstream is set when the branch has an upstream to compare with
+	upstream      bool
+	ahead, behind int
+	err           error
+}
+
+// readGitStates reads the git state of every replace's checkout, running
+// the git commands for several checkouts at once since with many replaces
+// doing them one after another is slow. The states are in the same order as
+// the replaces.
+func readGitStates(replaces []replace, details bool) []gitState {
+	states := make([]gitState, len(replaces))
+
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < gitWorkers && w < len(replaces); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				states[i] = readGitState(replaces[i], details)
+			}
+		}()
+	}
+
+	for i := range replaces {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	return states
+}
+
+// readGitState reads the state of r's checkout, the branch and how far it
+// is from its upstream are only read with details
+func readGitState(r replace, details bool) gitState {
+	var state gitState
+	if r.isRemote() || r.isWildcard() || !isGitRepo(r.AbsPath) {
+		return state
+	}
+	state.repo = true
+
+	if state.dirty, state.err = gitDirty(r.AbsPath, r.AddGoMod); state.err != nil || !details {
+		return state
+	}
+
+	if state.branch, state.err = gitOutput(r.AbsPath, "rev-parse", "--abbrev-ref", "HEAD"); state.err != nil {
+		return state
+	}
+
+	// Without an upstream there's nothing to be ahead or behind of
+	counts, err := gitOutput(r.AbsPath, "rev-list", "--left-right", "--count", "@{upstream}...HEAD")
+	if err != nil {
+		return state
+	}
+	fields := strings.Fields(counts)
+	if len(fields) != 2 {
+		state.err = fmt.Errorf("unexpected git rev-list output: %s", counts)
+		return state
+	}
+	if state.behind, state.err = strconv.Atoi(fields[0]); state.err != nil {
+		return state
+	}
+	if state.ahead, state.err = strconv.Atoi(fields[1]); state.err != nil {
+		return state
+	}
+	state.upstream = true
+
+	return state
+}
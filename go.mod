@@ -3,7 +3,11 @@ module github.com/aarondl/gomr
 go 1.13
 
 require (
-	github.com/hashicorp/hcl v1.0.0
+	github.com/BurntSushi/toml v0.3.1
+	github.com/fsnotify/fsnotify v1.4.9
+	github.com/gdamore/tcell v1.4.0
 	github.com/pkg/errors v0.8.1
-	github.com/spf13/cobra v0.0.5
+	github.com/spf13/cobra v1.1.3
+	github.com/spf13/pflag v1.0.5
+	golang.org/x/mod v0.4.2
 )
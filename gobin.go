@@ -0,0 +1,21 @@
+package main
+
+import (
+	"os"
+)
+
+// goBinary is set by the --go flag
+var goBinary string
+
+// goCommand returns the go binary gomr runs: the one given with --go, then
+// GOMR_GO, and otherwise go from PATH. Having a choice helps when go
+// toolchains of different versions are installed side by side.
+func goCommand() string {
+	if len(goBinary) != 0 {
+		return goBinary
+	}
+	if env := os.Getenv("GOMR_GO"); len(env) != 0 {
+		return env
+	}
+	return "go"
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// goModule is a module path and version pair as output by go mod edit -json
+type goModule struct {
+	Path    string
+	Version string
+}
+
+// goModRequire is a require line as output by go mod edit -json
+type goModRequire struct {
+	Path     string
+	Version  string
+	Indirect bool
+}
+
+// goModReplace is a replace line as output by go mod edit -json
+type goModReplace struct {
+	Old goModule
+	New goModule
+}
+
+// goModFile is the subset of the go mod edit -json output that we use
+type goModFile struct {
+	Module  goModule
+	Require []goModRequire
+	Replace []goModReplace
+}
+
+// readGoMod parses the go.mod in dir using go mod edit -json
+func readGoMod(dir string) (goModFile, error) {
+	var mod goModFile
+
+	b, err := gomodOutput(dir, "edit", "-json")
+	if err != nil {
+		return mod, errors.Wrapf(err, "failed to read go.mod in dir: %s", dir)
+	}
+
+	if err = json.Unmarshal(b, &mod); err != nil {
+		return mod, errors.Wrapf(err, "failed to parse go.mod in dir: %s", dir)
+	}
+
+	return mod, nil
+}
+
+// readModulePath returns the module path declared by the go.mod in dir
+func readModulePath(dir string) (string, error) {
+	if _, err := os.Stat(filepath.Join(dir, "go.mod")); os.IsNotExist(err) {
+		return "", errors.Errorf("%s has no go.mod to read the module path from", dir)
+	} else if err != nil {
+		return "", err
+	}
+
+	mod, err := parseGoMod(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(mod.Module.Path) == 0 {
+		return "", errors.Errorf("go.mod in %s has no module line", dir)
+	}
+
+	return mod.Module.Path, nil
+}
+
+// isLocalPath checks if the right hand side of a replace is a filesystem
+// path rather than a module path, using the same rules as the go tool.
+func isLocalPath(path string) bool {
+	return strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../") ||
+		path == "." || path == ".." || filepath.IsAbs(path) ||
+		strings.HasPrefix(path, `.\`) || strings.HasPrefix(path, `..\`)
+}
+
+// replacedModule returns the unversioned replace for modulePath in mod
+func (g goModFile) replacedModule(modulePath string) (goModReplace, bool) {
+	for _, rep := range g.Replace {
+		if len(rep.Old.Version) == 0 && strings.ToLower(rep.Old.Path) == strings.ToLower(modulePath) {
+			return rep, true
+		}
+	}
+
+	return goModReplace{}, false
+}
+
+// requiredVersion returns the version of modulePath that mod requires, or an
+// empty string if it's not required.
+func (g goModFile) requiredVersion(modulePath string) string {
+	for _, req := range g.Require {
+		if strings.ToLower(req.Path) == strings.ToLower(modulePath) {
+			return req.Version
+		}
+	}
+
+	return ""
+}
+
+// appliedReplaces returns the replaces that currently have a replace line in
+// mod, with wildcards expanded.
+func appliedReplaces(mod goModFile, replaces []replace) []replace {
+	var applied []replace
+	for _, r := range expandWildcards(mod, replaces) {
+		if _, ok := mod.replacedModule(r.ModuleName); ok {
+			applied = append(applied, r)
+		}
+	}
+
+	return applied
+}
+
+// unappliedReplaces returns the replaces that have no replace line in mod,
+// with wildcards expanded.
+func unappliedReplaces(mod goModFile, replaces []replace) []replace {
+	var missing []replace
+	for _, r := range expandWildcards(mod, replaces) {
+		if _, ok := mod.replacedModule(r.ModuleName); !ok {
+			missing = append(missing, r)
+		}
+	}
+
+	return missing
+}
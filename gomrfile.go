@@ -0,0 +1,666 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+const (
+	// gomrFileVersion is the version of the gomr file format that is written
+	gomrFileVersion = 2
+	// gomrFileHeader is written at the top of every gomr file
+	gomrFileHeader = "# Replaces managed by gomr (https://github.com/aarondl/gomr)\n"
+	// gomrLocalSuffix is appended to the gomr file's name to get the name of
+	// the personal (usually gitignored) file whose replaces override the
+	// shared ones.
+	gomrLocalSuffix = ".local"
+)
+
+type replace struct {
+	ModuleName string `toml:"module"`
+	AbsPath    string `toml:"path"`
+	// Target is a module@version to replace the module with instead of a
+	// local directory
+	Target   string `toml:"target"`
+	AddGoMod bool   `toml:"stub"`
+	// Disabled replaces are kept in the file but skipped by up and down
+	Disabled bool `toml:"disabled"`
+	// Fork is the url of the fork the local checkout was cloned from
+	Fork string `toml:"fork"`
+	// Ref is the branch or commit that was checked out in the local
+	// checkout when the replace was added
+	Ref string `toml:"ref"`
+	// Profiles are the named groups this replace belongs to
+	Profiles []string `toml:"profiles"`
+	// Modules are the directories, relative to the module the gomr file is
+	// for, of the modules whose go.mod the replace goes in. "." is that
+	// module itself, which is the only one when there are none.
+	Modules []string `toml:"modules"`
+	// Require is the version of the module that go.mod required before the
+	// replace was installed, it's restored when the replace is removed.
+	Require string `toml:"require"`
+	// Note is a free form description of why the replace exists
+	Note string `toml:"note"`
+	// Added is when the replace was added
+	Added time.Time `toml:"added"`
+	// Comments are the comment lines in the file that belong to the replace
+	Comments []string `toml:"-"`
+
+	// mapped is set when the file has no path for the replace and AbsPath
+	// was found using the user's path mappings instead.
+	mapped bool
+	// local is set when the replace is stored in the personal local file
+	// rather than the shared gomr file.
+	local bool
+	// relative is set when the path is stored relative to the directory the
+	// gomr file is in, AbsPath is always the resolved absolute path.
+	relative bool
+}
+
+// gomrFile is the structure of a version 2 gomr file
+type gomrFile struct {
+	Version  int       `toml:"version"`
+	Replaces []replace `toml:"replace"`
+	// Preamble is the comment lines at the top of the file
+	Preamble []string `toml:"-"`
+}
+
+// isRemote checks if the replace points at another module rather than a
+// local directory
+func (r replace) isRemote() bool {
+	return len(r.Target) != 0
+}
+
+// replacement is the right hand side of the replace in go.mod
+func (r replace) replacement() string {
+	if r.isRemote() {
+		return r.Target
+	}
+	return r.AbsPath
+}
+
+// inProfile checks if the replace is a member of the named profile
+func (r replace) inProfile(profile string) bool {
+	for _, p := range r.Profiles {
+		if strings.ToLower(p) == strings.ToLower(profile) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// filterProfile returns only the replaces that belong to profile, an empty
+// profile returns all the replaces.
+func filterProfile(replaces []replace, profile string) []replace {
+	if len(profile) == 0 {
+		return replaces
+	}
+
+	var filtered []replace
+	for _, r := range replaces {
+		if r.inProfile(profile) {
+			filtered = append(filtered, r)
+		}
+	}
+
+	return filtered
+}
+
+// enabledReplaces returns the replaces that haven't been disabled
+func enabledReplaces(replaces []replace) []replace {
+	var enabled []replace
+	for _, r := range replaces {
+		if !r.Disabled {
+			enabled = append(enabled, r)
+		}
+	}
+
+	return enabled
+}
+
+// findReplace returns the index of the replace for moduleName or -1
+func findReplace(replaces []replace, moduleName string) int {
+	for i, r := range replaces {
+		if strings.ToLower(r.ModuleName) == strings.ToLower(moduleName) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// readGomrFile reads the gomr file at path along with the local file next to
+// it, replaces in the local file override those for the same module in the
+// shared one. The error satisfies os.IsNotExist only if neither exist.
+func readGomrFile(path string) ([]replace, error) {
+	shared, sharedErr := readReplacesFile(path)
+	if sharedErr != nil && !os.IsNotExist(sharedErr) {
+		return nil, sharedErr
+	}
+
+	local, localErr := readReplacesFile(path + gomrLocalSuffix)
+	if localErr != nil && !os.IsNotExist(localErr) {
+		return nil, localErr
+	}
+
+	if sharedErr != nil && localErr != nil {
+		return nil, sharedErr
+	}
+
+	replaces := shared
+	for _, r := range local {
+		r.local = true
+		if i := findReplace(replaces, r.ModuleName); i >= 0 {
+			replaces[i] = r
+		} else {
+			replaces = append(replaces, r)
+		}
+	}
+
+	if err := resolveMappedPaths(replaces); err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", path)
+	}
+
+	return replaces, nil
+}
+
+// readReplacesFile reads a single gomr file in either the current or the
+// legacy format.
+func readReplacesFile(path string) ([]replace, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := parseGomrFile(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", path)
+	}
+
+	resolveRelativePaths(file.Replaces, filepath.Dir(path))
+	return file.Replaces, nil
+}
+
+// resolveRelativePaths makes the relative paths of the replaces absolute
+// using dir, the directory of the gomr file they were read from.
+func resolveRelativePaths(replaces []replace, dir string) {
+	for i, r := range replaces {
+		if len(r.AbsPath) == 0 || r.isRemote() || filepath.IsAbs(r.AbsPath) {
+			continue
+		}
+
+		replaces[i].AbsPath = filepath.Join(dir, filepath.FromSlash(r.AbsPath))
+		replaces[i].relative = true
+	}
+}
+
+// sortReplaces orders the replaces by module path so the file is the same
+// however they were added, which keeps diffs of it small. When a module has
+// more than one replace only the first is kept, it's the one findReplace
+// finds.
+func sortReplaces(replaces []replace) []replace {
+	sorted := make([]replace, len(replaces))
+	copy(sorted, replaces)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return strings.ToLower(sorted[i].ModuleName) < strings.ToLower(sorted[j].ModuleName)
+	})
+
+	merged := sorted[:0]
+	for _, r := range sorted {
+		if n := len(merged); n != 0 && strings.ToLower(merged[n-1].ModuleName) == strings.ToLower(r.ModuleName) {
+			warnf("dropping duplicate replace: %s => %s", r.ModuleName, r.replacement())
+			continue
+		}
+		merged = append(merged, r)
+	}
+
+	return merged
+}
+
+// storedPaths returns the replaces with the paths that are kept relative
+// made relative to dir again, with forward slashes so the file works on
+// every OS.
+func storedPaths(replaces []replace, dir string) []replace {
+	stored := make([]replace, len(replaces))
+	for i, r := range replaces {
+		stored[i] = r
+		if !r.relative {
+			continue
+		}
+
+		if rel, err := filepath.Rel(dir, r.AbsPath); err == nil {
+			stored[i].AbsPath = filepath.ToSlash(rel)
+		}
+	}
+	return stored
+}
+
+// resolveMappedPaths fills in the path of replaces that don't have one stored
+// using the user's path mappings.
+func resolveMappedPaths(replaces []replace) error {
+	var mappings map[string]string
+	for i, r := range replaces {
+		if len(r.AbsPath) != 0 || r.isRemote() {
+			continue
+		}
+
+		if mappings == nil {
+			var err error
+			if mappings, err = readPathMappings(); err != nil {
+				return err
+			}
+		}
+
+		absPath, ok := mapModulePath(mappings, r.ModuleName)
+		if !ok {
+			return fmt.Errorf("no path stored for %s and no mapping for it in %s", r.ModuleName, pathsFilename)
+		}
+
+		replaces[i].AbsPath = absPath
+		replaces[i].mapped = true
+	}
+
+	return nil
+}
+
+// parseGomrFile parses the contents of a gomr file. Files from before the
+// format was versioned are reported as version 1.
+func parseGomrFile(b []byte) (gomrFile, error) {
+	var file gomrFile
+	md, err := toml.Decode(string(b), &file)
+	if err != nil {
+		if isTOMLGomrFile(b) {
+			return file, err
+		}
+
+		file.Version = 1
+		file.Replaces, err = parseLegacyGomrFile(b)
+		if err != nil {
+			return file, err
+		}
+	} else {
+		if file.Version > gomrFileVersion {
+			return file, fmt.Errorf("file is version %d but this gomr only understands up to version %d, upgrade gomr", file.Version, gomrFileVersion)
+		}
+
+		if undecoded := md.Undecoded(); len(undecoded) != 0 {
+			return file, fmt.Errorf("unknown key %q", undecoded[0].String())
+		}
+
+		for i, r := range file.Replaces {
+			if len(r.ModuleName) == 0 {
+				return file, fmt.Errorf("replace %d is missing its module", i+1)
+			}
+		}
+
+		file.Version = gomrFileVersion
+	}
+
+	var entries [][]string
+	file.Preamble, entries = scanComments(b, file.Version)
+	for i := range file.Replaces {
+		if i < len(entries) {
+			file.Replaces[i].Comments = entries[i]
+		}
+	}
+
+	return file, nil
+}
+
+// scanComments finds the comment lines in a gomr file. Comments at the top of
+// the file that are separated from the first replace by a blank line are the
+// preamble. Other comments belong to the replace that follows them, or to the
+// replace they're inside of when followed by more of its keys.
+func scanComments(b []byte, version int) (preamble []string, entries [][]string) {
+	var pending []string
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		if len(entries) == 0 {
+			preamble = append(preamble, pending...)
+		} else {
+			entries[len(entries)-1] = append(entries[len(entries)-1], pending...)
+		}
+		pending = nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "#"):
+			if line != strings.TrimSpace(gomrFileHeader) {
+				pending = append(pending, line)
+			}
+		case len(line) == 0:
+			if len(entries) == 0 {
+				flush()
+			}
+		case version == 1 || strings.HasPrefix(line, "[[replace]]"):
+			entries = append(entries, pending)
+			pending = nil
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return preamble, entries
+}
+
+// splitFields splits line on whitespace like strings.Fields, except inside
+// double quotes so that paths like "C:\Users\My Name\src" can be given.
+// The quotes can be anywhere in a field and are removed. There are no escapes
+// so backslashes in Windows paths are kept as they are.
+func splitFields(line string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	inField, quoted := false, false
+
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inField = true
+		case !quoted && unicode.IsSpace(r):
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteRune(r)
+			inField = true
+		}
+	}
+
+	if quoted {
+		return nil, errors.New("unterminated quote")
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+
+	return fields, nil
+}
+
+// isTOMLGomrFile checks if b looks like a version 2 file, so that syntax
+// errors in it aren't reported as errors in the legacy format.
+func isTOMLGomrFile(b []byte) bool {
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "version") || strings.HasPrefix(line, "[") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseLegacyGomrFile parses the version 1 format that has one replace per
+// line: module [!]path [profile,...] [key=value...]
+// The ! signifies that gomr created the go.mod in path. Fields with spaces
+// in them are double quoted, see splitFields.
+func parseLegacyGomrFile(b []byte) ([]replace, error) {
+	var replaces []replace
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		var r replace
+
+		if strings.HasPrefix(strings.TrimSpace(scanner.Text()), "#") {
+			continue
+		}
+		splits, err := splitFields(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("malformed line: %q: %v", scanner.Text(), err)
+		}
+		if len(splits) == 0 {
+			continue
+		}
+		if len(splits) < 2 {
+			return nil, fmt.Errorf("malformed line: %q", scanner.Text())
+		}
+
+		r.ModuleName = splits[0]
+		if strings.HasPrefix(splits[1], "!") {
+			r.AbsPath = splits[1][1:]
+			r.AddGoMod = true
+		} else {
+			r.AbsPath = splits[1]
+		}
+
+		for _, field := range splits[2:] {
+			eq := strings.IndexByte(field, '=')
+			if eq < 0 {
+				r.Profiles = strings.Split(field, ",")
+				continue
+			}
+
+			switch key, value := field[:eq], field[eq+1:]; key {
+			case "require":
+				r.Require = value
+			default:
+				return nil, fmt.Errorf("unknown attribute %q", key)
+			}
+		}
+
+		replaces = append(replaces, r)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return replaces, nil
+}
+
+// formatGomrFile creates the contents of a gomr file in the current format.
+// The encoding is done by hand so keys are always in the same order and
+// comments can be kept.
+func formatGomrFile(file gomrFile) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString(gomrFileHeader)
+	for _, c := range file.Preamble {
+		buf.WriteString(c + "\n")
+	}
+	if len(file.Preamble) != 0 {
+		buf.WriteString("\n")
+	}
+	fmt.Fprintf(&buf, "version = %d\n", gomrFileVersion)
+
+	for _, r := range file.Replaces {
+		buf.WriteString("\n")
+		formatReplace(&buf, r)
+	}
+
+	return buf.Bytes()
+}
+
+// formatReplace writes the [[replace]] table for r, after its comments
+func formatReplace(buf *bytes.Buffer, r replace) {
+	for _, c := range r.Comments {
+		buf.WriteString(c + "\n")
+	}
+	buf.WriteString("[[replace]]\n")
+	fmt.Fprintf(buf, "module = %s\n", tomlString(r.ModuleName))
+	if r.isRemote() {
+		fmt.Fprintf(buf, "target = %s\n", tomlString(r.Target))
+	} else if !r.mapped {
+		fmt.Fprintf(buf, "path = %s\n", tomlString(r.AbsPath))
+	}
+	if r.AddGoMod {
+		buf.WriteString("stub = true\n")
+	}
+	if r.Disabled {
+		buf.WriteString("disabled = true\n")
+	}
+	if len(r.Fork) != 0 {
+		fmt.Fprintf(buf, "fork = %s\n", tomlString(r.Fork))
+	}
+	if len(r.Ref) != 0 {
+		fmt.Fprintf(buf, "ref = %s\n", tomlString(r.Ref))
+	}
+	if len(r.Profiles) != 0 {
+		fmt.Fprintf(buf, "profiles = %s\n", tomlStrings(r.Profiles))
+	}
+	if len(r.Modules) != 0 {
+		fmt.Fprintf(buf, "modules = %s\n", tomlStrings(r.Modules))
+	}
+	if len(r.Require) != 0 {
+		fmt.Fprintf(buf, "require = %s\n", tomlString(r.Require))
+	}
+	if len(r.Note) != 0 {
+		fmt.Fprintf(buf, "note = %s\n", tomlString(r.Note))
+	}
+	if !r.Added.IsZero() {
+		fmt.Fprintf(buf, "added = %s\n", r.Added.UTC().Format(time.RFC3339))
+	}
+}
+
+// writeGomrFile stores replaces in the gomr file at path and the local file
+// next to it, depending on which file each replace came from. Replaces in the
+// shared file that were hidden by a local override are kept.
+func writeGomrFile(path string, replaces []replace) error {
+	localPath := path + gomrLocalSuffix
+
+	var shared, local []replace
+	for _, r := range replaces {
+		if r.local {
+			local = append(local, r)
+		} else {
+			shared = append(shared, r)
+		}
+	}
+
+	oldShared, err := readReplacesFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	oldLocal, err := readReplacesFile(localPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	for _, r := range oldShared {
+		if findReplace(oldLocal, r.ModuleName) >= 0 && findReplace(shared, r.ModuleName) < 0 {
+			shared = append(shared, r)
+		}
+	}
+
+	if err = writeReplacesFile(path, shared); err != nil {
+		return err
+	}
+
+	if len(local) == 0 && len(oldLocal) == 0 {
+		return nil
+	}
+
+	return writeReplacesFile(localPath, local)
+}
+
+// writeReplacesFile replaces a single gomr file atomically by writing to a
+// temporary file next to it and renaming it into place. Comments at the top
+// of the existing file are kept.
+func writeReplacesFile(path string, replaces []replace) error {
+	file := gomrFile{Replaces: sortReplaces(storedPaths(replaces, filepath.Dir(path)))}
+	if b, err := ioutil.ReadFile(path); err == nil {
+		if existing, err := parseGomrFile(b); err == nil {
+			file.Preamble = existing.Preamble
+		}
+	}
+
+	if dryRun {
+		infof("would write: %s", path)
+		return nil
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), gomrFilename+".tmp")
+	if err != nil {
+		return errors.Wrapf(err, "failed to open %s file for writing", gomrFilename)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err = f.Write(formatGomrFile(file)); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "failed to write to %s", gomrFilename)
+	}
+
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "failed to sync %s file write", gomrFilename)
+	}
+
+	if err = f.Close(); err != nil {
+		return errors.Wrapf(err, "failed to close %s file write", gomrFilename)
+	}
+
+	if err = os.Chmod(f.Name(), 0664); err != nil {
+		return errors.Wrapf(err, "failed to set %s file permissions", gomrFilename)
+	}
+
+	if err = os.Rename(f.Name(), path); err != nil {
+		return errors.Wrapf(err, "failed to replace %s file", gomrFilename)
+	}
+
+	return nil
+}
+
+// tomlString quotes s as a TOML basic string
+func tomlString(s string) string {
+	var buf strings.Builder
+	buf.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\r':
+			buf.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f || r == utf8.RuneError {
+				fmt.Fprintf(&buf, `\u%04X`, r)
+			} else {
+				buf.WriteRune(r)
+			}
+		}
+	}
+	buf.WriteByte('"')
+
+	return buf.String()
+}
+
+// tomlStrings formats ss as a TOML array of strings
+func tomlStrings(ss []string) string {
+	quoted := make([]string, len(ss))
+	for i, s := range ss {
+		quoted[i] = tomlString(s)
+	}
+
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
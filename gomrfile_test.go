@@ -0,0 +1,144 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+func TestTomlString(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "example.com/lib", `"example.com/lib"`},
+		{"empty", "", `""`},
+		{"quote", `say "hi"`, `"say \"hi\""`},
+		{"backslash", `C:\src\lib`, `"C:\\src\\lib"`},
+		{"whitespace", "a\tb\nc\rd", `"a\tb\nc\rd"`},
+		{"backspace and form feed", "a\bb\fc", `"a\bb\fc"`},
+		{"control", "a\x01b\x7fc", `"a\u0001b\u007Fc"`},
+		{"unicode", "ünïcode/日本", `"ünïcode/日本"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := tomlString(test.in)
+			if got != test.want {
+				t.Fatalf("tomlString(%q) = %s, want %s", test.in, got, test.want)
+			}
+
+			var decoded struct{ S string }
+			if _, err := toml.Decode("s = "+got, &decoded); err != nil {
+				t.Fatalf("%s isn't valid TOML: %v", got, err)
+			}
+			if decoded.S != test.in {
+				t.Fatalf("%s decodes to %q, want %q", got, decoded.S, test.in)
+			}
+		})
+	}
+}
+
+func TestGomrFileRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		version int
+		want    []replace
+	}{
+		{
+			name:    "legacy",
+			in:      "example.com/lib /src/lib\nexample.com/stub !/src/stub backend,frontend require=v1.2.3\n",
+			version: 1,
+			want: []replace{
+				{ModuleName: "example.com/lib", AbsPath: "/src/lib"},
+				{ModuleName: "example.com/stub", AbsPath: "/src/stub", AddGoMod: true, Profiles: []string{"backend", "frontend"}, Require: "v1.2.3"},
+			},
+		},
+		{
+			name:    "legacy quoted path and comments",
+			in:      "# top\n\n# about lib\nexample.com/lib \"/my src/lib\"\n",
+			version: 1,
+			want: []replace{
+				{ModuleName: "example.com/lib", AbsPath: "/my src/lib", Comments: []string{"# about lib"}},
+			},
+		},
+		{
+			name: "v2",
+			in: `version = 2
+
+[[replace]]
+module = "example.com/lib"
+path = "/src/lib"
+stub = true
+profiles = ["backend"]
+modules = [".", "tools"]
+note = "needs \"the\" fix"
+
+# remote
+[[replace]]
+module = "example.com/remote"
+target = "example.com/fork@v1.0.0"
+disabled = true
+`,
+			version: 2,
+			want: []replace{
+				{ModuleName: "example.com/lib", AbsPath: "/src/lib", AddGoMod: true, Profiles: []string{"backend"}, Modules: []string{".", "tools"}, Note: `needs "the" fix`},
+				{ModuleName: "example.com/remote", Target: "example.com/fork@v1.0.0", Disabled: true, Comments: []string{"# remote"}},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file, err := parseGomrFile([]byte(test.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if file.Version != test.version {
+				t.Errorf("version = %d, want %d", file.Version, test.version)
+			}
+			checkReplaces(t, "parsed", file.Replaces, test.want)
+
+			formatted := formatGomrFile(file)
+			again, err := parseGomrFile(formatted)
+			if err != nil {
+				t.Fatalf("failed to parse the formatted file: %v\n%s", err, formatted)
+			}
+			if again.Version != gomrFileVersion {
+				t.Errorf("formatted version = %d, want %d", again.Version, gomrFileVersion)
+			}
+			checkReplaces(t, "formatted", again.Replaces, test.want)
+			if !reflect.DeepEqual(again.Preamble, file.Preamble) {
+				t.Errorf("preamble = %q, want %q", again.Preamble, file.Preamble)
+			}
+
+			if twice := formatGomrFile(again); string(twice) != string(formatted) {
+				t.Errorf("formatting isn't stable:\n%s\nthen:\n%s", formatted, twice)
+			}
+		})
+	}
+}
+
+// checkReplaces compares the stored fields of replaces
+func checkReplaces(t *testing.T, what string, got, want []replace) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("%s has %d replaces, want %d: %+v", what, len(got), len(want), got)
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		// Empty and nil lists are stored the same way
+		for _, lists := range [][2]*[]string{{&g.Profiles, &w.Profiles}, {&g.Modules, &w.Modules}, {&g.Comments, &w.Comments}} {
+			if len(*lists[0]) == 0 && len(*lists[1]) == 0 {
+				*lists[0], *lists[1] = nil, nil
+			}
+		}
+		if !reflect.DeepEqual(g, w) {
+			t.Errorf("%s replace %d = %+v, want %+v", what, i, g, w)
+		}
+	}
+}
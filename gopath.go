@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// gopathEntries caches the result of gopaths
+var gopathEntries []string
+
+// gopaths returns the entries of GOPATH as go itself sees them. go env
+// knows about the default of ~/go and the go env config file, so it's used
+// instead of reading the environment variable.
+func gopaths() ([]string, error) {
+	if gopathEntries != nil {
+		return gopathEntries, nil
+	}
+
+	out, err := exec.Command(goCommand(), "env", "GOPATH").Output()
+	if err != nil {
+		debugf("go env GOPATH failed, using the GOPATH variable: %v", err)
+		out = []byte(os.Getenv("GOPATH"))
+	}
+
+	var entries []string
+	for _, entry := range filepath.SplitList(strings.TrimSpace(string(out))) {
+		if len(entry) != 0 {
+			entries = append(entries, entry)
+		}
+	}
+
+	if len(entries) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to find the default GOPATH")
+		}
+		entries = []string{filepath.Join(home, "go")}
+	}
+
+	gopathEntries = entries
+	return entries, nil
+}
+
+// gopathSource returns the directory under GOPATH/src that holds
+// importPath. Each GOPATH entry is searched in order and the first one that
+// has it wins, if none do it's where it would be in the first entry.
+func gopathSource(importPath string) (string, error) {
+	entries, err := gopaths()
+	if err != nil {
+		return "", err
+	}
+
+	for _, entry := range entries {
+		dir := filepath.Join(entry, "src", filepath.FromSlash(importPath))
+		if _, err := os.Stat(dir); err == nil {
+			return dir, nil
+		}
+	}
+
+	return filepath.Join(entries[0], "src", filepath.FromSlash(importPath)), nil
+}
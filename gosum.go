@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// gomrDirname is the directory next to the gomr file where gomr keeps
+	// state that isn't part of the gomr file itself.
+	gomrDirname = ".gomr.d"
+	// goSumBackupFilename is the name of the go.sum backup inside gomrDirname
+	goSumBackupFilename = "go.sum"
+)
+
+// backupGoSum saves a copy of go.sum before the first replace is installed so
+// that restoreGoSum can return it to its pre-gomr state. An existing backup
+// is never overwritten since go.sum may already have been changed by builds.
+func backupGoSum(modRoot string) error {
+	applied, err := anyApplied(modRoot)
+	if err != nil || applied {
+		return err
+	}
+
+	dir, err := stateDir(modRoot)
+	if err != nil {
+		return err
+	}
+
+	backupPath := filepath.Join(dir, goSumBackupFilename)
+	if _, err := os.Stat(backupPath); err == nil {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(modRoot, "go.sum"))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "failed to read go.sum")
+	}
+
+	if err = writeFile(backupPath, b, 0664); err != nil {
+		return errors.Wrap(err, "failed to back up go.sum")
+	}
+
+	return nil
+}
+
+// restoreGoSum puts back the go.sum saved by backupGoSum once there are no
+// more replaces installed.
+func restoreGoSum(modRoot string) error {
+	applied, err := anyApplied(modRoot)
+	if err != nil || applied {
+		return err
+	}
+
+	dir, err := stateDir(modRoot)
+	if err != nil {
+		return err
+	}
+
+	backupPath := filepath.Join(dir, goSumBackupFilename)
+	b, err := ioutil.ReadFile(backupPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "failed to read go.sum backup")
+	}
+
+	if err = writeFile(filepath.Join(modRoot, "go.sum"), b, 0664); err != nil {
+		return errors.Wrap(err, "failed to restore go.sum")
+	}
+
+	if err = removeFile(backupPath); err != nil {
+		return errors.Wrap(err, "failed to remove go.sum backup")
+	}
+
+	return nil
+}
+
+// anyApplied checks if go.mod contains any of the replaces in the gomr file
+func anyApplied(modRoot string) (bool, error) {
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return false, err
+	}
+
+	replaces, err := readGomrFile(gomrFilePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		return false, err
+	}
+
+	return len(appliedReplaces(mod, replaces)) != 0, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/spf13/cobra"
+)
+
+var testCmd = &cobra.Command{
+	Use:   "test [flags] [-- go test flags...]",
+	Short: "Run go test in every replaced module and then in this one with the replaces applied",
+	Long: `Run go test in every replaced module and then in this one with the replaces applied.
+
+go test ./... is run in the directory of each replaced module, several at a
+time, and then in the current module with the stored replaces applied the
+same way exec applies them, including the go.mod files generated for
+replaced modules that don't have one. Arguments after -- are passed to go
+test. Fails if the tests fail anywhere.`,
+	RunE:         testRun,
+	SilenceUsage: true,
+}
+
+func testRun(cmd *cobra.Command, args []string) error {
+	jobs, err := cmd.Flags().GetInt("jobs")
+	if err != nil {
+		return err
+	}
+
+	modRoot, replaces, err := loadReplaces(cmd)
+	if err != nil {
+		return err
+	}
+
+	testArgs := append([]string{"test"}, args...)
+	testArgs = append(testArgs, "./...")
+
+	checkouts, err := replacedCheckouts(modRoot, replaces, false)
+	if err != nil {
+		return err
+	}
+
+	// Everything runs with the replaces applied so the replaced modules
+	// without their own go.mod have one generated for them
+	var results []checkoutResult
+	failed := 0
+	rootErr := withReplaces(modRoot, replaces, func() error {
+		results = runInCheckouts(checkouts, jobs, func(c checkout) *exec.Cmd {
+			return exec.Command(goCommand(), testArgs...)
+		})
+		failed = reportCheckoutResults(results, true)
+
+		// The current module's tests are the point of the exercise so their
+		// output is shown as it happens
+		infof("testing %s with the replaces applied", modRoot)
+		c := exec.Command(goCommand(), testArgs...)
+		c.Dir = modRoot
+		c.Stdout = os.Stdout
+		c.Stderr = os.Stderr
+		return c.Run()
+	})
+
+	outputf("")
+	for _, r := range results {
+		outputf("%s %s", testResult(r.err), r.module)
+	}
+	outputf("%s %s", testResult(rootErr), modRoot)
+
+	if _, ok := rootErr.(*exec.ExitError); rootErr != nil && !ok {
+		return rootErr
+	}
+	if rootErr != nil {
+		failed++
+	}
+	if failed != 0 {
+		return fmt.Errorf("tests failed in %d of %d module(s)", failed, len(results)+1)
+	}
+
+	return nil
+}
+
+// testResult is the summary line prefix for a module's test run
+func testResult(err error) string {
+	if err != nil {
+		return colorize(colorRed, "FAIL")
+	}
+	return colorize(colorGreen, "ok  ")
+}
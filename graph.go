@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var graphCmd = &cobra.Command{
+	Use:   "graph [flags]",
+	Short: "Show the module graph with the modules replaced by gomr highlighted",
+	Long: `Show the module graph with the modules replaced by gomr highlighted
+
+Prints the edges from go mod graph, marking every module that go.mod
+currently replaces with a stored replace. --replaced only shows the edges
+to and from replaced modules and --dot prints the graph in Graphviz format.`,
+	RunE:         graphRun,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+}
+
+// graphEdge is a requirement in the module graph, from and to are
+// module@version except for the main module which has no version
+type graphEdge struct {
+	from, to string
+}
+
+func graphRun(cmd *cobra.Command, args []string) error {
+	dot, err := cmd.Flags().GetBool("dot")
+	if err != nil {
+		return err
+	}
+	replacedOnly, err := cmd.Flags().GetBool("replaced")
+	if err != nil {
+		return err
+	}
+
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return err
+	}
+	stored, err := readGomrFile(gomrFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		return err
+	}
+
+	// The modules replaced right now and what with
+	replaced := make(map[string]string)
+	for _, r := range appliedReplaces(mod, stored) {
+		replaced[strings.ToLower(r.ModuleName)] = r.replacement()
+	}
+
+	edges, err := readModuleGraph(modRoot)
+	if err != nil {
+		return err
+	}
+
+	isReplaced := func(node string) (string, bool) {
+		target, ok := replaced[strings.ToLower(nodeModule(node))]
+		return target, ok
+	}
+
+	var shown []graphEdge
+	for _, e := range edges {
+		_, fromReplaced := isReplaced(e.from)
+		_, toReplaced := isReplaced(e.to)
+		if !replacedOnly || fromReplaced || toReplaced {
+			shown = append(shown, e)
+		}
+	}
+
+	if dot {
+		outputf("%s", dotGraph(shown, isReplaced))
+		return nil
+	}
+
+	label := func(node string) string {
+		if target, ok := isReplaced(node); ok {
+			return colorize(colorGreen, node+" (=> "+target+")")
+		}
+		return node
+	}
+	for _, e := range shown {
+		outputf("%s %s", label(e.from), label(e.to))
+	}
+
+	return nil
+}
+
+// readModuleGraph returns the edges printed by go mod graph, leaving out the
+// go and toolchain version requirements newer versions of go include
+func readModuleGraph(modRoot string) ([]graphEdge, error) {
+	out, err := gomodOutput(modRoot, "graph")
+	if err != nil {
+		return nil, err
+	}
+
+	var edges []graphEdge
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if to := nodeModule(fields[1]); to == "go" || to == "toolchain" {
+			continue
+		}
+		edges = append(edges, graphEdge{from: fields[0], to: fields[1]})
+	}
+
+	return edges, scanner.Err()
+}
+
+// nodeModule returns the module path of a module@version graph node
+func nodeModule(node string) string {
+	if i := strings.LastIndex(node, "@"); i >= 0 {
+		return node[:i]
+	}
+	return node
+}
+
+// dotGraph renders the edges in Graphviz's DOT language with the replaced
+// modules filled in and labelled with their replacement
+func dotGraph(edges []graphEdge, isReplaced func(node string) (string, bool)) string {
+	var b strings.Builder
+	b.WriteString("digraph modules {\n")
+	b.WriteString("\tnode [shape=box];\n")
+
+	nodes := make(map[string]bool)
+	for _, e := range edges {
+		fmt.Fprintf(&b, "\t%q -> %q;\n", e.from, e.to)
+		nodes[e.from] = true
+		nodes[e.to] = true
+	}
+
+	var names []string
+	for node := range nodes {
+		names = append(names, node)
+	}
+	sort.Strings(names)
+	for _, node := range names {
+		if target, ok := isReplaced(node); ok {
+			fmt.Fprintf(&b, "\t%q [style=filled, fillcolor=palegreen, label=%q];\n", node, node+"\n=> "+target)
+		}
+	}
+
+	b.WriteString("}")
+	return b.String()
+}
+
+// moduleGraph returns the path of every module in the build list of the
+// module in modRoot, as reported by go list -m all
+func moduleGraph(modRoot string) (map[string]bool, error) {
+	out, err := goOutput(modRoot, "list", "-m", "-e", "all")
+	if err != nil {
+		return nil, err
+	}
+
+	graph := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) != 0 {
+			graph[strings.ToLower(fields[0])] = true
+		}
+	}
+
+	return graph, scanner.Err()
+}
+
+// unusedReplaces returns the replaces for the main module whose module isn't
+// in its dependency graph, go accepts them but they don't do anything. If
+// the graph can't be loaded none are returned.
+func unusedReplaces(modRoot string, replaces []replace) []replace {
+	graph, err := moduleGraph(modRoot)
+	if err != nil {
+		debugf("not checking the replaces are dependencies: %v", err)
+		return nil
+	}
+
+	var unused []replace
+	for _, r := range mainReplaces(replaces) {
+		if r.isWildcard() || graph[strings.ToLower(r.ModuleName)] {
+			continue
+		}
+		unused = append(unused, r)
+	}
+
+	return unused
+}
+
+// warnUnusedReplaces warns about the replaces for the main module whose
+// module isn't in its dependency graph
+func warnUnusedReplaces(modRoot string, replaces []replace) {
+	for _, r := range unusedReplaces(modRoot, replaces) {
+		warnf("%s is not a dependency of this module, the replace won't have any effect until it is (add --require requires it)", r.ModuleName)
+	}
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"golang.org/x/mod/modfile"
+)
+
+// hookMarker is written into every hook script gomr installs so that it
+// can tell its own hooks apart from ones the user wrote.
+const hookMarker = "# installed by gomr"
+
+var hookCmd = &cobra.Command{
+	Use:   "hook <command>",
+	Short: "Manage and run the gomr git hooks",
+}
+
+var hookInstallCmd = &cobra.Command{
+	Use:   "install [flags]",
+	Short: "Install pre-commit and post-checkout git hooks",
+	Long: `Install pre-commit and post-checkout git hooks
+
+The pre-commit hook fails the commit if go.mod contains replaces that are
+managed by gomr (or runs down first with --auto-down). The post-checkout
+hook runs up after switching branches.`,
+	RunE: hookInstallRun,
+}
+
+var hookUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Remove the git hooks installed by gomr",
+	RunE:  hookUninstallRun,
+}
+
+var hookPreCommitCmd = &cobra.Command{
+	Use:   "pre-commit [flags] [go.mod...]",
+	Short: "Run the pre-commit hook",
+	Long: `Run the pre-commit hook
+
+Fails when the staged go.mod, the content that's about to be committed, has
+replace lines managed by gomr, printing a file:line line for each. With
+--auto-down gomr down is run for them instead and they're dropped from the
+staged go.mod as well, other changes to go.mod stay unstaged.
+
+Without arguments the current module is checked. The go.mod files given are
+checked instead, which is how the pre-commit framework (https://pre-commit.com)
+runs it with the hook in .pre-commit-hooks.yaml:
+
+  repos:
+    - repo: https://github.com/aarondl/gomr
+      rev: <version>
+      hooks:
+        - id: gomr`,
+	RunE:         hookPreCommitRun,
+	SilenceUsage: true,
+}
+
+var hookPostCheckoutCmd = &cobra.Command{
+	Use:   "post-checkout [prev-ref new-ref branch-flag]",
+	Short: "Run the post-checkout hook",
+	Long: `Run the post-checkout hook
+
+After a branch checkout the replaces in the default profile that go.mod is
+missing are installed the way gomr up installs them, with the up hooks and
+tidy setting from the config, and recorded for gomr undo.`,
+	RunE:         hookPostCheckoutRun,
+	SilenceUsage: true,
+}
+
+// hookNames are the git hooks gomr installs
+var hookNames = []string{"pre-commit", "post-checkout"}
+
+func hookInstallRun(cmd *cobra.Command, args []string) error {
+	autoDown, err := cmd.Flags().GetBool("auto-down")
+	if err != nil {
+		return err
+	}
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
+
+	hooksDir, err := gitHooksDir()
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(hooksDir, 0775); err != nil {
+		return errors.Wrap(err, "failed to create git hooks dir")
+	}
+
+	gomrBin, err := os.Executable()
+	if err != nil {
+		gomrBin = "gomr"
+	}
+
+	for _, name := range hookNames {
+		hookPath := filepath.Join(hooksDir, name)
+
+		if !force {
+			ours, err := isGomrHook(hookPath)
+			if err != nil {
+				return err
+			}
+			if !ours {
+				return fmt.Errorf("%s hook already exists and was not installed by gomr, use --force to overwrite it", name)
+			}
+		}
+
+		hookArgs := `"$@"`
+		if name == "pre-commit" && autoDown {
+			hookArgs = "--auto-down"
+		}
+
+		script := fmt.Sprintf("#!/bin/sh\n%s\nexec %s%s hook %s %s\n", hookMarker, shellQuote(gomrBin), storeFlag(), name, hookArgs)
+		if err = ioutil.WriteFile(hookPath, []byte(script), 0775); err != nil {
+			return errors.Wrapf(err, "failed to write %s hook", name)
+		}
+
+		infof("installed hook: %s", hookPath)
+	}
+
+	return nil
+}
+
+func hookUninstallRun(cmd *cobra.Command, args []string) error {
+	hooksDir, err := gitHooksDir()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range hookNames {
+		hookPath := filepath.Join(hooksDir, name)
+
+		b, err := ioutil.ReadFile(hookPath)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "failed to read %s hook", name)
+		}
+
+		if !bytes.Contains(b, []byte(hookMarker)) {
+			infof("leaving hook not installed by gomr: %s", hookPath)
+			continue
+		}
+
+		if err = os.Remove(hookPath); err != nil {
+			return errors.Wrapf(err, "failed to remove %s hook", name)
+		}
+
+		infof("removed hook: %s", hookPath)
+	}
+
+	return nil
+}
+
+func hookPreCommitRun(cmd *cobra.Command, args []string) error {
+	autoDown, err := cmd.Flags().GetBool("auto-down")
+	if err != nil {
+		return err
+	}
+
+	// The pre-commit framework passes the staged files matching the hook's
+	// files pattern, git passes nothing and the current module is checked
+	var goMods []string
+	for _, arg := range args {
+		if filepath.Base(arg) == "go.mod" {
+			goMods = append(goMods, arg)
+		}
+	}
+	if len(args) == 0 {
+		modRoot, err := findModuleRoot()
+		if err != nil {
+			return nil
+		}
+		goMods = append(goMods, filepath.Join(modRoot, "go.mod"))
+	}
+
+	var problems []string
+	for _, goMod := range goMods {
+		modRoot, err := filepath.Abs(filepath.Dir(goMod))
+		if err != nil {
+			return err
+		}
+
+		replaces, ok, err := moduleHookReplaces(modRoot)
+		if err != nil {
+			return err
+		} else if !ok {
+			continue
+		}
+
+		found, err := stagedReplaces(modRoot, replaces)
+		if err != nil {
+			return err
+		}
+		if len(found) == 0 {
+			continue
+		}
+
+		if !autoDown {
+			name := goMod
+			if wd, err := os.Getwd(); err == nil && filepath.IsAbs(goMod) {
+				if rel, err := filepath.Rel(wd, goMod); err == nil && !strings.HasPrefix(rel, "..") {
+					name = rel
+				}
+			}
+			for _, f := range found {
+				problems = append(problems, fmt.Sprintf("%s:%d: %s => %s is managed by gomr", name, f.line, f.r.ModuleName, f.r.replacement()))
+			}
+			continue
+		}
+
+		if err = hookDown(modRoot, found); err != nil {
+			return err
+		}
+	}
+
+	if len(problems) != 0 {
+		return errors.Errorf("commit contains replaces managed by gomr:\n%s\nrun gomr down before committing", strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// stagedReplace is a managed replace found in the staged go.mod and the line
+// it's on
+type stagedReplace struct {
+	r    replace
+	line int
+}
+
+// stagedReplaces returns the replaces with replace lines in the go.mod in
+// modRoot as it's staged for the commit, which is what gets committed even
+// when the file has changed since. A go.mod that isn't staged at all has
+// none.
+func stagedReplaces(modRoot string, replaces []replace) ([]stagedReplace, error) {
+	path := filepath.Join(modRoot, "go.mod")
+	staged, err := gitOutput(modRoot, "show", ":./go.mod")
+	if err != nil {
+		debugf("no staged go.mod in %s: %v", modRoot, err)
+		return nil, nil
+	}
+
+	f, err := modfile.Parse(path, []byte(staged), nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the staged %s", path)
+	}
+
+	var found []stagedReplace
+	for _, r := range appliedReplaces(convertModfile(f), replaces) {
+		line := 0
+		for _, rep := range f.Replace {
+			if len(rep.Old.Version) == 0 && strings.ToLower(rep.Old.Path) == strings.ToLower(r.ModuleName) && rep.Syntax != nil {
+				line = rep.Syntax.Start.Line
+			}
+		}
+		found = append(found, stagedReplace{r: r, line: line})
+	}
+
+	return found, nil
+}
+
+// hookDown runs down for the replaces found by the pre-commit hook and makes
+// the same change to the staged go.mod, so the commit has the version without
+// them. Only the staged copy is changed in the index, changes to go.mod that
+// aren't staged stay that way. go.sum is staged again only when what's staged
+// is the go.sum down put the backup back over.
+func hookDown(modRoot string, found []stagedReplace) error {
+	lock, err := lockModule(modRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	replaces := make([]replace, len(found))
+	for i, f := range found {
+		replaces[i] = f.r
+	}
+
+	staged, err := gitOutput(modRoot, "show", ":./go.mod")
+	if err != nil {
+		return err
+	}
+	sumBefore, _ := gitOutput(modRoot, "hash-object", "go.sum")
+
+	if err = downReplaces(modRoot, replaces, nil, false, false); err != nil {
+		return err
+	}
+
+	dir, err := ioutil.TempDir("", "gomr")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	goMod := filepath.Join(dir, "go.mod")
+	if err = ioutil.WriteFile(goMod, []byte(staged+"\n"), 0664); err != nil {
+		return err
+	}
+	args := append(dropReplaceFlags(replaces), requireFlags(replaces)...)
+	if err = gomod(dir, append([]string{"edit"}, args...)...); err != nil {
+		return errors.Wrap(err, "failed to remove the replace lines from the staged go.mod")
+	}
+	hash, err := gitOutput(modRoot, "hash-object", "-w", goMod)
+	if err != nil {
+		return err
+	}
+	if err = stageBlob(modRoot, "go.mod", hash); err != nil {
+		return err
+	}
+
+	sumAfter, _ := gitOutput(modRoot, "hash-object", "-w", "go.sum")
+	if len(sumBefore) != 0 && sumAfter != sumBefore {
+		if stagedSum, err := gitOutput(modRoot, "rev-parse", ":./go.sum"); err == nil && stagedSum == sumBefore {
+			if err = stageBlob(modRoot, "go.sum", sumAfter); err != nil {
+				return err
+			}
+		}
+	}
+
+	infof("gomr: removed replace lines from %s before commit", filepath.Join(modRoot, "go.mod"))
+	return nil
+}
+
+// stageBlob puts the blob hash in the index as the file name in dir without
+// touching the file itself, keeping the mode it has in the index
+func stageBlob(dir, name, hash string) error {
+	mode := "100644"
+	if entry, err := gitOutput(dir, "ls-files", "--stage", "--", name); err == nil && len(entry) != 0 {
+		mode = strings.Fields(entry)[0]
+	}
+
+	_, err := gitOutput(dir, "update-index", "--cacheinfo", mode+","+hash+","+name)
+	return err
+}
+
+func hookPostCheckoutRun(cmd *cobra.Command, args []string) error {
+	// The third argument git passes is 1 for a branch checkout and 0 for a
+	// file checkout, only branch checkouts should reinstall replaces.
+	if len(args) >= 3 && args[2] != "1" {
+		return nil
+	}
+
+	modRoot, replaces, ok, err := loadHookReplaces()
+	if err != nil || !ok {
+		return err
+	}
+
+	cfg, err := loadConfig(modRoot)
+	if err != nil {
+		return err
+	}
+	replaces = enabledReplaces(filterProfile(replaces, cfg.Profile))
+
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		return err
+	}
+
+	missing := unappliedReplaces(mod, replaces)
+	if len(missing) == 0 {
+		return nil
+	}
+
+	// This is gomr up for the replaces that are missing, with the hooks and
+	// tidy setting from the config since the hook has no flags for them
+	lock, err := lockModule(modRoot)
+	if err != nil {
+		return err
+	}
+	pre, post := cfg.Hooks.scripts("up")
+	err = runLifecycleHook(modRoot, "pre-up", pre, missing)
+	if err == nil {
+		err = upReplaces(modRoot, missing, nil, cfg.Tidy)
+	}
+	if unlockErr := lock.unlock(); err == nil {
+		err = unlockErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return runLifecycleHook(modRoot, "post-up", post, missing)
+}
+
+// loadHookReplaces loads the replaces for the current module, hooks run in
+// repositories that may not use gomr at all so a missing go.mod or gomr file
+// is reported with ok=false rather than an error.
+func loadHookReplaces() (modRoot string, replaces []replace, ok bool, err error) {
+	modRoot, err = findModuleRoot()
+	if err != nil {
+		return "", nil, false, nil
+	}
+
+	replaces, ok, err = moduleHookReplaces(modRoot)
+	if err != nil || !ok {
+		return "", nil, false, err
+	}
+
+	return modRoot, replaces, true, nil
+}
+
+// moduleHookReplaces loads the replaces for the module in modRoot like
+// loadHookReplaces, for hooks that are given the module
+func moduleHookReplaces(modRoot string) ([]replace, bool, error) {
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return nil, false, err
+	}
+
+	replaces, err := readGomrFile(gomrFilePath)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	return replaces, true, nil
+}
+
+// gitHooksDir finds the hooks directory for the current git repository,
+// respecting core.hooksPath and worktrees.
+func gitHooksDir() (string, error) {
+	dir, err := gitOutput("", "rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Abs(dir)
+}
+
+// isGomrHook checks if the hook at path is missing or was installed by gomr
+func isGomrHook(path string) (bool, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return true, nil
+	} else if err != nil {
+		return false, errors.Wrapf(err, "failed to read hook: %s", path)
+	}
+
+	return bytes.Contains(b, []byte(hookMarker)), nil
+}
+
+// shellQuote quotes s for use as a single word in a posix shell script
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var ideCmd = &cobra.Command{
+	Use:   "ide [flags]",
+	Short: "Put the module and its replaced checkouts in a go.work for gopls",
+	Long: `Put the module and its replaced checkouts in a go.work for gopls
+
+Editors using gopls only index the modules of the workspace, so going to the
+definition of something in a replaced module lands in the module cache. ide
+adds a use directive for the module and the checkout of every local replace
+to the active go.work, creating one next to go.mod if there's none, so the
+editable checkouts are indexed instead. Running it again adds the replaces
+that were stored since.
+
+go.work is meant for your machine only and shouldn't be committed.`,
+	RunE:         ideRun,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+}
+
+func ideRun(cmd *cobra.Command, args []string) error {
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	profile, err := profileFlag(cmd, modRoot)
+	if err != nil {
+		return err
+	}
+
+	lock, err := lockModule(modRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	replaces, err := readReplaces(modRoot, profile)
+	if err != nil {
+		return err
+	}
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		return err
+	}
+
+	var local []replace
+	for _, r := range expandWildcards(mod, replaces) {
+		if r.isRemote() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(r.AbsPath, "go.mod")); err != nil && !r.AddGoMod {
+			warnf("%s has no go.mod so it can't be in go.work, leaving it out", r.AbsPath)
+			continue
+		}
+		local = append(local, r)
+	}
+
+	goWork := activeGoWork(modRoot)
+	create := len(goWork) == 0
+	if create {
+		goWork = filepath.Join(modRoot, "go.work")
+	}
+
+	dirs := append([]string{modRoot}, replaceDirs(local)...)
+	if !create {
+		work, err := readGoWork(goWork)
+		if err != nil {
+			return err
+		}
+		dirs = unusedDirs(goWork, work, dirs)
+	}
+	if len(dirs) == 0 {
+		infof("%s already uses the module and all of its replaces", goWork)
+		return nil
+	}
+
+	files, err := moduleFiles(modRoot, local)
+	if err != nil {
+		return err
+	}
+	files = append(files, goWork, goWork+".sum")
+	tx, err := beginTransaction(files...)
+	if err != nil {
+		return err
+	}
+
+	err = recordOperation(modRoot, operationName("ide", local), files, func() error {
+		return tx.run(func() error {
+			if err := createStubs(modRoot, local); err != nil {
+				return err
+			}
+			if create {
+				if err := goWorkInit(modRoot); err != nil {
+					return err
+				}
+			}
+
+			flags := make([]string, 0, len(dirs))
+			for _, dir := range dirs {
+				flags = append(flags, "-use="+workDir(goWork, dir))
+			}
+			return gowork(goWork, append([]string{"edit"}, flags...)...)
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	if create {
+		infof("created %s, don't commit it", goWork)
+	}
+	for _, dir := range dirs {
+		infof("%s uses %s", goWork, dir)
+	}
+	return nil
+}
+
+// replaceDirs returns the directories of the replaces, once each
+func replaceDirs(replaces []replace) []string {
+	var dirs []string
+	seen := make(map[string]bool)
+	for _, r := range replaces {
+		dir := filepath.Clean(r.AbsPath)
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+// unusedDirs returns the dirs that the go.work at goWork doesn't have a use
+// directive for yet
+func unusedDirs(goWork string, work goWorkFile, dirs []string) []string {
+	var unused []string
+	for _, dir := range dirs {
+		used := false
+		for _, u := range work.Use {
+			usedDir := u.DiskPath
+			if !filepath.IsAbs(usedDir) {
+				usedDir = filepath.Join(filepath.Dir(goWork), usedDir)
+			}
+			if sameDir(usedDir, dir) {
+				used = true
+				break
+			}
+		}
+		if !used {
+			unused = append(unused, dir)
+		}
+	}
+	return unused
+}
+
+// workDir returns dir the way a use directive in the go.work at goWork
+// should have it, relative to go.work when it's below it
+func workDir(goWork, dir string) string {
+	rel, err := filepath.Rel(filepath.Dir(goWork), dir)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return dir
+	}
+	if rel == "." {
+		return rel
+	}
+	return "." + string(filepath.Separator) + rel
+}
+
+// goWorkInit creates an empty go.work in dir
+func goWorkInit(dir string) error {
+	if dryRun {
+		infof("would run: go work init (in %s)", dir)
+		return nil
+	}
+
+	cmd := exec.Command(goCommand(), "work", "init")
+	cmd.Dir = dir
+	debugf("running: go work init (in %s)", cmd.Dir)
+	if b, err := cmd.CombinedOutput(); err != nil {
+		return errors.Errorf("go work init failed: %s", strings.TrimSpace(string(b)))
+	}
+
+	return nil
+}
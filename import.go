@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// importMaxSize is the largest manifest import downloads, anything bigger
+// isn't a list of replaces
+const importMaxSize = 1 << 20
+
+var importCmd = &cobra.Command{
+	Use:   "import [flags] --url <url>",
+	Short: "Store the replaces from a shared manifest",
+	Long: `Store the replaces from a shared manifest
+
+Downloads a gomr file a team keeps as its canonical set of replaces and
+merges it into the gomr file. The paths in the manifest are ignored, a local
+checkout is found for each module the same way apply-template does, and the
+modules, profiles, notes, forks and targets are kept. Modules that already
+have a stored replace are left alone. Nothing is installed, run gomr up
+afterwards.
+
+It exits with 3 when some modules have no checkout, after storing the rest.`,
+	RunE:         importRun,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+}
+
+func importRun(cmd *cobra.Command, args []string) error {
+	url, err := cmd.Flags().GetString("url")
+	if err != nil {
+		return err
+	}
+	extraRoots, err := cmd.Flags().GetStringSlice("root")
+	if err != nil {
+		return err
+	}
+
+	if len(url) == 0 {
+		return errors.New("--url is required")
+	}
+	if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+		return fmt.Errorf("--url must be an http or https url, got: %s", url)
+	}
+
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	manifest, err := fetchManifest(url)
+	if err != nil {
+		return err
+	}
+
+	return storeTemplate(modRoot, url, manifest, extraRoots, "import")
+}
+
+// fetchManifest downloads the gomr file at url and returns its replaces with
+// everything that only makes sense on the machine it was written on removed
+func fetchManifest(url string) ([]replace, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to download %s", url)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", url, resp.Status)
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, importMaxSize+1))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to download %s", url)
+	}
+	if len(b) > importMaxSize {
+		return nil, fmt.Errorf("%s is bigger than %d bytes, it's not a gomr file", url, importMaxSize)
+	}
+
+	file, err := parseGomrFile(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", url)
+	}
+	if len(file.Replaces) == 0 {
+		return nil, fmt.Errorf("%s has no replaces in it", url)
+	}
+
+	replaces := file.Replaces
+	for i := range replaces {
+		replaces[i].AbsPath, replaces[i].AddGoMod = "", false
+		replaces[i].Require, replaces[i].Ref = "", ""
+	}
+	return replaces, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var initCmd = &cobra.Command{
+	Use:   "init [flags]",
+	Short: "Set up gomr for the current module",
+	Long: `Set up gomr for the current module
+
+Creates an empty gomr file and a starter config file. With --ignore gomr's
+files are added to .gitignore (--ignore gitignore) or .git/info/exclude
+(--ignore exclude). The gomr file itself is ignored too unless --shared is
+given, for teams that commit it.`,
+	RunE: initRun,
+}
+
+func initRun(cmd *cobra.Command, args []string) error {
+	ignore, err := cmd.Flags().GetString("ignore")
+	if err != nil {
+		return err
+	}
+	shared, err := cmd.Flags().GetBool("shared")
+	if err != nil {
+		return err
+	}
+
+	switch ignore {
+	case "", "gitignore", "exclude":
+	default:
+		return fmt.Errorf("--ignore must be gitignore or exclude, got: %s", ignore)
+	}
+
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	dir, err := storeDir(modRoot)
+	if err != nil {
+		return err
+	}
+
+	gomrFilePath := filepath.Join(dir, gomrFilename)
+	if _, err = os.Stat(gomrFilePath); os.IsNotExist(err) {
+		if err = writeReplacesFile(gomrFilePath, nil); err != nil {
+			return err
+		}
+		infof("created %s", gomrFilePath)
+	} else if err != nil {
+		return err
+	}
+
+	configPath := filepath.Join(dir, configFilename)
+	if _, err = os.Stat(configPath); os.IsNotExist(err) {
+		if err = ioutil.WriteFile(configPath, []byte(starterConfig), 0664); err != nil {
+			return errors.Wrapf(err, "failed to write %s", configFilename)
+		}
+		infof("created %s", configPath)
+	} else if err != nil {
+		return err
+	}
+
+	if len(ignore) == 0 || globalStore {
+		return nil
+	}
+
+	patterns := []string{"/" + gomrFilename + gomrLocalSuffix, "/" + gomrDirname + "/", "/" + gomrLockFilename}
+	if !shared {
+		patterns = append([]string{"/" + gomrFilename}, patterns...)
+	}
+
+	var ignorePath string
+	if ignore == "gitignore" {
+		ignorePath = filepath.Join(modRoot, ".gitignore")
+	} else {
+		excludePath, err := gitOutput(modRoot, "rev-parse", "--git-path", "info/exclude")
+		if err != nil {
+			return err
+		}
+		if !filepath.IsAbs(excludePath) {
+			excludePath = filepath.Join(modRoot, excludePath)
+		}
+		ignorePath = excludePath
+
+		// exclude patterns are relative to the repository root, not the module
+		topLevel, err := gitOutput(modRoot, "rev-parse", "--show-toplevel")
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(topLevel, modRoot)
+		if err != nil {
+			return err
+		}
+		if rel != "." {
+			for i, p := range patterns {
+				patterns[i] = "/" + filepath.ToSlash(rel) + p
+			}
+		}
+	}
+
+	added, err := appendIgnorePatterns(ignorePath, patterns)
+	if err != nil {
+		return err
+	}
+
+	if added != 0 {
+		infof("added %d pattern(s) to %s", added, ignorePath)
+	}
+
+	return nil
+}
+
+// appendIgnorePatterns adds the patterns that aren't already in the ignore
+// file at path, returning how many were added.
+func appendIgnorePatterns(path string, patterns []string) (int, error) {
+	existing, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return 0, errors.Wrapf(err, "failed to read %s", path)
+	}
+
+	have := make(map[string]bool)
+	for _, line := range strings.Split(string(existing), "\n") {
+		have[strings.TrimSpace(line)] = true
+	}
+
+	var buf bytes.Buffer
+	buf.Write(existing)
+	if len(existing) != 0 && !bytes.HasSuffix(existing, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+
+	added := 0
+	for _, p := range patterns {
+		if have[p] {
+			continue
+		}
+		buf.WriteString(p + "\n")
+		added++
+	}
+
+	if added == 0 {
+		return 0, nil
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+		return 0, errors.Wrapf(err, "failed to create dir for %s", path)
+	}
+
+	if err = ioutil.WriteFile(path, buf.Bytes(), 0664); err != nil {
+		return 0, errors.Wrapf(err, "failed to write %s", path)
+	}
+
+	return added, nil
+}
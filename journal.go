@@ -0,0 +1,368 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// journalFilename is the file inside gomrDirname that every operation is
+	// appended to, one JSON object per line.
+	journalFilename = "journal"
+	// maxJournalEntries is how many operations the journal keeps, older ones
+	// are dropped and can no longer be undone
+	maxJournalEntries = 100
+)
+
+var undoCmd = &cobra.Command{
+	Use:          "undo",
+	Short:        "Revert the most recent add, remove, up or down",
+	RunE:         undoRun,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+}
+
+var logCmd = &cobra.Command{
+	Use:   "log",
+	Short: "Show the history of gomr operations on the module",
+	RunE:  logRun,
+	Args:  cobra.NoArgs,
+}
+
+// operation is an entry in the journal, it has the contents of every file
+// the operation changed from before and after it ran
+type operation struct {
+	Time    time.Time    `json:"time"`
+	Command string       `json:"command"`
+	Undo    bool         `json:"undo,omitempty"`
+	Files   []fileChange `json:"files"`
+}
+
+// fileChange is the before and after state of a file changed by an operation
+type fileChange struct {
+	Path         string      `json:"path"`
+	Mode         os.FileMode `json:"mode"`
+	Before       []byte      `json:"before,omitempty"`
+	BeforeExists bool        `json:"before_exists"`
+	After        []byte      `json:"after,omitempty"`
+	AfterExists  bool        `json:"after_exists"`
+}
+
+// recordOperation calls fn and appends what it changed in the files to the
+// journal of the module in modRoot, as command. Nothing is recorded if fn
+// fails or doesn't change anything.
+func recordOperation(modRoot, command string, paths []string, fn func() error) error {
+	return journalRun(modRoot, operation{Command: command}, paths, fn)
+}
+
+// journalRun is recordOperation for any kind of operation, undo operations
+// are recorded even when they change nothing so they still count as undoing
+// one.
+func journalRun(modRoot string, op operation, paths []string, fn func() error) error {
+	before, err := beginTransaction(paths...)
+	if err != nil {
+		return err
+	}
+
+	// A signal doesn't stop fn halfway, the changes are undone once it's done
+	trap := trapSignals()
+	err = fn()
+	s := trap.signal()
+	trap.stop()
+	if err != nil || dryRun {
+		return err
+	}
+	if s != nil {
+		if rbErr := before.rollback(); rbErr != nil {
+			return errors.Wrapf(rbErr, "interrupted by %v and the rollback failed", s)
+		}
+		return fmt.Errorf("interrupted by %v, all changes were rolled back", s)
+	}
+
+	var changes []fileChange
+	for _, f := range before.files {
+		change := fileChange{
+			Path:         f.path,
+			Mode:         f.mode,
+			Before:       f.contents,
+			BeforeExists: f.exists,
+		}
+
+		change.After, err = ioutil.ReadFile(f.path)
+		if err == nil {
+			change.AfterExists = true
+		} else if !os.IsNotExist(err) {
+			return errors.Wrapf(err, "failed to read %s", f.path)
+		}
+
+		if change.BeforeExists != change.AfterExists || !bytes.Equal(change.Before, change.After) {
+			if !change.BeforeExists {
+				change.Mode = 0664
+			}
+			changes = append(changes, change)
+		}
+	}
+
+	if len(changes) == 0 && !op.Undo {
+		return nil
+	}
+
+	op.Time = time.Now()
+	op.Files = changes
+	return appendJournal(modRoot, op)
+}
+
+// operationName returns the command a journal entry is recorded as for the
+// replaces
+func operationName(command string, replaces []replace) string {
+	names := []string{command}
+	for _, r := range replaces {
+		names = append(names, r.ModuleName)
+	}
+	return strings.Join(names, " ")
+}
+
+// journalPath returns the path of the journal for the module in modRoot
+func journalPath(modRoot string) (string, error) {
+	dir, err := stateDir(modRoot)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, journalFilename), nil
+}
+
+// appendJournal adds op to the end of the journal and drops the oldest
+// operations once there are more than maxJournalEntries. The journal is
+// replaced in one go so an interrupted write doesn't lose it.
+func appendJournal(modRoot string, op operation) error {
+	path, err := journalPath(modRoot)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(op)
+	if err != nil {
+		return err
+	}
+
+	existing, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to read journal")
+	}
+
+	var lines [][]byte
+	for _, line := range bytes.Split(existing, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) != 0 {
+			lines = append(lines, line)
+		}
+	}
+	lines = append(lines, b)
+	if len(lines) > maxJournalEntries {
+		lines = lines[len(lines)-maxJournalEntries:]
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+		return errors.Wrapf(err, "failed to create %s dir", gomrDirname)
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), journalFilename+".tmp")
+	if err != nil {
+		return errors.Wrap(err, "failed to open journal")
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(append(bytes.Join(lines, []byte("\n")), '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to write journal")
+	}
+
+	if err = os.Chmod(f.Name(), 0664); err != nil {
+		return errors.Wrap(err, "failed to set journal permissions")
+	}
+	if err = os.Rename(f.Name(), path); err != nil {
+		return errors.Wrap(err, "failed to replace journal")
+	}
+
+	return nil
+}
+
+// readJournal returns every operation in the journal, oldest first
+func readJournal(modRoot string) ([]operation, error) {
+	path, err := journalPath(modRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to open journal")
+	}
+	defer f.Close()
+
+	var ops []operation
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var op operation
+		if err = json.Unmarshal(scanner.Bytes(), &op); err != nil {
+			return nil, errors.Wrapf(err, "failed to read journal line %d", line)
+		}
+		ops = append(ops, op)
+	}
+
+	if err = scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "failed to read journal")
+	}
+
+	return ops, nil
+}
+
+// undoStack returns the indexes of the operations that haven't been undone,
+// most recent last. Each undo entry undoes the most recent operation before
+// it that isn't already undone.
+func undoStack(ops []operation) []int {
+	var stack []int
+	for i, op := range ops {
+		if !op.Undo {
+			stack = append(stack, i)
+		} else if len(stack) != 0 {
+			stack = stack[:len(stack)-1]
+		}
+	}
+	return stack
+}
+
+func undoRun(cmd *cobra.Command, args []string) error {
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
+
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	lock, err := lockModule(modRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	ops, err := readJournal(modRoot)
+	if err != nil {
+		return err
+	}
+	stack := undoStack(ops)
+	if len(stack) == 0 {
+		return errors.New("nothing to undo")
+	}
+	op := ops[stack[len(stack)-1]]
+
+	// Refuse to throw away changes made since the operation
+	if !force {
+		for _, f := range op.Files {
+			b, err := ioutil.ReadFile(f.Path)
+			exists := err == nil
+			if err != nil && !os.IsNotExist(err) {
+				return errors.Wrapf(err, "failed to read %s", f.Path)
+			}
+			if exists != f.AfterExists || !bytes.Equal(b, f.After) {
+				return errors.Errorf("%s changed since %q, use --force to undo anyway", f.Path, op.Command)
+			}
+		}
+	}
+
+	var paths []string
+	for _, f := range op.Files {
+		paths = append(paths, f.Path)
+	}
+
+	undo := operation{Command: "undo " + op.Command, Undo: true}
+	err = journalRun(modRoot, undo, paths, func() error {
+		for _, f := range op.Files {
+			var err error
+			if f.BeforeExists {
+				err = writeFile(f.Path, f.Before, f.Mode)
+			} else if err = removeFile(f.Path); os.IsNotExist(err) {
+				err = nil
+			}
+			if err != nil {
+				return errors.Wrapf(err, "failed to undo %s", f.Path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	infof("undid: %s", op.Command)
+	return nil
+}
+
+func logRun(cmd *cobra.Command, args []string) error {
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	ops, err := readJournal(modRoot)
+	if err != nil {
+		return err
+	}
+	if len(ops) == 0 {
+		infof("no operations recorded")
+		return nil
+	}
+
+	active := make(map[int]bool)
+	for _, i := range undoStack(ops) {
+		active[i] = true
+	}
+
+	for i, op := range ops {
+		status := ""
+		if !op.Undo && !active[i] {
+			status = " (undone)"
+		}
+		outputf("%s %s%s", op.Time.Local().Format("2006-01-02 15:04:05"), op.Command, status)
+		for _, f := range op.Files {
+			path := f.Path
+			if rel, err := filepath.Rel(modRoot, f.Path); err == nil && !strings.HasPrefix(rel, "..") {
+				path = rel
+			}
+
+			switch {
+			case !f.BeforeExists:
+				outputf("  created %s", path)
+			case !f.AfterExists:
+				outputf("  deleted %s", path)
+			default:
+				outputf("  changed %s", path)
+			}
+		}
+	}
+
+	return nil
+}
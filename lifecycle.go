@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// lifecycleHooks are the commands the project config runs around up and
+// down
+type lifecycleHooks struct {
+	PreUp    string `toml:"pre_up"`
+	PostUp   string `toml:"post_up"`
+	PreDown  string `toml:"pre_down"`
+	PostDown string `toml:"post_down"`
+}
+
+// scripts returns the pre and post hook for the command, up or down
+func (h lifecycleHooks) scripts(command string) (pre, post string) {
+	if command == "up" {
+		return h.PreUp, h.PostUp
+	}
+	return h.PreDown, h.PostDown
+}
+
+// withLifecycleHooks calls fn between the project's pre and post hooks for
+// command, unless cmd's --no-hooks flag is set. The post hook is only run if
+// fn succeeded, and after the module lock is released so it can run gomr.
+func withLifecycleHooks(cmd *cobra.Command, modRoot, command string, replaces []replace, lock *moduleLock, fn func() error) error {
+	noHooks, err := cmd.Flags().GetBool("no-hooks")
+	if err != nil {
+		return err
+	}
+
+	var pre, post string
+	if !noHooks {
+		cfg, err := loadConfig(modRoot)
+		if err != nil {
+			return err
+		}
+		pre, post = cfg.Hooks.scripts(command)
+	}
+
+	if err = runLifecycleHook(modRoot, "pre-"+command, pre, replaces); err != nil {
+		return err
+	}
+	if err = fn(); err != nil {
+		return err
+	}
+	if err = lock.unlock(); err != nil {
+		return err
+	}
+	return runLifecycleHook(modRoot, "post-"+command, post, replaces)
+}
+
+// runLifecycleHook runs the hook script with the shell in modRoot. The hook
+// is told which hook it is and the modules being replaced in GOMR_HOOK and
+// GOMR_MODULES.
+func runLifecycleHook(modRoot, hook, script string, replaces []replace) error {
+	if len(strings.TrimSpace(script)) == 0 {
+		return nil
+	}
+	if dryRun {
+		infof("would run %s hook: %s", hook, script)
+		return nil
+	}
+
+	var modules []string
+	for _, r := range replaces {
+		modules = append(modules, r.ModuleName)
+	}
+
+	infof("running %s hook: %s", hook, script)
+	c := shellCommand(script)
+	c.Dir = modRoot
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	c.Env = append(os.Environ(), "GOMR_HOOK="+hook, "GOMR_MODULES="+strings.Join(modules, " "))
+	if err := runForwardingSignals(c); err != nil {
+		return errors.Wrapf(err, "%s hook failed", hook)
+	}
+
+	return nil
+}
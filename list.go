@@ -0,0 +1,257 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var listCmd = &cobra.Command{
+	Use:   "list [flags]",
+	Short: "List the stored replaces",
+	Long: `List the stored replaces
+
+With --porcelain each replace is printed on one tab separated line for
+scripts, in a format that won't change between versions:
+
+  <state> <module> <replacement> <path> <profiles>
+
+state is applied, not-applied, disabled or conflict (go.mod, or the active
+go.work which wins over it, gets the module from somewhere else), path is
+ok, missing or remote and profiles is a comma separated list or - when there
+are none. New fields are only ever added at the end.`,
+	RunE: listRun,
+}
+
+func listRun(cmd *cobra.Command, args []string) error {
+	return printReplaces(cmd, false)
+}
+
+// printReplaces prints the stored replaces for list, and with their git
+// branch and upstream when details is set for status.
+func printReplaces(cmd *cobra.Command, details bool) error {
+	porcelain, err := cmd.Flags().GetBool("porcelain")
+	if err != nil {
+		return err
+	}
+
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	profile, err := profileFlag(cmd, modRoot)
+	if err != nil {
+		return err
+	}
+
+	// Disabled replaces are listed too, unlike for the other commands
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return err
+	}
+	replaces, err := readGomrFile(gomrFilePath)
+	if err != nil {
+		return err
+	}
+	replaces = filterProfile(replaces, profile)
+
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		return err
+	}
+
+	states := readGitStates(replaces, details)
+
+	// Pad the module and replacement columns so the statuses line up
+	moduleWidth, targetWidth := 0, 0
+	for _, r := range replaces {
+		if len(r.ModuleName) > moduleWidth {
+			moduleWidth = len(r.ModuleName)
+		}
+		if len(r.replacement()) > targetWidth {
+			targetWidth = len(r.replacement())
+		}
+	}
+
+	// conflicts describes where the build gets the modules go.mod or go.work
+	// point somewhere else from, go.work winning since its directives come
+	// first
+	conflicts := make(map[string]string)
+	for _, c := range conflictingReplaces(modRoot, mod, enabledReplaces(replaces)) {
+		conflicts[strings.ToLower(c.ModuleName)] = "go.mod replaces it with " + c.current
+	}
+
+	inWork := make(map[string]bool)
+	if goWork := activeGoWork(modRoot); len(goWork) != 0 {
+		if details && !porcelain {
+			warnGoWorkActive(goWork)
+		}
+
+		overrides, applied, err := resolveWorkspace(goWork, enabledReplaces(replaces))
+		if err != nil {
+			debugf("%v", err)
+		}
+		for _, o := range overrides {
+			conflicts[strings.ToLower(o.ModuleName)] = o.String()
+		}
+		for _, r := range applied {
+			inWork[strings.ToLower(r.ModuleName)] = true
+		}
+	}
+
+	if porcelain {
+		return printPorcelain(modRoot, mod, replaces, states, conflicts, inWork, details)
+	}
+
+	for i, r := range replaces {
+		status := replaceStatus(mod, r, states[i], inWork[strings.ToLower(r.ModuleName)], details)
+		if conflict, ok := conflicts[strings.ToLower(r.ModuleName)]; ok {
+			status = colorize(colorYellow, conflict)
+		}
+		outputf("%-*s => %-*s  %s", moduleWidth, r.ModuleName, targetWidth, r.replacement(), status)
+		if len(r.Ref) != 0 {
+			outputf("  ref: %s", r.Ref)
+		}
+		if len(r.Profiles) != 0 {
+			outputf("  profiles: %s", strings.Join(r.Profiles, ", "))
+		}
+		if len(r.Modules) != 0 {
+			outputf("  modules: %s", strings.Join(r.Modules, ", "))
+		}
+		if len(r.Note) != 0 {
+			outputf("  note: %s", r.Note)
+		}
+	}
+
+	if !details {
+		return nil
+	}
+
+	// Every stored replace counts as managed, not just the profile's
+	stored, err := storedReplaces(modRoot)
+	if err != nil {
+		return err
+	}
+	if unmanaged := unmanagedReplaces(mod, stored); len(unmanaged) != 0 {
+		outputf("")
+		outputf("not managed by gomr (gomr adopt records the local ones):")
+		for _, rep := range unmanaged {
+			outputf("  %s", formatGoModReplace(rep))
+		}
+	}
+
+	return nil
+}
+
+// replaceStatus describes the state of a stored replace: whether go.mod, or
+// the active go.work when inWork is set, has it, whether its path is missing
+// and whether its checkout has uncommitted changes, or with details the git
+// state from gitStatus. It's colored when color is enabled.
+func replaceStatus(mod goModFile, r replace, state gitState, inWork, details bool) string {
+	var statuses []string
+
+	switch {
+	case r.Disabled:
+		statuses = append(statuses, colorize(colorDim, "disabled"))
+	case inWork:
+		statuses = append(statuses, colorize(colorGreen, "applied in go.work"))
+	case len(appliedReplaces(mod, []replace{r})) != 0:
+		statuses = append(statuses, colorize(colorGreen, "applied"))
+	default:
+		statuses = append(statuses, "not applied")
+	}
+
+	if !r.isRemote() {
+		if _, err := os.Stat(r.rootPath()); err != nil {
+			statuses = append(statuses, colorize(colorRed, "missing"))
+		} else if details {
+			if git := gitStatus(state); len(git) != 0 {
+				statuses = append(statuses, git)
+			}
+		} else if state.dirty {
+			statuses = append(statuses, colorize(colorYellow, "dirty"))
+		}
+	}
+
+	return strings.Join(statuses, ", ")
+}
+
+// printPorcelain prints the replaces in the format described by list's and
+// status's help, one tab separated line each. With details the git state of
+// each checkout is added and the replaces in go.mod that gomr doesn't manage
+// are printed after them.
+func printPorcelain(modRoot string, mod goModFile, replaces []replace, states []gitState, conflicts map[string]string, inWork map[string]bool, details bool) error {
+	for i, r := range replaces {
+		state := "not-applied"
+		switch {
+		case r.Disabled:
+			state = "disabled"
+		case len(conflicts[strings.ToLower(r.ModuleName)]) != 0:
+			state = "conflict"
+		case inWork[strings.ToLower(r.ModuleName)] || len(appliedReplaces(mod, []replace{r})) != 0:
+			state = "applied"
+		}
+
+		path := "ok"
+		if r.isRemote() {
+			path = "remote"
+		} else if _, err := os.Stat(r.rootPath()); err != nil {
+			path = "missing"
+		}
+
+		profiles := "-"
+		if len(r.Profiles) != 0 {
+			profiles = strings.Join(r.Profiles, ",")
+		}
+
+		fields := []string{state, r.ModuleName, r.replacement(), path, profiles}
+		if details {
+			fields = append(fields, porcelainGitFields(states[i])...)
+		}
+		outputf("%s", strings.Join(fields, "\t"))
+	}
+
+	if !details {
+		return nil
+	}
+
+	stored, err := storedReplaces(modRoot)
+	if err != nil {
+		return err
+	}
+	for _, rep := range unmanagedReplaces(mod, stored) {
+		old, replacement := rep.Old.Path, rep.New.Path
+		if len(rep.Old.Version) != 0 {
+			old += "@" + rep.Old.Version
+		}
+		if len(rep.New.Version) != 0 {
+			replacement += "@" + rep.New.Version
+		}
+		outputf("unmanaged\t%s\t%s", old, replacement)
+	}
+
+	return nil
+}
+
+// porcelainGitFields are the branch, tree, ahead and behind fields status
+// adds to each porcelain line, - when they don't apply
+func porcelainGitFields(state gitState) []string {
+	if !state.repo {
+		return []string{"-", "-", "-", "-"}
+	}
+	if state.err != nil {
+		return []string{"-", "error", "-", "-"}
+	}
+
+	tree := "clean"
+	if state.dirty {
+		tree = "dirty"
+	}
+	if !state.upstream {
+		return []string{state.branch, tree, "-", "-"}
+	}
+	return []string{state.branch, tree, strconv.Itoa(state.ahead), strconv.Itoa(state.behind)}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// gomrLockFilename is created next to the gomr file while a gomr process
+	// is editing the module so that others wait their turn.
+	gomrLockFilename = ".gomr.lock"
+
+	lockTimeout  = 10 * time.Second
+	lockInterval = 50 * time.Millisecond
+)
+
+// moduleLock is an advisory lock on a module's go.mod and gomr files
+type moduleLock struct {
+	path string
+}
+
+// lockModule takes the lock for the module in modRoot, waiting for another
+// gomr process to release it if necessary. Every command that edits the
+// module takes the lock first, so this is also where go.mod and go.sum are
+// snapshotted for restore.
+func lockModule(modRoot string) (*moduleLock, error) {
+	dir, err := storeDir(modRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	path := filepath.Join(dir, gomrLockFilename)
+	deadline := time.Now().Add(lockTimeout)
+
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0664)
+		if err == nil {
+			_, err = fmt.Fprintf(f, "%d\n", os.Getpid())
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, errors.Wrap(err, "failed to write lock file")
+			}
+
+			lock := &moduleLock{path: path}
+			if err = snapshotGoMod(modRoot); err != nil {
+				lock.unlock()
+				return nil, err
+			}
+
+			return lock, nil
+		}
+
+		if !os.IsExist(err) {
+			return nil, errors.Wrap(err, "failed to create lock file")
+		}
+
+		if time.Now().After(deadline) {
+			holder := "another gomr process"
+			if b, err := ioutil.ReadFile(path); err == nil && len(b) != 0 {
+				holder = fmt.Sprintf("gomr process %s", strings.TrimSpace(string(b)))
+			}
+			return nil, fmt.Errorf("module is locked by %s, if it's no longer running delete %s", holder, path)
+		}
+
+		time.Sleep(lockInterval)
+	}
+}
+
+// unlock releases the lock
+func (m *moduleLock) unlock() error {
+	if err := os.Remove(m.path); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "failed to remove lock file")
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// logLevel is how important a message is, it decides whether it's shown
+// with --verbose and --quiet
+type logLevel int
+
+const (
+	// levelDebug messages are only shown with --verbose
+	levelDebug logLevel = iota
+	// levelInfo messages report what gomr did and are hidden by --quiet
+	levelInfo
+	// levelWarn messages are problems that don't stop the command, they're
+	// hidden by --quiet
+	levelWarn
+	// levelOutput messages are what the command was run to show, like the
+	// replaces from list, they're shown even with --quiet
+	levelOutput
+)
+
+var (
+	// verbose is set by the --verbose flag
+	verbose bool
+	// quiet is set by the --quiet flag
+	quiet bool
+)
+
+// logEntry is a single message
+type logEntry struct {
+	Level   logLevel
+	Message string
+}
+
+// emit is called with every message that should be shown, it writes them as
+// lines of text
+var emit = func(e logEntry) {
+	var w io.Writer = os.Stdout
+	prefix := ""
+	switch e.Level {
+	case levelDebug:
+		w = os.Stderr
+	case levelWarn:
+		w = os.Stderr
+		prefix = "warning: "
+	}
+
+	fmt.Fprintf(w, "%s%s\n", prefix, e.Message)
+}
+
+// logf formats a message and emits it if level is shown with the current
+// flags
+func logf(level logLevel, format string, args ...interface{}) {
+	switch {
+	case level == levelDebug && !verbose:
+		return
+	case quiet && (level == levelInfo || level == levelWarn):
+		return
+	}
+
+	emit(logEntry{Level: level, Message: fmt.Sprintf(format, args...)})
+}
+
+// debugf logs the details shown by --verbose
+func debugf(format string, args ...interface{}) {
+	logf(levelDebug, format, args...)
+}
+
+// infof logs what gomr did
+func infof(format string, args ...interface{}) {
+	logf(levelInfo, format, args...)
+}
+
+// warnf logs a problem that doesn't stop the command
+func warnf(format string, args ...interface{}) {
+	logf(levelWarn, format, args...)
+}
+
+// outputf logs the results the command was run for
+func outputf(format string, args ...interface{}) {
+	logf(levelOutput, format, args...)
+}
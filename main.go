@@ -6,7 +6,9 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
@@ -17,310 +19,1454 @@ const (
 )
 
 var addCmd = &cobra.Command{
-	Use:   "add [flags] <package> [path]",
+	Use:   "add [flags] <package> [path | module@version]",
 	Short: "add a replace line to the current module",
-	RunE:  addRun,
-	Args:  cobra.MinimumNArgs(1),
+	Long: `add a replace line to the current module
+
+Several packages can be given at once to add them all in a single go.mod
+edit, their paths are found with the path mappings or GOPATH.
+
+With --file (or - to read stdin) the packages are read from a file instead,
+one per line optionally followed by a path or module@version. Blank lines and
+lines starting with # are ignored.`,
+	RunE: addRun,
+}
+
+var removeCmd = &cobra.Command{
+	Use:   "remove [flags] [package...]",
+	Short: "Remove replaces from the current module, picking them from a list if none are given",
+	RunE:  removeRun,
+}
+
+var upCmd = &cobra.Command{
+	Use:   "up [flags] [module...]",
+	Short: "Add the stored replace lines to go.mod, all of them unless modules are given",
+	Long: `Add the stored replace lines to go.mod, all of them unless modules are given
+
+When every replace line is already in go.mod, pointing where it should, and
+every stub exists, nothing is changed or run, not even the hooks, and it
+reports that go.mod is already up to date.`,
+	RunE: upRun,
+}
+
+var downCmd = &cobra.Command{
+	Use:   "down [flags] [module...]",
+	Short: "Remove the stored replace lines from go.mod, all of them unless modules are given",
+	Long: `Remove the stored replace lines from go.mod, all of them unless modules are given
+
+When none of the replace lines are in go.mod and there's nothing left to put
+back, like a required version, a stub or go.sum, nothing is changed or run,
+not even the hooks, and it reports that go.mod is already up to date.`,
+	RunE: downRun,
+}
+
+var rootCmd = &cobra.Command{
+	Use:   "gomr [flags] <command>",
+	Short: "Manages replaces in Go modules",
+	Long: `Manages replaces in Go modules
+
+Flags can also be set with an environment variable named after them,
+GOMR_DRY_RUN for --dry-run or GOMR_PROFILE for --profile, except --yes,
+--force and --all. A flag on the command line wins over the variable, and
+the variable over the config.`,
+}
+
+// setupCommands adds the flags and subcommands to rootCmd
+func setupCommands() {
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if err := loadFlagEnv(cmd); err != nil {
+			return err
+		}
+		loadColorConfig(cmd, args)
+		return nil
+	}
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "show the go and git commands gomr runs and their output")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "only show errors and the output the command was run for")
+	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "don't color the output, also disabled by setting NO_COLOR")
+	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "print the changes that would be made without making them")
+	rootCmd.PersistentFlags().StringVar(&goBinary, "go", "", "the go binary to run, the default is $GOMR_GO or go from PATH")
+	rootCmd.PersistentFlags().BoolVar(&globalStore, "global-store", false, "keep replaces in the user config dir instead of a "+gomrFilename+" file in the module")
+
+	addCmd.Flags().StringSliceP("profile", "p", nil, "profiles (groups) to put the replace in")
+	addCmd.Flags().StringP("note", "n", "", "a note describing why the replace exists")
+	addCmd.Flags().BoolP("local", "l", false, "store the replace in the personal "+gomrFilename+gomrLocalSuffix+" file")
+	addCmd.Flags().String("branch", "", "check out this branch in the target repository before adding the replace")
+	addCmd.Flags().String("commit", "", "check out this commit in the target repository before adding the replace")
+	addCmd.Flags().BoolP("interactive", "i", false, "pick the module and directory from searchable lists")
+	addCmd.Flags().String("dir", "", "add a replace for the module in this directory, reading its path from go.mod")
+	addCmd.Flags().StringP("file", "f", "", "read the packages and targets to add from a file")
+	addCmd.Flags().Bool("force", false, "only warn when the target's go.mod declares a different module")
+	addCmd.Flags().Bool("deps", false, "also add replaces for the module's dependencies that gomr knows local checkouts of")
+	addCmd.Flags().Bool("inline", false, "copy the replace directives in the module's go.mod into the current module")
+	addCmd.Flags().StringSliceP("module", "m", nil, "directories of the modules, relative to the current one, whose go.mod the replace goes in")
+	addCmd.Flags().Bool("clone", false, "clone the module's repository if the path does not exist")
+	addCmd.Flags().Bool("from-cache", false, "copy the module from the module cache if it's not checked out, without asking")
+	addCmd.Flags().Bool("resolve-symlinks", true, "store the target's real path with any symlinks in it resolved")
+	addCmd.Flags().Bool("no-resolve-symlinks", false, "store the target's path as given, for when a symlink is the stable location")
+	addCmd.Flags().Bool("relative", false, "store the path relative to the module if it's inside or beside the repository, the default is the project's relative setting")
+	addCmd.Flags().Bool("tidy", false, "run go mod tidy afterwards, the default is the project's tidy setting")
+	addCmd.Flags().Bool("require", false, "require modules that aren't dependencies yet at their latest version")
+	removeCmd.Flags().Bool("all", false, "remove every stored replace")
+	removeCmd.Flags().BoolP("yes", "y", false, "don't ask for confirmation with --all")
+	removeCmd.Flags().Bool("force", false, "delete generated go.mod files even if they were changed")
+	removeCmd.Flags().Bool("tidy", false, "run go mod tidy afterwards, the default is the project's tidy setting")
+	upCmd.Flags().StringP("profile", "p", "", "only install replaces in this profile")
+	upCmd.Flags().BoolP("recursive", "r", false, "also install the replaces in every other module in the repository")
+	upCmd.Flags().Bool("workspace", false, "install the replaces in the active go.work instead of go.mod")
+	upCmd.Flags().Bool("tidy", false, "run go mod tidy afterwards, the default is the project's tidy setting")
+	upCmd.Flags().Bool("adopt", false, "first adopt the local replaces in go.mod that gomr doesn't manage")
+	upCmd.Flags().Bool("no-hooks", false, "don't run the pre_up and post_up hooks from the project config")
+	downCmd.Flags().StringP("profile", "p", "", "only remove replaces in this profile")
+	diffCmd.Flags().StringP("profile", "p", "", "only show the changes for replaces in this profile")
+	diffCmd.Flags().Bool("workspace", false, "show the changes up or down --workspace would make to the active go.work")
+	ideCmd.Flags().StringP("profile", "p", "", "only put the checkouts of replaces in this profile in go.work")
+	renameCmd.Flags().Bool("require", false, "also change the require line for the old path to one for the new path")
+	renameCmd.Flags().Bool("force", false, "only warn when the checkout's go.mod declares a different module")
+	savedSetSaveCmd.Flags().Bool("force", false, "overwrite a set already saved under the name")
+	mvCmd.Flags().Bool("force", false, "only warn when the new path's go.mod declares a different module")
+	promptCmd.Flags().String("format", "gomr:%d↑", "the marker to print, %d is the number of applied replaces")
+	serveCmd.Flags().String("socket", "", "listen on this unix socket instead of stdin and stdout")
+	watchCmd.Flags().StringP("profile", "p", "", "only keep replaces in this profile installed")
+	downCmd.Flags().Bool("force", false, "delete generated go.mod files even if they were changed")
+	downCmd.Flags().BoolP("recursive", "r", false, "also remove the replaces from every other module in the repository")
+	downCmd.Flags().Bool("workspace", false, "remove the replaces from the active go.work instead of go.mod")
+	downCmd.Flags().Bool("tidy", false, "run go mod tidy afterwards, the default is the project's tidy setting")
+	downCmd.Flags().Bool("adopt", false, "first adopt the local replaces in go.mod that gomr doesn't manage, so they're removed too")
+	downCmd.Flags().Bool("no-hooks", false, "don't run the pre_down and post_down hooks from the project config")
+	adoptCmd.Flags().StringSliceP("profile", "p", nil, "profiles (groups) to put the adopted replaces in")
+	execCmd.Flags().StringP("profile", "p", "", "only apply replaces in this profile")
+	shellCmd.Flags().StringP("profile", "p", "", "only apply replaces in this profile")
+	hookInstallCmd.Flags().Bool("auto-down", false, "remove the replaces in the pre-commit hook instead of failing")
+	hookInstallCmd.Flags().BoolP("force", "f", false, "overwrite existing hooks not installed by gomr")
+	hookPreCommitCmd.Flags().Bool("auto-down", false, "run down and drop the replaces from the staged go.mod instead of failing")
+
+	listCmd.Flags().StringP("profile", "p", "", "only list replaces in this profile")
+	listCmd.Flags().Bool("porcelain", false, "print a stable tab separated format for scripts")
+	pullCmd.Flags().StringP("profile", "p", "", "only pull the checkouts of replaces in this profile")
+	pullCmd.Flags().String("command", "", "run this command with the shell instead of git pull --ff-only")
+	foreachCmd.Flags().StringP("profile", "p", "", "only run in the modules of replaces in this profile")
+	foreachCmd.Flags().IntP("jobs", "j", runtime.NumCPU(), "how many modules to run the command in at once")
+	bundleCmd.Flags().StringP("profile", "p", "", "only bundle replaces in this profile")
+	bundleCmd.Flags().String("dir", bundleDirname, "the directory in the module to copy the replaced modules into")
+	dockerCmd.Flags().StringP("profile", "p", "", "only use replaces in this profile")
+	dockerCmd.Flags().String("format", "mounts", "what to print: mounts, copy or gomod")
+	dockerCmd.Flags().String("root", "/gomr", "the directory in the container the replaced modules go in")
+	dockerCmd.Flags().StringP("output", "o", "", "write the go.mod for --format gomod to this file instead of printing it")
+	buildCmd.Flags().StringP("profile", "p", "", "only apply replaces in this profile")
+	buildCmd.Flags().Bool("ephemeral", true, "restore go.mod after building")
+	testCmd.Flags().StringP("profile", "p", "", "only apply and test replaces in this profile")
+	testCmd.Flags().IntP("jobs", "j", runtime.NumCPU(), "how many replaced modules to test at once")
+	statusCmd.Flags().StringP("profile", "p", "", "only show replaces in this profile")
+	statusCmd.Flags().Bool("porcelain", false, "print a stable tab separated format for scripts")
+	forkCmd.Flags().StringSliceP("profile", "p", nil, "profiles (groups) to put the replace in")
+	forkCmd.Flags().StringP("note", "n", "", "a note describing why the replace exists")
+	forkCmd.Flags().String("remote", "", "url of an existing fork to clone instead of creating one with gh")
+	forkCmd.Flags().String("dir", "", "directory to clone into instead of the default checkout location")
+	initCmd.Flags().String("ignore", "", "add gomr's files to gitignore or exclude (.git/info/exclude)")
+	initCmd.Flags().Bool("shared", false, "don't ignore the "+gomrFilename+" file itself so it can be committed")
+	graphCmd.Flags().Bool("dot", false, "print the graph in Graphviz's DOT format")
+	graphCmd.Flags().Bool("replaced", false, "only show requirements to and from replaced modules")
+	restoreCmd.Flags().Bool("list", false, "list the snapshots instead of restoring one")
+	undoCmd.Flags().Bool("force", false, "undo even if the files changed since the operation")
+	configGetCmd.Flags().Bool("user", false, "only read the user config")
+	configSetCmd.Flags().Bool("user", false, "change the user config instead of the project's")
+	doctorCmd.Flags().Bool("fix", false, "offer to fix each problem that can be fixed")
+	doctorCmd.Flags().BoolP("yes", "y", false, "apply the fixes without asking, with --fix")
+	auditCmd.Flags().String("max-age", "30d", "flag replaces older than this (e.g. 72h, 30d, 6w)")
+	verifyCmd.Flags().StringP("profile", "p", "", "only verify replaces in this profile")
+	verifyCmd.Flags().Bool("build", false, "run go build ./... in each replaced module too")
+	verifyCmd.Flags().IntP("jobs", "j", runtime.NumCPU(), "how many replaced modules to build at once")
+	checkCmd.Flags().Bool("local", false, "also fail on any replace pointing at a local directory")
+	checkDiffCmd.Flags().Bool("local", false, "also fail on any added replace pointing at a local directory")
+	suggestCmd.Flags().StringSlice("root", nil, "extra directories to search for checkouts")
+	applyTemplateCmd.Flags().String("file", "", "the template to apply (default "+gomrTemplateFilename+" in the module root)")
+	applyTemplateCmd.Flags().StringSlice("root", nil, "extra directories to search for checkouts")
+	importCmd.Flags().String("url", "", "the url of the manifest to import")
+	importCmd.Flags().StringSlice("root", nil, "extra directories to search for checkouts")
+	suggestCmd.Flags().BoolP("interactive", "i", false, "ask whether to add a replace for each checkout found")
+
+	addCmd.ValidArgsFunction = completeAddArgs
+	mvCmd.ValidArgsFunction = completeMvArgs
+	renameCmd.ValidArgsFunction = completeRenameArgs
+	for _, c := range []*cobra.Command{removeCmd, upCmd, downCmd, enableCmd, disableCmd, whyCmd, pullCmd, freezeCmd, whereCmd, editCmd} {
+		c.ValidArgsFunction = completeStoredModules
+	}
+	for _, c := range []*cobra.Command{addCmd, upCmd, downCmd, adoptCmd, execCmd, shellCmd, listCmd, forkCmd, diffCmd, statusCmd, pullCmd, foreachCmd, testCmd, buildCmd, dockerCmd, bundleCmd, watchCmd, ideCmd, verifyCmd} {
+		if err := c.RegisterFlagCompletionFunc("profile", completeProfiles); err != nil {
+			panic(err)
+		}
+	}
+
+	hookCmd.AddCommand(hookInstallCmd, hookUninstallCmd, hookPreCommitCmd, hookPostCheckoutCmd)
+	mergeDriverCmd.AddCommand(mergeDriverInstallCmd, mergeDriverUninstallCmd)
+	configCmd.AddCommand(configGetCmd, configSetCmd)
+	savedSetCmd.AddCommand(savedSetSaveCmd, savedSetLoadCmd, savedSetListCmd, savedSetDeleteCmd)
+	filterCmd.AddCommand(filterCleanCmd, filterSmudgeCmd, filterInstallCmd)
+	rootCmd.AddCommand(addCmd, removeCmd, upCmd, downCmd, adoptCmd, execCmd, shellCmd, hookCmd, filterCmd, checkCmd, migrateCmd, listCmd, auditCmd, pruneCmd, initCmd, forkCmd, suggestCmd, enableCmd, disableCmd, uiCmd, completionCmd, restoreCmd, undoCmd, logCmd, diffCmd, versionCmd, whyCmd, graphCmd, statusCmd, pullCmd, foreachCmd, testCmd, buildCmd, dockerCmd, bundleCmd, freezeCmd, releaseCheckCmd, mergeDriverCmd, doctorCmd, configCmd, watchCmd, serveCmd, ideCmd, promptCmd, whereCmd, shellInitCmd, editCmd, mvCmd, renameCmd, savedSetCmd, applyTemplateCmd, importCmd, verifyCmd, checkDiffCmd)
+
+	// Errors are printed by exit so that they go to stderr once
+	rootCmd.SilenceErrors = true
+}
+
+func main() {
+	setupCommands()
+	exit(rootCmd.Execute())
+}
+
+func addRun(cmd *cobra.Command, args []string) error {
+	file, err := cmd.Flags().GetString("file")
+	if err != nil {
+		return err
+	}
+	dir, err := cmd.Flags().GetString("dir")
+	if err != nil {
+		return err
+	}
+	interactive, err := cmd.Flags().GetBool("interactive")
+	if err != nil {
+		return err
+	}
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
+	deps, err := cmd.Flags().GetBool("deps")
+	if err != nil {
+		return err
+	}
+	inline, err := cmd.Flags().GetBool("inline")
+	if err != nil {
+		return err
+	}
+	require, err := cmd.Flags().GetBool("require")
+	if err != nil {
+		return err
+	}
+
+	var targets []addTarget
+	switch {
+	case interactive:
+		if len(args) != 0 || len(file) != 0 || len(dir) != 0 {
+			return errors.New("no packages, --file or --dir can be given with --interactive")
+		}
+		modRoot, err := findModuleRoot()
+		if err != nil {
+			return err
+		}
+		t, ok, err := pickAddTarget(modRoot)
+		if err != nil || !ok {
+			return err
+		}
+		targets = []addTarget{t}
+	case len(dir) != 0:
+		if len(args) != 0 || len(file) != 0 {
+			return errors.New("no packages or --file can be given with --dir")
+		}
+		moduleName, err := readModulePath(dir)
+		if err != nil {
+			return err
+		}
+		targets = []addTarget{{Module: moduleName, Target: dir}}
+	case len(file) != 0:
+		if len(args) != 0 {
+			return errors.New("no packages can be given with --file")
+		}
+		if targets, err = readAddFile(file); err != nil {
+			return err
+		}
+	case len(args) == 1 && args[0] == "-":
+		if targets, err = readAddTargets(os.Stdin, "-", ""); err != nil {
+			return err
+		}
+	case len(args) == 0:
+		return errors.New("a package or --file is required")
+	default:
+		targets = addArgs(args)
+	}
+
+	profiles, err := cmd.Flags().GetStringSlice("profile")
+	if err != nil {
+		return err
+	}
+	note, err := cmd.Flags().GetString("note")
+	if err != nil {
+		return err
+	}
+	local, err := cmd.Flags().GetBool("local")
+	if err != nil {
+		return err
+	}
+	modules, err := cmd.Flags().GetStringSlice("module")
+	if err != nil {
+		return err
+	}
+	clone, err := cmd.Flags().GetBool("clone")
+	if err != nil {
+		return err
+	}
+	fromCache, err := cmd.Flags().GetBool("from-cache")
+	if err != nil {
+		return err
+	}
+	branch, err := cmd.Flags().GetString("branch")
+	if err != nil {
+		return err
+	}
+	commit, err := cmd.Flags().GetString("commit")
+	if err != nil {
+		return err
+	}
+
+	resolveSymlinks, err := cmd.Flags().GetBool("resolve-symlinks")
+	if err != nil {
+		return err
+	}
+	noResolveSymlinks, err := cmd.Flags().GetBool("no-resolve-symlinks")
+	if err != nil {
+		return err
+	}
+
+	if len(branch) != 0 && len(commit) != 0 {
+		return errors.New("--branch and --commit cannot be used together")
+	}
+	if cmd.Flags().Changed("resolve-symlinks") && noResolveSymlinks {
+		return errors.New("--resolve-symlinks and --no-resolve-symlinks cannot be used together")
+	}
+	resolveSymlinks = resolveSymlinks && !noResolveSymlinks
+	ref := branch
+	if len(commit) != 0 {
+		ref = commit
+	}
+
+	// Relative paths are relative to the gomr file, which is in the root of
+	// the module
+	relativeRoot := ""
+	if modRoot, err := findModuleRoot(); err == nil {
+		relative, err := configBoolFlag(cmd, "relative", modRoot, func(cfg config) bool { return cfg.Relative })
+		if err != nil {
+			return err
+		}
+		if relative {
+			relativeRoot = modRoot
+		}
+	}
+
+	added := time.Now()
+	var replaces []replace
+	for _, t := range targets {
+		r := replace{
+			ModuleName: t.Module,
+			Profiles:   profiles,
+			Modules:    modules,
+			Note:       note,
+			Added:      added,
+			local:      local,
+		}
+
+		opts := addOptions{
+			missing:         missingPolicy{clone: clone, fromCache: fromCache},
+			resolveSymlinks: resolveSymlinks,
+			force:           force,
+		}
+		if err = resolveAddTarget(&r, t.Target, opts); err != nil {
+			return err
+		}
+		if len(relativeRoot) != 0 && !r.isRemote() && !r.mapped {
+			storeRelative(relativeRoot, &r, cmd.Flags().Changed("relative"))
+		}
+
+		if len(ref) != 0 {
+			if r.isRemote() || r.isWildcard() {
+				return errors.New("--branch and --commit can only be used with a local path")
+			}
+			if dryRun {
+				infof("would check out: %s in %s", ref, r.AbsPath)
+			} else if err = gitCheckout(r.AbsPath, ref); err != nil {
+				return errors.Wrapf(err, "failed to check out %s", ref)
+			} else {
+				infof("checked out %s in %s", ref, r.AbsPath)
+			}
+			r.Ref = ref
+		}
+
+		replaces = append(replaces, r)
+	}
+
+	if modRoot, err := findModuleRoot(); err == nil {
+		if !require {
+			warnUnusedReplaces(modRoot, replaces)
+		}
+		warnWorkspace(modRoot, replaces)
+	}
+
+	if replaces, err = addDependencyReplaces(replaces, deps); err != nil {
+		return err
+	}
+	if replaces, err = inlineNestedReplaces(replaces, inline); err != nil {
+		return err
+	}
+
+	tidy := false
+	if modRoot, err := findModuleRoot(); err == nil {
+		if tidy, err = tidyFlag(cmd, modRoot); err != nil {
+			return err
+		}
+	}
+
+	return storeReplaces(replaces, tidy, require)
+}
+
+// addArgs splits the arguments to add into the modules to replace and the
+// target for them. A second argument is a target when it's a path or a
+// module@version, otherwise every argument is a module using its default
+// path.
+func addArgs(args []string) []addTarget {
+	if len(args) == 2 {
+		target := args[1]
+		_, err := os.Stat(target)
+		if isRemoteTarget(target) || isLocalPath(target) || err == nil {
+			return []addTarget{{Module: args[0], Target: target}}
+		}
+	}
+
+	targets := make([]addTarget, len(args))
+	for i, arg := range args {
+		targets[i].Module = arg
+	}
+	return targets
+}
+
+// storeReplaces installs new replaces in the current module with a single
+// go.mod edit and records them, then tidies the module if tidy is set. With
+// require the modules that aren't dependencies yet are required first.
+func storeReplaces(newReplaces []replace, tidy, require bool) error {
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	lock, err := lockModule(modRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		return err
+	}
+	for i, r := range newReplaces {
+		if r.targetsMain() {
+			newReplaces[i].Require = mod.requiredVersion(r.ModuleName)
+		}
+	}
+
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return err
+	}
+	replaces, err := readGomrFile(gomrFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// Adding a module that's already stored replaces its entry, the stub
+	// generated for the old path is removed if it moved
+	var movedStubs []replace
+	for _, r := range newReplaces {
+		i := findReplace(replaces, r.ModuleName)
+		if i < 0 {
+			replaces = append(replaces, r)
+			continue
+		}
+
+		old := replaces[i]
+		if old.replacement() == r.replacement() {
+			infof("updating stored replace: %s => %s", old.ModuleName, old.replacement())
+		} else {
+			warnf("replacing stored replace: %s => %s", old.ModuleName, old.replacement())
+		}
+		if old.AddGoMod && !old.isRemote() && old.AbsPath != r.AbsPath {
+			movedStubs = append(movedStubs, old)
+		}
+		if len(old.Require) != 0 {
+			r.Require = old.Require
+		}
+		replaces[i] = r
+	}
+
+	files, err := moduleFiles(modRoot, append(replaces, movedStubs...))
+	if err != nil {
+		return err
+	}
+
+	var required []replace
+	if require {
+		required = unusedReplaces(modRoot, newReplaces)
+	}
+
+	var installs []replace
+	for _, r := range mainReplaces(newReplaces) {
+		if r.isWildcard() {
+			installs = append(installs, wildcardMatches(mod, r, replaces)...)
+		} else {
+			installs = append(installs, r)
+		}
+	}
+
+	err = recordOperation(modRoot, operationName("add", newReplaces), files, func() error {
+		if err := removeStubs(modRoot, movedStubs, false); err != nil {
+			return err
+		}
+
+		// If we need to add a go.mod do it before we add any replace lines
+		if err := createStubs(modRoot, installs); err != nil {
+			return err
+		}
+
+		if err := backupGoSum(modRoot); err != nil {
+			return err
+		}
+		if err := requireModules(modRoot, required); err != nil {
+			return err
+		}
+
+		// Write the replace lines into our current module's dir and any
+		// others the replaces are for
+		if err := addGoModReplaces(modRoot, installs); err != nil {
+			return err
+		}
+		if err := installTargeted(modRoot, newReplaces); err != nil {
+			return err
+		}
+
+		// Finally record it in our magic file
+		if err := writeGomrFile(gomrFilePath, replaces); err != nil {
+			return err
+		}
+
+		tidyModule(modRoot, tidy)
+		vendorModule(modRoot)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, r := range newReplaces {
+		if dryRun {
+			infof("would add replace: %s => %s", r.ModuleName, r.replacement())
+		} else {
+			infof("added replace: %s => %s", r.ModuleName, r.replacement())
+		}
+	}
+	for _, r := range installs {
+		if i := findReplace(newReplaces, r.ModuleName); i < 0 {
+			infof("  matched %s => %s", r.ModuleName, r.replacement())
+		}
+	}
+
+	return nil
+}
+
+// addOptions are how resolveAddTarget resolves the target of a new replace
+type addOptions struct {
+	missing         missingPolicy
+	resolveSymlinks bool
+	force           bool
 }
 
-var removeCmd = &cobra.Command{
-	Use:   "remove [flags] <package>",
-	Short: "Remove a replace from the current module",
-	RunE:  removeRun,
-	Args:  cobra.ExactArgs(1),
-}
+// resolveAddTarget checks the module of a new replace and resolves target
+// into it, either a remote module@version or a local path that must hold the
+// module. Everything that adds replaces goes through it so they all refuse
+// the same things before storing anything.
+func resolveAddTarget(r *replace, target string, opts addOptions) error {
+	if err := checkAddModule(r.ModuleName); err != nil {
+		return err
+	}
+
+	if isRemoteTarget(target) {
+		if err := validateRemoteTarget(target); err != nil {
+			return err
+		}
+		r.Target = target
+		return nil
+	}
+
+	if err := resolveAddPath(r, target, opts.missing); err != nil {
+		return err
+	}
+	if opts.resolveSymlinks && !r.mapped {
+		resolvePathSymlinks(r)
+	}
+	matchMajorVersion(r)
+	return checkModuleMatch(*r, opts.force)
+}
+
+// checkAddModule checks that moduleName is a module path, or a wildcard
+// prefix of one, that a replace can be added for
+func checkAddModule(moduleName string) error {
+	if err := checkWildcard(moduleName); err != nil {
+		return err
+	}
+	return validateModulePath(moduleName)
+}
+
+// resolveAddPath finds the directory for a new local replace, using the
+// path mappings or GOPATH if path is empty, and checks whether it needs a
+// go.mod generated for it. A missing checkout is an error unless missing
+// says to clone it or, without a path, it can be copied from the module
+// cache.
+func resolveAddPath(r *replace, path string, missing missingPolicy) error {
+	cloneDir := path
+	if len(path) == 0 {
+		var err error
+		if path, r.mapped, err = defaultModulePath(r.ModuleName); err != nil {
+			return err
+		}
+	}
+
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+
+	// Wildcards point at the directory their modules are checked out in
+	if r.isWildcard() {
+		if filepath.Base(absPath) == "*" {
+			absPath = filepath.Dir(absPath)
+		}
+		if _, err := os.Stat(absPath); os.IsNotExist(err) {
+			return withExitCode(exitMissing, errors.Wrapf(err, "wildcard dir %s", absPath))
+		} else if err != nil {
+			return errors.Wrapf(err, "wildcard dir %s", absPath)
+		}
+		r.AbsPath = filepath.Join(absPath, "*")
+		return nil
+	}
+
+	// If the path doesn't exist on disk clone it, copy it or bail
+	if _, err := os.Stat(absPath); os.IsNotExist(err) && !missing.clone {
+		copied := false
+		if len(cloneDir) == 0 {
+			if copied, err = copyFromModuleCache(r, absPath, missing.fromCache); err != nil {
+				return err
+			}
+		}
+		if !copied {
+			return withExitCode(exitMissing, fmt.Errorf("path %s does not exist", absPath))
+		}
+		r.mapped = false
+	} else if os.IsNotExist(err) {
+		if dryRun {
+			infof("would clone: %s into %s", r.ModuleName, cloneDir)
+			r.AbsPath = absPath
+			r.AddGoMod = true
+			return nil
+		}
+
+		modDir, err := cloneModule(r.ModuleName, cloneDir)
+		if err != nil {
+			return err
+		}
+
+		// The repository root may not be where the mappings put the module
+		r.mapped = r.mapped && modDir == absPath
+		absPath = modDir
+	} else if err != nil {
+		return err
+	}
+	r.AbsPath = absPath
+
+	// Check to see if the path has a go.mod
+	if _, err := os.Stat(filepath.Join(absPath, "go.mod")); os.IsNotExist(err) {
+		r.AddGoMod = true
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// resolvePathSymlinks replaces the path of a local replace with its real
+// path, so the same checkout is always stored the same way however it was
+// reached. A path that can't be resolved, like a clone that only happens
+// later in a dry run, is kept as it is.
+func resolvePathSymlinks(r *replace) {
+	realPath, err := filepath.EvalSymlinks(r.rootPath())
+	if err != nil {
+		debugf("failed to resolve symlinks in %s: %v", r.rootPath(), err)
+		return
+	}
+
+	if r.isWildcard() {
+		realPath = filepath.Join(realPath, "*")
+	}
+	if realPath != r.AbsPath {
+		debugf("resolved %s to %s", r.AbsPath, realPath)
+		r.AbsPath = realPath
+	}
+}
+
+// checkModuleMatch makes sure the go.mod in a replace's directory declares
+// the module being replaced, with force a mismatch is only a warning.
+func checkModuleMatch(r replace, force bool) error {
+	if r.AddGoMod || r.isWildcard() {
+		return nil
+	}
+
+	modulePath, err := readModulePath(r.AbsPath)
+	if err != nil {
+		return err
+	}
+	if modulePath == r.ModuleName {
+		return nil
+	}
+
+	if !force {
+		return fmt.Errorf("%s declares module %s, not %s (use --force to add it anyway)", r.AbsPath, modulePath, r.ModuleName)
+	}
+
+	warnf("%s declares module %s, not %s", r.AbsPath, modulePath, r.ModuleName)
+	return nil
+}
+
+// defaultModulePath returns where the source for moduleName is expected to
+// be checked out when no path is given. Replaces found using the path
+// mappings are reported as mapped, they're stored without a path so each
+// machine resolves them with its own mappings.
+func defaultModulePath(moduleName string) (string, bool, error) {
+	mappings, err := readPathMappings()
+	if err != nil {
+		return "", false, err
+	}
+
+	if path, ok := mapModulePath(mappings, moduleName); ok {
+		return path, true, nil
+	}
+
+	// Try to pull this from GOPATH
+	path, err := gopathSource(moduleName)
+	return path, false, err
+}
+
+// isRemoteTarget checks if the target given to add is a module@version
+// rather than a directory.
+func isRemoteTarget(target string) bool {
+	return len(target) != 0 && !isLocalPath(target) && strings.Contains(target, "@")
+}
+
+func removeRun(cmd *cobra.Command, args []string) error {
+	all, err := cmd.Flags().GetBool("all")
+	if err != nil {
+		return err
+	}
+	yes, err := cmd.Flags().GetBool("yes")
+	if err != nil {
+		return err
+	}
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
+
+	if all && len(args) != 0 {
+		return errors.New("no packages can be given with --all")
+	}
+
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+	tidy, err := tidyFlag(cmd, modRoot)
+	if err != nil {
+		return err
+	}
+
+	// Without any packages let the user pick them, before taking the lock so
+	// other gomr commands don't wait on the user
+	if !all && len(args) == 0 {
+		if !stdinIsTerminal() {
+			return errors.New("a package or --all is required")
+		}
+		if args, err = pickStoredReplaces(modRoot, "replaces to remove"); err != nil {
+			return err
+		}
+		if len(args) == 0 {
+			infof("nothing removed")
+			return nil
+		}
+	}
+
+	lock, err := lockModule(modRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return err
+	}
+
+	replaces, err := readGomrFile(gomrFilePath)
+	if err != nil {
+		return err
+	}
+
+	if all {
+		if len(replaces) == 0 {
+			infof("no stored replaces to remove")
+			return nil
+		}
+		if !yes {
+			ok, err := confirm(fmt.Sprintf("remove all %d stored replaces?", len(replaces)))
+			if err != nil || !ok {
+				return err
+			}
+		}
+		for _, r := range replaces {
+			args = append(args, r.ModuleName)
+		}
+	}
+
+	var deleted []replace
+	for _, moduleName := range args {
+		i := lookupReplace(replaces, moduleName)
+		if i < 0 {
+			warnf("could not find stored replace for module: %s", moduleName)
+			continue
+		}
+
+		deleted = append(deleted, replaces[i])
+		replaces = append(replaces[:i], replaces[i+1:]...)
+	}
+
+	if len(deleted) == 0 {
+		return nil
+	}
+
+	files, err := moduleFiles(modRoot, deleted)
+	if err != nil {
+		return err
+	}
+
+	err = recordOperation(modRoot, operationName("remove", deleted), files, func() error {
+		for _, r := range deleted {
+			if err := dropStoredReplace(modRoot, r, replaces, force); err != nil {
+				return err
+			}
+		}
+
+		// Persist our new set of replaces
+		if err := writeGomrFile(gomrFilePath, replaces); err != nil {
+			return errors.Wrap(err, "failed to write gomr file after remove")
+		}
+
+		if err := restoreGoSum(modRoot); err != nil {
+			return err
+		}
+
+		tidyModule(modRoot, tidy)
+		vendorModule(modRoot)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
 
-var upCmd = &cobra.Command{
-	Use:   "up [flags]",
-	Short: "Add all stored replace lines to go.mod",
-	RunE:  upRun,
+	for _, r := range deleted {
+		if dryRun {
+			infof("would delete replace: %s => %s", r.ModuleName, r.replacement())
+		} else {
+			infof("deleted replace: %s => %s", r.ModuleName, r.replacement())
+		}
+	}
+	return nil
 }
 
-var downCmd = &cobra.Command{
-	Use:   "down [flags]",
-	Short: "Remove all stored replace lines from go.mod",
-	RunE:  downRun,
-}
+// dropStoredReplace undoes everything a replace that's being removed did to
+// the module in modRoot, remaining are the replaces that are kept. See
+// removeStubs for force.
+func dropStoredReplace(modRoot string, deleted replace, remaining []replace, force bool) error {
+	// First undo the replace we've added and put back the require version
+	editArgs := []string{"edit", fmt.Sprintf("-dropreplace=%s", deleted.ModuleName)}
+	if deleted.isWildcard() {
+		mod, err := readGoMod(modRoot)
+		if err != nil {
+			return err
+		}
+		matches := appliedReplaces(mod, wildcardMatches(mod, deleted, remaining))
+		editArgs = append([]string{"edit"}, dropReplaceFlags(matches)...)
+	}
+	if len(deleted.Require) != 0 {
+		editArgs = append(editArgs, fmt.Sprintf("-require=%s@%s", deleted.ModuleName, deleted.Require))
+	}
+	if len(editArgs) > 1 {
+		if err := gomod(modRoot, editArgs...); err != nil {
+			return err
+		}
+	}
+	if err := uninstallTargeted(modRoot, []replace{deleted}); err != nil {
+		return err
+	}
 
-var rootCmd = &cobra.Command{
-	Use:   "gomr [flags] <command>",
-	Short: "Manages replaces in Go modules",
+	// Then remove the go.mod if we added one
+	return removeStubs(modRoot, []replace{deleted}, force)
 }
 
-func main() {
-	rootCmd.AddCommand(addCmd, removeCmd, upCmd, downCmd)
-
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
+// confirm asks a yes or no question on stdin, anything but yes is a no. It
+// fails when stdin isn't a terminal so scripts don't hang on the prompt.
+func confirm(question string) (bool, error) {
+	if !stdinIsTerminal() {
+		return false, errors.New("refusing to ask for confirmation when stdin is not a terminal, use --yes")
 	}
+
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
 }
 
-func addRun(cmd *cobra.Command, args []string) error {
-	moduleName := args[0]
-	var absPath string
-	if len(args) > 1 {
-		absPath = args[1]
+func upRun(cmd *cobra.Command, args []string) error {
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
 	}
 
-	if len(absPath) == 0 {
-		// Try to pull this from GOPATH
-		absPath = filepath.Join(os.Getenv("GOPATH"), "src", moduleName)
+	profile, err := profileFlag(cmd, modRoot)
+	if err != nil {
+		return err
 	}
 
-	// If the path doesn't exist on disk bail
-	if _, err := os.Stat(absPath); os.IsNotExist(err) {
-		return fmt.Errorf("path %s does not exist", absPath)
-	} else if err != nil {
+	lock, err := lockModule(modRoot)
+	if err != nil {
 		return err
 	}
+	defer lock.unlock()
 
-	// Check to see if the path has a go.mod
-	addGoMod := false
-	if _, err := os.Stat(filepath.Join(absPath, "go.mod")); os.IsNotExist(err) {
-		addGoMod = true
-	} else if err != nil {
+	if err = adoptFlag(cmd, modRoot, profile); err != nil {
 		return err
 	}
 
-	modRoot, err := findModuleRoot()
+	replaces, err := readReplaces(modRoot, profile)
 	if err != nil {
 		return err
 	}
+	if replaces, err = selectReplaces(replaces, args); err != nil {
+		return err
+	}
 
-	// If we need to add a go.mod do it before we add any replace lines
-	if addGoMod {
-		if err := gomod(absPath, "init", moduleName); err != nil {
-			return errors.Wrapf(err, "failed to go mod init in dir: %s", absPath)
-		}
+	if len(replaces) == 0 {
+		infof("no replace lines to install")
+		return nil
 	}
 
-	// Write a replace line into our current module's dir
-	err = gomod(modRoot, "edit", fmt.Sprintf("-replace=%s=%s", moduleName, absPath))
+	nested, err := recursiveModules(cmd, modRoot)
 	if err != nil {
 		return err
 	}
 
-	// Finally record it in our magic file
-	file, err := os.OpenFile(filepath.Join(modRoot, gomrFilename), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0664)
+	workspace, err := cmd.Flags().GetBool("workspace")
 	if err != nil {
-		return errors.Wrapf(err, "failed to open %s file for writing", gomrFilename)
+		return err
+	}
+
+	if !workspace {
+		installed, err := replacesInstalled(modRoot, replaces, nested)
+		if err != nil {
+			return err
+		}
+		if installed {
+			infof("already up to date")
+			return nil
+		}
 	}
 
-	fmtStr := "%s %s"
-	if addGoMod {
-		fmtStr = "%s !%s"
+	return withLifecycleHooks(cmd, modRoot, "up", replaces, lock, func() error {
+		if workspace {
+			goWork, err := workspaceGoWork(modRoot)
+			if err != nil {
+				return err
+			}
+			return upWorkspace(modRoot, goWork, replaces)
+		}
+		warnWorkspace(modRoot, replaces)
+		warnUnmanaged(modRoot, "up", replaces, true)
+
+		tidy, err := tidyFlag(cmd, modRoot)
+		if err != nil {
+			return err
+		}
+
+		return upReplaces(modRoot, replaces, nested, tidy)
+	})
+}
+
+// upReplaces installs the replaces in the module in modRoot and the nested
+// modules in a single transaction, the caller must hold the module lock.
+// The module is tidied afterwards if tidy is set.
+func upReplaces(modRoot string, replaces []replace, nested []string, tidy bool) error {
+	files, err := moduleFiles(modRoot, replaces)
+	if err != nil {
+		return err
 	}
-	if _, err = fmt.Fprintf(file, fmtStr, moduleName, absPath); err != nil {
-		return errors.Wrapf(err, "failed to write to %s", gomrFilename)
+
+	files = append(files, nestedFiles(nested)...)
+	tx, err := beginTransaction(files...)
+	if err != nil {
+		return err
 	}
 
-	if err = file.Close(); err != nil {
-		return errors.Wrapf(err, "failed to close %s file", gomrFilename)
+	changed := 0
+	err = recordOperation(modRoot, operationName("up", replaces), files, func() error {
+		err := tx.run(func() error {
+			err := recordRequires(modRoot, replaces)
+			if err != nil {
+				return err
+			}
+			if err = backupGoSum(modRoot); err != nil {
+				return err
+			}
+			if err = installReplaces(modRoot, replaces); err != nil {
+				return err
+			}
+			changed, err = installNested(nested, untargetedReplaces(replaces))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		tidyModule(modRoot, tidy)
+		vendorModule(modRoot)
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	fmt.Printf("added replace: %s => %s\n", moduleName, absPath)
+	if dryRun {
+		infof("would install replace lines")
+		if changed != 0 {
+			infof("would install replace lines in %d other module(s)", changed)
+		}
+		return nil
+	}
 
+	infof("replace lines installed")
+	if changed != 0 {
+		infof("replace lines installed in %d other module(s)", changed)
+	}
 	return nil
 }
 
-func removeRun(cmd *cobra.Command, args []string) error {
-	moduleName := args[0]
-
+func downRun(cmd *cobra.Command, args []string) error {
 	modRoot, err := findModuleRoot()
 	if err != nil {
 		return err
 	}
 
-	gomrFilePath := filepath.Join(modRoot, gomrFilename)
+	profile, err := profileFlag(cmd, modRoot)
+	if err != nil {
+		return err
+	}
 
-	replaces, err := readGomrFile(gomrFilePath)
+	lock, err := lockModule(modRoot)
 	if err != nil {
 		return err
 	}
+	defer lock.unlock()
 
-	found := false
-	var deleted replace
-	for i := 0; i < len(replaces); i++ {
-		if strings.ToLower(replaces[i].ModuleName) == strings.ToLower(moduleName) {
-			deleted = replaces[i]
-			replaces[i] = replaces[len(replaces)-1]
-			replaces = replaces[:len(replaces)-1]
-			found = true
-		}
+	if err = adoptFlag(cmd, modRoot, profile); err != nil {
+		return err
+	}
+
+	replaces, err := readReplaces(modRoot, profile)
+	if err != nil {
+		return err
+	}
+	if replaces, err = selectReplaces(replaces, args); err != nil {
+		return err
 	}
 
-	if !found {
-		fmt.Printf("could not find stored replace for module: %s\n", moduleName)
+	if len(replaces) == 0 {
+		infof("no replace lines to remove")
 		return nil
 	}
 
-	// First undo the replace we've added
-	err = gomod("", "edit", fmt.Sprintf("-dropreplace=%s", moduleName))
+	nested, err := recursiveModules(cmd, modRoot)
 	if err != nil {
 		return err
 	}
 
-	// Then remove the go.mod if we added one
-	if deleted.AddGoMod {
-		err = os.Remove(filepath.Join(deleted.AbsPath, "go.mod"))
-		if err != nil && !os.IsNotExist(err) {
-			return errors.Wrap(err, "something went wrong when trying to delete the added go.mod")
-		}
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
 
-		err = os.Remove(filepath.Join(deleted.AbsPath, "go.sum"))
-		if err != nil && !os.IsNotExist(err) {
-			return errors.Wrap(err, "something went wrong when trying to delete the added go.sum")
-		}
+	workspace, err := cmd.Flags().GetBool("workspace")
+	if err != nil {
+		return err
 	}
 
-	// Persist our new set of replaces
-	if err = writeGomrFile(gomrFilePath, replaces); err != nil {
-		return errors.Wrap(err, "failed to write gomr file after remove")
+	if !workspace {
+		removed, err := replacesRemoved(modRoot, replaces, nested, force)
+		if err != nil {
+			return err
+		}
+		if removed {
+			infof("already up to date")
+			return nil
+		}
 	}
 
-	fmt.Printf("deleted replace: %s => %s\n", deleted.ModuleName, deleted.AbsPath)
-	return nil
+	return withLifecycleHooks(cmd, modRoot, "down", replaces, lock, func() error {
+		if workspace {
+			goWork, err := workspaceGoWork(modRoot)
+			if err != nil {
+				return err
+			}
+			return downWorkspace(modRoot, goWork, replaces, force)
+		}
+
+		warnUnmanaged(modRoot, "down", replaces, false)
+
+		tidy, err := tidyFlag(cmd, modRoot)
+		if err != nil {
+			return err
+		}
+
+		return downReplaces(modRoot, replaces, nested, force, tidy)
+	})
 }
 
-func upRun(cmd *cobra.Command, args []string) error {
-	modRoot, err := findModuleRoot()
+// downReplaces removes the replaces from the module in modRoot and the
+// nested modules in a single transaction, the caller must hold the module
+// lock. See removeStubs for force. The module is tidied afterwards if tidy is
+// set.
+func downReplaces(modRoot string, replaces []replace, nested []string, force, tidy bool) error {
+	files, err := moduleFiles(modRoot, replaces)
 	if err != nil {
 		return err
 	}
 
-	gomrFilePath := filepath.Join(modRoot, gomrFilename)
-	replaces, err := readGomrFile(gomrFilePath)
+	files = append(files, nestedFiles(nested)...)
+	tx, err := beginTransaction(files...)
 	if err != nil {
 		return err
 	}
 
-	var replaceArgs []string
-	for _, r := range replaces {
-		// Add the go.mod if we need it
-		if r.AddGoMod {
-			if err := gomod(r.AbsPath, "init", r.ModuleName); err != nil {
-				return errors.Wrapf(err, "failed to go mod init in dir: %s", r.AbsPath)
+	changed := 0
+	err = recordOperation(modRoot, operationName("down", replaces), files, func() error {
+		err := tx.run(func() error {
+			var err error
+			if changed, err = uninstallNested(nested, untargetedReplaces(replaces)); err != nil {
+				return err
+			}
+			if err = uninstallReplaces(modRoot, replaces, force); err != nil {
+				return err
 			}
+			if err = restoreRequires(modRoot, replaces); err != nil {
+				return err
+			}
+			return restoreGoSum(modRoot)
+		})
+		if err != nil {
+			return err
 		}
-		replaceArgs = append(replaceArgs, fmt.Sprintf("-replace=%s=%s", r.ModuleName, r.AbsPath))
-	}
 
-	// Add the replace lines to our go.mod
-	err = gomod("", append([]string{"edit"}, replaceArgs...)...)
+		tidyModule(modRoot, tidy)
+		vendorModule(modRoot)
+		return nil
+	})
 	if err != nil {
 		return err
 	}
 
-	fmt.Println("replace lines installed")
+	if dryRun {
+		infof("would remove replace lines")
+		if changed != 0 {
+			infof("would remove replace lines from %d other module(s)", changed)
+		}
+		return nil
+	}
+
+	infof("replace lines removed")
+	if changed != 0 {
+		infof("replace lines removed from %d other module(s)", changed)
+	}
 	return nil
 }
 
-func downRun(cmd *cobra.Command, args []string) error {
+// recursiveModules returns the other modules in the repository when cmd's
+// --recursive flag is set.
+func recursiveModules(cmd *cobra.Command, modRoot string) ([]string, error) {
+	recursive, err := cmd.Flags().GetBool("recursive")
+	if err != nil || !recursive {
+		return nil, err
+	}
+
+	return nestedModules(modRoot)
+}
+
+// loadReplaces finds the current module root and reads the replaces stored
+// for it that are in the profile selected for cmd.
+func loadReplaces(cmd *cobra.Command) (string, []replace, error) {
 	modRoot, err := findModuleRoot()
 	if err != nil {
-		return err
+		return "", nil, err
 	}
 
-	gomrFilePath := filepath.Join(modRoot, gomrFilename)
-	replaces, err := readGomrFile(gomrFilePath)
+	profile, err := profileFlag(cmd, modRoot)
 	if err != nil {
-		return err
+		return "", nil, err
 	}
 
-	var replaceArgs []string
-	for _, r := range replaces {
-		// Add the go.mod if we need it
-		if r.AddGoMod {
-			err = os.Remove(filepath.Join(r.AbsPath, "go.mod"))
-			if err != nil && !os.IsNotExist(err) {
-				return errors.Wrap(err, "something went wrong when trying to delete the added go.mod")
-			}
-		}
-		replaceArgs = append(replaceArgs, fmt.Sprintf("-dropreplace=%s", r.ModuleName))
+	replaces, err := readReplaces(modRoot, profile)
+	if err != nil {
+		return "", nil, err
 	}
 
-	// Add the replace lines to our go.mod
-	err = gomod("", append([]string{"edit"}, replaceArgs...)...)
+	return modRoot, replaces, nil
+}
+
+// profileFlag returns the value of cmd's --profile flag, or the project's
+// default profile if the flag wasn't given.
+func profileFlag(cmd *cobra.Command, modRoot string) (string, error) {
+	flag := cmd.Flags().Lookup("profile")
+	if flag == nil {
+		return "", nil
+	}
+	if flag.Changed {
+		return flag.Value.String(), nil
+	}
+
+	cfg, err := loadConfig(modRoot)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	fmt.Println("replace lines removed")
-	return nil
+	return cfg.Profile, nil
 }
 
-type replace struct {
-	ModuleName string
-	AbsPath    string
-	AddGoMod   bool
-}
+// readReplaces reads the replaces stored for the module in modRoot that are
+// in profile.
+func readReplaces(modRoot, profile string) ([]replace, error) {
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return nil, err
+	}
 
-func readGomrFile(path string) ([]replace, error) {
-	gomrFile, err := os.Open(path)
+	replaces, err := readGomrFile(gomrFilePath)
 	if err != nil {
 		return nil, err
 	}
 
-	var replaces []replace
+	return enabledReplaces(filterProfile(replaces, profile)), nil
+}
 
-	scanner := bufio.NewScanner(gomrFile)
-	for scanner.Scan() {
-		var r replace
+// selectReplaces returns the replaces for the named modules, or all of
+// them if no names are given.
+func selectReplaces(replaces []replace, names []string) ([]replace, error) {
+	if len(names) == 0 {
+		return replaces, nil
+	}
 
-		splits := strings.Fields(scanner.Text())
+	selected := make([]replace, 0, len(names))
+	for _, name := range names {
+		i := lookupReplace(replaces, name)
+		if i < 0 {
+			return nil, fmt.Errorf("could not find stored replace for module: %s", name)
+		}
+		selected = append(selected, replaces[i])
+	}
 
-		r.ModuleName = splits[0]
-		if strings.HasPrefix(splits[1], "!") {
-			r.AbsPath = splits[1][1:]
-			r.AddGoMod = true
-		} else {
-			r.AbsPath = splits[1]
+	return selected, nil
+}
+
+// recordRequires stores the version go.mod currently requires for each of
+// the replaces that aren't installed yet, so that down can restore it.
+func recordRequires(modRoot string, replaces []replace) error {
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		return err
+	}
+
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return err
+	}
+	stored, err := readGomrFile(gomrFilePath)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for _, r := range unappliedReplaces(mod, mainReplaces(replaces)) {
+		version := mod.requiredVersion(r.ModuleName)
+		i := findReplace(stored, r.ModuleName)
+		if i < 0 || stored[i].Require == version {
+			continue
 		}
 
-		replaces = append(replaces, r)
+		stored[i].Require = version
+		changed = true
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+	if !changed {
+		return nil
 	}
 
-	return replaces, nil
+	return writeGomrFile(gomrFilePath, stored)
 }
 
-func writeGomrFile(path string, replaces []replace) error {
-	f, err := os.Create(path)
+// restoreRequires sets the require lines of the replaced modules back to the
+// versions recorded by recordRequires and forgets the recorded versions.
+func restoreRequires(modRoot string, replaces []replace) error {
+	requireArgs := requireFlags(replaces)
+	if len(requireArgs) == 0 {
+		return nil
+	}
+
+	if err := gomod(modRoot, append([]string{"edit"}, requireArgs...)...); err != nil {
+		return errors.Wrap(err, "failed to restore required versions")
+	}
+
+	gomrFilePath, err := storeFilePath(modRoot)
 	if err != nil {
-		return errors.Wrapf(err, "failed to open %s file for writing", gomrFilename)
+		return err
+	}
+	stored, err := readGomrFile(gomrFilePath)
+	if err != nil {
+		return err
 	}
 
 	for _, r := range replaces {
-		absPath := r.AbsPath
-		if r.AddGoMod {
-			absPath = "!" + absPath
+		if i := findReplace(stored, r.ModuleName); i >= 0 {
+			stored[i].Require = ""
 		}
-		if _, err = fmt.Fprintln(f, "%s %s", r.ModuleName, absPath); err != nil {
-			return err
+	}
+
+	return writeGomrFile(gomrFilePath, stored)
+}
+
+// installReplaces adds the replace lines to the go.mod in modRoot, creating
+// any go.mod files the replaces need first.
+func installReplaces(modRoot string, replaces []replace) error {
+	if err := installTargeted(modRoot, replaces); err != nil {
+		return err
+	}
+
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		return err
+	}
+	replaces = expandWildcards(mod, mainReplaces(replaces))
+	if len(replaces) == 0 {
+		return nil
+	}
+
+	if err := createStubs(modRoot, replaces); err != nil {
+		return err
+	}
+
+	// Add the replace lines to our go.mod
+	return gomod(modRoot, append([]string{"edit"}, replaceFlags(replaces)...)...)
+}
+
+// replaceFlags creates the go mod edit flags that add the replaces
+func replaceFlags(replaces []replace) []string {
+	var replaceArgs []string
+	for _, r := range replaces {
+		replaceArgs = append(replaceArgs, fmt.Sprintf("-replace=%s=%s", r.ModuleName, r.replacement()))
+	}
+
+	return replaceArgs
+}
+
+// requireFlags creates the go mod edit flags that set the require lines
+// back to the versions recorded by recordRequires
+func requireFlags(replaces []replace) []string {
+	var requireArgs []string
+	for _, r := range replaces {
+		if len(r.Require) != 0 {
+			requireArgs = append(requireArgs, fmt.Sprintf("-require=%s@%s", r.ModuleName, r.Require))
 		}
 	}
 
-	if err = f.Close(); err != nil {
-		return errors.Wrapf(err, "failed to close %s file write", gomrFilename)
+	return requireArgs
+}
+
+// dropReplaceFlags creates the go mod edit flags that remove the replaces
+func dropReplaceFlags(replaces []replace) []string {
+	var replaceArgs []string
+	for _, r := range replaces {
+		replaceArgs = append(replaceArgs, fmt.Sprintf("-dropreplace=%s", r.ModuleName))
+	}
+
+	return replaceArgs
+}
+
+// uninstallReplaces drops the replace lines from the go.mod in modRoot and
+// deletes any go.mod files that were created for the replaces, see
+// removeStubs for force.
+func uninstallReplaces(modRoot string, replaces []replace, force bool) error {
+	if err := uninstallTargeted(modRoot, replaces); err != nil {
+		return err
 	}
 
-	return nil
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		return err
+	}
+	replaces = expandWildcards(mod, replaces)
+
+	// Remove the go.mod files we added
+	if err = removeStubs(modRoot, replaces, force); err != nil {
+		return err
+	}
+
+	// Drop the replace lines from our go.mod
+	replaces = mainReplaces(replaces)
+	if len(replaces) == 0 {
+		return nil
+	}
+	return gomod(modRoot, append([]string{"edit"}, dropReplaceFlags(replaces)...)...)
+}
+
+// gomodOutput runs a go mod command and returns its stdout
+func gomodOutput(dir string, args ...string) ([]byte, error) {
+	return goOutput(dir, append([]string{"mod"}, args...)...)
+}
+
+// goOutput runs a go command and returns its stdout
+func goOutput(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command(goCommand(), args...)
+	if len(dir) != 0 {
+		cmd.Dir = dir
+	}
+	cmd.Stderr = os.Stderr
+	debugf("running: go %s (in %s)", strings.Join(args, " "), cmd.Dir)
+	return cmd.Output()
 }
 
-func gomod(dir string, args ...string) error {
+// runGoMod runs go mod with the args in dir, regardless of --dry-run
+func runGoMod(dir string, args ...string) error {
 	arguments := append([]string{"mod"}, args...)
-	cmd := exec.Command("go", arguments...)
+	cmd := exec.Command(goCommand(), arguments...)
 	if len(dir) != 0 {
 		cmd.Dir = dir
 	}
+	debugf("running: go %s (in %s)", strings.Join(arguments, " "), cmd.Dir)
 	b, err := cmd.CombinedOutput()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s\n", b)
 		return err
 	}
+	if out := strings.TrimSpace(string(b)); len(out) != 0 {
+		debugf("%s", out)
+	}
 
 	return nil
 }
@@ -340,6 +1486,7 @@ func findModuleRoot() (string, error) {
 		f, err := os.Stat(filepath.Join(d, "go.mod"))
 		if err != nil {
 			if os.IsNotExist(err) {
+				d = filepath.Dir(d)
 				continue
 			}
 
@@ -350,6 +1497,8 @@ func findModuleRoot() (string, error) {
 			// Successfully stat'd go.mod
 			return d, nil
 		}
+
+		d = filepath.Dir(d)
 	}
 
 	return "", errors.New("could not find a go.mod in the working directory or it's parents")
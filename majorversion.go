@@ -0,0 +1,93 @@
+package main
+
+import (
+	"strings"
+)
+
+// majorPrefix returns the module path without its major version suffix,
+// like example.com/mod for example.com/mod/v3. Paths without one, which is
+// everything at v0 and v1, are returned as they are.
+func majorPrefix(modulePath string) string {
+	i := strings.LastIndex(modulePath, "/v")
+	if i < 0 {
+		return modulePath
+	}
+
+	digits := modulePath[i+2:]
+	if len(digits) == 0 || digits[0] == '0' || digits == "1" {
+		return modulePath
+	}
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return modulePath
+		}
+	}
+
+	return modulePath[:i]
+}
+
+// sameModuleMajorless checks if a and b are the same module path once any
+// major version suffixes are ignored
+func sameModuleMajorless(a, b string) bool {
+	return strings.ToLower(majorPrefix(a)) == strings.ToLower(majorPrefix(b))
+}
+
+// lookupReplace is findReplace for a module named by the user, who may have
+// left the major version suffix off or added one. An exact match wins,
+// otherwise the module matches if it's the only one that's the same apart
+// from the suffix.
+func lookupReplace(replaces []replace, moduleName string) int {
+	if i := findReplace(replaces, moduleName); i >= 0 {
+		return i
+	}
+
+	found := -1
+	for i, r := range replaces {
+		if !sameModuleMajorless(r.ModuleName, moduleName) {
+			continue
+		}
+		if found >= 0 {
+			return -1
+		}
+		found = i
+	}
+
+	return found
+}
+
+// matchMajorVersion fixes up the module path of a new local replace when it
+// differs from the right one only by its major version suffix: the path the
+// target's go.mod declares, or for a target without one the path the current
+// module requires, which is what its generated go.mod is created with.
+func matchMajorVersion(r *replace) {
+	if r.isWildcard() {
+		return
+	}
+
+	modulePath, reason := r.ModuleName, "the module "+r.AbsPath+" declares"
+	if !r.AddGoMod {
+		declared, err := readModulePath(r.AbsPath)
+		if err != nil {
+			return
+		}
+		modulePath = declared
+	} else if modRoot, err := findModuleRoot(); err == nil {
+		mod, err := parseGoMod(modRoot)
+		if err != nil {
+			return
+		}
+		for _, req := range mod.Require {
+			if req.Path == r.ModuleName {
+				return
+			}
+			if sameModuleMajorless(req.Path, r.ModuleName) {
+				modulePath, reason = req.Path, "the version go.mod requires"
+			}
+		}
+	}
+
+	if modulePath != r.ModuleName && sameModuleMajorless(modulePath, r.ModuleName) {
+		infof("using %s instead of %s, it's %s", modulePath, r.ModuleName, reason)
+		r.ModuleName = modulePath
+	}
+}
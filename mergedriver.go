@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// mergeDriverName is the name of the merge driver in git config and
+// .gitattributes
+const mergeDriverName = "gomr"
+
+// mergeDriverAttribute is the .gitattributes line that makes git use the
+// merge driver for gomr files
+const mergeDriverAttribute = gomrFilename + " merge=" + mergeDriverName
+
+var mergeDriverCmd = &cobra.Command{
+	Use:   "merge-driver <ancestor> <current> <other>",
+	Short: "Merge gomr files, run by git as a merge driver",
+	Long: `Merge gomr files, run by git as a merge driver
+
+Git runs this with the common ancestor, the current and the other version of
+a gomr file and it merges them a replace at a time, so two branches adding,
+changing or removing replaces for different modules merge cleanly. The
+result is written over the current version. Only when both branches changed
+the same module differently are conflict markers written around the two
+versions of that replace and the merge fails.
+
+Use merge-driver install to set up git to use it.`,
+	RunE:         mergeDriverRun,
+	Args:         cobra.ExactArgs(3),
+	SilenceUsage: true,
+}
+
+var mergeDriverInstallCmd = &cobra.Command{
+	Use:   "install",
+	Short: "Set up git to merge gomr files with the merge driver",
+	Long: `Set up git to merge gomr files with the merge driver
+
+Adds the merge driver to the repository's git config and a line to the
+.gitattributes in the module root that makes git use it for ` + gomrFilename + `.
+Commit .gitattributes so teammates only have to run merge-driver install
+for the git config.`,
+	RunE:         mergeDriverInstallRun,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+}
+
+var mergeDriverUninstallCmd = &cobra.Command{
+	Use:          "uninstall",
+	Short:        "Remove the merge driver from git config and .gitattributes",
+	RunE:         mergeDriverUninstallRun,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+}
+
+func mergeDriverRun(cmd *cobra.Command, args []string) error {
+	var files [3]gomrFile
+	for i, path := range args {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read %s", path)
+		}
+		if files[i], err = parseGomrFile(b); err != nil {
+			return errors.Wrapf(err, "failed to parse %s", path)
+		}
+	}
+
+	merged, conflicts := mergeReplaces(files[0].Replaces, files[1].Replaces, files[2].Replaces)
+
+	var buf bytes.Buffer
+	buf.Write(formatGomrFile(gomrFile{Preamble: files[1].Preamble, Replaces: sortReplaces(merged)}))
+	for _, c := range conflicts {
+		buf.WriteString("\n<<<<<<< current\n")
+		if c[0] != nil {
+			formatReplace(&buf, *c[0])
+		}
+		buf.WriteString("=======\n")
+		if c[1] != nil {
+			formatReplace(&buf, *c[1])
+		}
+		buf.WriteString(">>>>>>> other\n")
+	}
+
+	if err := ioutil.WriteFile(args[1], buf.Bytes(), 0664); err != nil {
+		return errors.Wrapf(err, "failed to write %s", args[1])
+	}
+
+	if len(conflicts) != 0 {
+		var modules []string
+		for _, c := range conflicts {
+			if c[0] != nil {
+				modules = append(modules, c[0].ModuleName)
+			} else {
+				modules = append(modules, c[1].ModuleName)
+			}
+		}
+		return fmt.Errorf("both sides changed the replaces for: %s", strings.Join(modules, ", "))
+	}
+
+	return nil
+}
+
+// mergeReplaces does a three way merge of the replaces in a gomr file, per
+// module. A module that only one side changed, added or removed gets that
+// side's version. The modules both sides changed differently are returned
+// as conflicts, each holding the current and other version (nil if removed).
+func mergeReplaces(ancestor, current, other []replace) ([]replace, [][2]*replace) {
+	var modules []string
+	versions := make(map[string][3]*replace)
+	for side, replaces := range [][]replace{ancestor, current, other} {
+		for i := range replaces {
+			r := &replaces[i]
+			// Without a path the module's path comes from the path mappings
+			if len(r.AbsPath) == 0 && !r.isRemote() {
+				r.mapped = true
+			}
+
+			key := strings.ToLower(r.ModuleName)
+			v, ok := versions[key]
+			if !ok {
+				modules = append(modules, key)
+			}
+			if v[side] == nil {
+				v[side] = r
+			}
+			versions[key] = v
+		}
+	}
+
+	var merged []replace
+	var conflicts [][2]*replace
+	for _, key := range modules {
+		v := versions[key]
+		base, ours, theirs := v[0], v[1], v[2]
+
+		var result *replace
+		switch {
+		case sameStoredReplace(ours, theirs), sameStoredReplace(base, theirs):
+			result = ours
+		case sameStoredReplace(base, ours):
+			result = theirs
+		default:
+			conflicts = append(conflicts, [2]*replace{ours, theirs})
+			continue
+		}
+
+		if result != nil {
+			merged = append(merged, *result)
+		}
+	}
+
+	return merged, conflicts
+}
+
+// sameStoredReplace checks if a and b are stored the same way in a gomr file,
+// nil is a replace that isn't in the file.
+func sameStoredReplace(a, b *replace) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+
+	var bufA, bufB bytes.Buffer
+	formatReplace(&bufA, *a)
+	formatReplace(&bufB, *b)
+	return bufA.String() == bufB.String()
+}
+
+func mergeDriverInstallRun(cmd *cobra.Command, args []string) error {
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	gomrBin, err := os.Executable()
+	if err != nil {
+		gomrBin = "gomr"
+	}
+
+	driver := fmt.Sprintf("%s%s merge-driver %%O %%A %%B", shellQuote(gomrBin), storeFlag())
+	if err = gitConfig(modRoot, "merge."+mergeDriverName+".name", "gomr file merge driver"); err != nil {
+		return err
+	}
+	if err = gitConfig(modRoot, "merge."+mergeDriverName+".driver", driver); err != nil {
+		return err
+	}
+	infof("installed merge driver in git config: %s", driver)
+
+	attributesPath := filepath.Join(modRoot, ".gitattributes")
+	lines, err := readGitAttributes(attributesPath)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if strings.TrimSpace(line) == mergeDriverAttribute {
+			return nil
+		}
+	}
+
+	if len(lines) != 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	lines = append(lines, mergeDriverAttribute, "")
+	if err = writeFile(attributesPath, []byte(strings.Join(lines, "\n")), 0664); err != nil {
+		return errors.Wrapf(err, "failed to write %s", attributesPath)
+	}
+
+	infof("added to %s: %s", attributesPath, mergeDriverAttribute)
+	return nil
+}
+
+func mergeDriverUninstallRun(cmd *cobra.Command, args []string) error {
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	if _, err = gitOutput(modRoot, "config", "--get-regexp", `^merge\.`+mergeDriverName+`\.`); err == nil {
+		if dryRun {
+			infof("would run: git config --remove-section merge.%s", mergeDriverName)
+		} else if _, err = gitOutput(modRoot, "config", "--remove-section", "merge."+mergeDriverName); err != nil {
+			return err
+		}
+		infof("removed merge driver from git config")
+	}
+
+	attributesPath := filepath.Join(modRoot, ".gitattributes")
+	lines, err := readGitAttributes(attributesPath)
+	if err != nil {
+		return err
+	}
+
+	var kept []string
+	for _, line := range lines {
+		if strings.TrimSpace(line) != mergeDriverAttribute {
+			kept = append(kept, line)
+		}
+	}
+	if len(kept) == len(lines) {
+		return nil
+	}
+
+	if strings.TrimSpace(strings.Join(kept, "")) == "" {
+		err = removeFile(attributesPath)
+	} else {
+		err = writeFile(attributesPath, []byte(strings.Join(kept, "\n")), 0664)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to update %s", attributesPath)
+	}
+
+	infof("removed from %s: %s", attributesPath, mergeDriverAttribute)
+	return nil
+}
+
+// gitConfig sets key to value in the git config of the repository that
+// contains dir
+func gitConfig(dir, key, value string) error {
+	if dryRun {
+		infof("would run: git config %s %s", key, shellQuote(value))
+		return nil
+	}
+
+	_, err := gitOutput(dir, "config", key, value)
+	return err
+}
+
+// readGitAttributes reads the lines of the .gitattributes file at path, there
+// are none if it doesn't exist
+func readGitAttributes(path string) ([]string, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", path)
+	}
+
+	return strings.Split(string(b), "\n"), nil
+}
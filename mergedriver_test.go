@@ -0,0 +1,139 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeReplaces(t *testing.T) {
+	lib := replace{ModuleName: "example.com/lib", AbsPath: "/src/lib"}
+	libMoved := replace{ModuleName: "example.com/lib", AbsPath: "/work/lib"}
+	libFork := replace{ModuleName: "example.com/lib", AbsPath: "/fork/lib"}
+	other := replace{ModuleName: "example.com/other", AbsPath: "/src/other"}
+	remote := replace{ModuleName: "example.com/remote", Target: "example.com/fork@v1.0.0"}
+
+	tests := []struct {
+		name      string
+		ancestor  []replace
+		current   []replace
+		other     []replace
+		merged    []string
+		conflicts []string
+	}{
+		{
+			name:     "unchanged",
+			ancestor: []replace{lib},
+			current:  []replace{lib},
+			other:    []replace{lib},
+			merged:   []string{"example.com/lib => /src/lib"},
+		},
+		{
+			name:     "current adds",
+			ancestor: []replace{lib},
+			current:  []replace{lib, other},
+			other:    []replace{lib},
+			merged:   []string{"example.com/lib => /src/lib", "example.com/other => /src/other"},
+		},
+		{
+			name:     "other adds",
+			ancestor: []replace{lib},
+			current:  []replace{lib},
+			other:    []replace{lib, remote},
+			merged:   []string{"example.com/lib => /src/lib", "example.com/remote => example.com/fork@v1.0.0"},
+		},
+		{
+			name:     "current removes",
+			ancestor: []replace{lib, other},
+			current:  []replace{other},
+			other:    []replace{lib, other},
+			merged:   []string{"example.com/other => /src/other"},
+		},
+		{
+			name:     "other removes",
+			ancestor: []replace{lib, other},
+			current:  []replace{lib, other},
+			other:    []replace{lib},
+			merged:   []string{"example.com/lib => /src/lib"},
+		},
+		{
+			name:     "both remove",
+			ancestor: []replace{lib, other},
+			current:  []replace{other},
+			other:    []replace{other},
+			merged:   []string{"example.com/other => /src/other"},
+		},
+		{
+			name:     "other changes",
+			ancestor: []replace{lib},
+			current:  []replace{lib},
+			other:    []replace{libMoved},
+			merged:   []string{"example.com/lib => /work/lib"},
+		},
+		{
+			name:     "both change the same way",
+			ancestor: []replace{lib},
+			current:  []replace{libMoved},
+			other:    []replace{libMoved},
+			merged:   []string{"example.com/lib => /work/lib"},
+		},
+		{
+			name:      "both change differently",
+			ancestor:  []replace{lib, other},
+			current:   []replace{libMoved, other},
+			other:     []replace{libFork, other},
+			merged:    []string{"example.com/other => /src/other"},
+			conflicts: []string{"example.com/lib => /work/lib | example.com/lib => /fork/lib"},
+		},
+		{
+			name:      "one changes and the other removes",
+			ancestor:  []replace{lib},
+			current:   []replace{libMoved},
+			other:     nil,
+			conflicts: []string{"example.com/lib => /work/lib | removed"},
+		},
+		{
+			name:      "both add differently",
+			current:   []replace{libMoved},
+			other:     []replace{libFork},
+			conflicts: []string{"example.com/lib => /work/lib | example.com/lib => /fork/lib"},
+		},
+		{
+			name:     "modules are matched ignoring case",
+			ancestor: []replace{lib},
+			current:  []replace{{ModuleName: "Example.com/Lib", AbsPath: "/work/lib"}},
+			other:    []replace{lib},
+			merged:   []string{"Example.com/Lib => /work/lib"},
+		},
+	}
+
+	describe := func(r *replace) string {
+		if r == nil {
+			return "removed"
+		}
+		return r.ModuleName + " => " + r.replacement()
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			copies := func(replaces []replace) []replace {
+				return append([]replace(nil), replaces...)
+			}
+			merged, conflicts := mergeReplaces(copies(test.ancestor), copies(test.current), copies(test.other))
+
+			var gotMerged, gotConflicts []string
+			for i := range merged {
+				gotMerged = append(gotMerged, describe(&merged[i]))
+			}
+			for _, c := range conflicts {
+				gotConflicts = append(gotConflicts, describe(c[0])+" | "+describe(c[1]))
+			}
+
+			if !reflect.DeepEqual(gotMerged, test.merged) {
+				t.Errorf("merged = %q, want %q", gotMerged, test.merged)
+			}
+			if !reflect.DeepEqual(gotConflicts, test.conflicts) {
+				t.Errorf("conflicts = %q, want %q", gotConflicts, test.conflicts)
+			}
+		})
+	}
+}
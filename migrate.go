@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:          "migrate",
+	Short:        "Upgrade the gomr file and " + gomrFilename + gomrLocalSuffix + " to the current format",
+	RunE:         migrateRun,
+	SilenceUsage: true,
+}
+
+func migrateRun(cmd *cobra.Command, args []string) error {
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	lock, err := lockModule(modRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, path := range []string{gomrFilePath, gomrFilePath + gomrLocalSuffix} {
+		migrated, err := migrateFile(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		found = true
+
+		if !migrated {
+			infof("%s is already version %d", filepath.Base(path), gomrFileVersion)
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("no %s or %s%s file found in %s", gomrFilename, gomrFilename, gomrLocalSuffix, filepath.Dir(gomrFilePath))
+	}
+	return nil
+}
+
+// migrateFile rewrites the gomr file at path in the current format if it's
+// in an older one, the error satisfies os.IsNotExist if it doesn't exist
+func migrateFile(path string) (bool, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+
+	file, err := parseGomrFile(b)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to parse %s", path)
+	}
+
+	if file.Version == gomrFileVersion {
+		return false, nil
+	}
+
+	if err = writeReplacesFile(path, file.Replaces); err != nil {
+		return false, err
+	}
+
+	infof("migrated %s from version %d to %d", filepath.Base(path), file.Version, gomrFileVersion)
+	return true, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// missingPolicy is what resolveAddPath does when the directory for a replace
+// doesn't exist
+type missingPolicy struct {
+	// clone the module's repository into it
+	clone bool
+	// fromCache copies the module from the module cache without asking when
+	// no path was given
+	fromCache bool
+}
+
+// moduleCacheRoot returns the module cache directory, GOMODCACHE or the
+// pkg/mod directory of the first GOPATH entry for go versions without it.
+func moduleCacheRoot() (string, error) {
+	out, err := exec.Command(goCommand(), "env", "GOMODCACHE").Output()
+	if root := strings.TrimSpace(string(out)); err == nil && len(root) != 0 {
+		return root, nil
+	}
+
+	entries, err := gopaths()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(entries[0], "pkg", "mod"), nil
+}
+
+// escapeModulePath escapes a module path or version the way the module
+// cache does on disk, upper case letters become ! followed by the lower
+// case letter.
+func escapeModulePath(path string) string {
+	var b strings.Builder
+	for _, r := range path {
+		if unicode.IsUpper(r) {
+			b.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// findCachedModule returns the directory of moduleName in the module cache
+// and its version. The version the current module requires is preferred,
+// otherwise the highest version in the cache is used. An empty dir means
+// the module isn't in the cache.
+func findCachedModule(moduleName string) (dir, version string, err error) {
+	root, err := moduleCacheRoot()
+	if err != nil {
+		return "", "", err
+	}
+	prefix := filepath.Join(root, filepath.FromSlash(escapeModulePath(moduleName))) + "@"
+
+	if modRoot, err := findModuleRoot(); err == nil {
+		if mod, err := readGoMod(modRoot); err == nil {
+			if v := mod.requiredVersion(moduleName); len(v) != 0 {
+				if _, err := os.Stat(prefix + escapeModulePath(v)); err == nil {
+					return prefix + escapeModulePath(v), v, nil
+				}
+			}
+		}
+	}
+
+	matches, err := filepath.Glob(prefix + "*")
+	if err != nil || len(matches) == 0 {
+		return "", "", err
+	}
+	sort.Strings(matches)
+	dir = matches[len(matches)-1]
+
+	return dir, strings.TrimPrefix(dir, prefix), nil
+}
+
+// copyFromModuleCache offers to copy moduleName out of the module cache into
+// dest, which doesn't exist yet, and reports whether it was copied. It asks
+// first unless fromCache is set, and when stdin isn't a terminal it only
+// says how to do it.
+func copyFromModuleCache(r *replace, dest string, fromCache bool) (bool, error) {
+	src, version, err := findCachedModule(r.ModuleName)
+	if err != nil || len(src) == 0 {
+		return false, err
+	}
+
+	if !fromCache {
+		if !stdinIsTerminal() {
+			infof("%s %s is in the module cache, use --from-cache to copy it to %s", r.ModuleName, version, dest)
+			return false, nil
+		}
+
+		ok, err := confirm(r.ModuleName + " " + version + " is in the module cache, copy it to " + dest + "?")
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	if len(r.Note) == 0 {
+		r.Note = "copied from the module cache at " + version
+	}
+
+	if dryRun {
+		infof("would copy: %s to %s", src, dest)
+		return true, nil
+	}
+
+	if err = copyTree(src, dest); err != nil {
+		os.RemoveAll(dest)
+		return false, errors.Wrapf(err, "failed to copy %s from the module cache", r.ModuleName)
+	}
+
+	infof("copied %s %s from the module cache to %s", r.ModuleName, version, dest)
+	return true, nil
+}
+
+// copyTree copies the directory src to dest, leaving out any .git
+// directories. Files in the module cache are read only so the copies are
+// made writable.
+func copyTree(src, dest string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+
+		switch {
+		case info.IsDir() && info.Name() == ".git":
+			return filepath.SkipDir
+		case info.IsDir():
+			return os.MkdirAll(target, 0775)
+		case !info.Mode().IsRegular():
+			return nil
+		}
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(target, b, info.Mode().Perm()|0200)
+	})
+}
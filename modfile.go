@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/modfile"
+)
+
+// parseGoMod reads the go.mod in dir like readGoMod but parses it itself
+// instead of running go, which is too slow to do for every replace or on
+// every shell prompt.
+func parseGoMod(dir string) (goModFile, error) {
+	f, _, err := parseModfile(dir)
+	if err != nil {
+		return goModFile{}, err
+	}
+
+	return convertModfile(f), nil
+}
+
+// convertModfile converts a parsed go.mod to the structure go mod edit -json
+// outputs
+func convertModfile(f *modfile.File) goModFile {
+	var mod goModFile
+	if f.Module != nil {
+		mod.Module = goModule{Path: f.Module.Mod.Path, Version: f.Module.Mod.Version}
+	}
+	for _, r := range f.Require {
+		mod.Require = append(mod.Require, goModRequire{Path: r.Mod.Path, Version: r.Mod.Version, Indirect: r.Indirect})
+	}
+	for _, r := range f.Replace {
+		mod.Replace = append(mod.Replace, goModReplace{
+			Old: goModule{Path: r.Old.Path, Version: r.Old.Version},
+			New: goModule{Path: r.New.Path, Version: r.New.Version},
+		})
+	}
+
+	return mod
+}
+
+// addGoModReplaces writes replace lines for all of the replaces into the
+// go.mod in dir at once, the same edit go mod edit -replace makes for each
+// of them but without running go once per replace.
+func addGoModReplaces(dir string, replaces []replace) error {
+	if len(replaces) == 0 {
+		return nil
+	}
+
+	path := filepath.Join(dir, "go.mod")
+	if dryRun {
+		infof("would write: %s with %s", path, strings.Join(replaceFlags(replaces), " "))
+		return nil
+	}
+
+	f, info, err := parseModfile(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range replaces {
+		newPath, newVersion := r.replacement(), ""
+		if r.isRemote() {
+			if i := strings.LastIndex(newPath, "@"); i >= 0 {
+				newPath, newVersion = newPath[:i], newPath[i+1:]
+			}
+		}
+		if err = f.AddReplace(r.ModuleName, "", newPath, newVersion); err != nil {
+			return errors.Wrapf(err, "failed to replace %s in %s", r.ModuleName, path)
+		}
+	}
+
+	f.Cleanup()
+	b, err := f.Format()
+	if err != nil {
+		return errors.Wrapf(err, "failed to format %s", path)
+	}
+
+	return writeFile(path, b, info.Mode())
+}
+
+// parseModfile parses the go.mod in dir, returning its file info as well so
+// it can be written back with the same mode
+func parseModfile(dir string) (*modfile.File, os.FileInfo, error) {
+	path := filepath.Join(dir, "go.mod")
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to read go.mod in dir: %s", dir)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to read go.mod in dir: %s", dir)
+	}
+
+	f, err := modfile.Parse(path, b, nil)
+	if err != nil {
+		return nil, nil, errors.Wrapf(err, "failed to parse go.mod in dir: %s", dir)
+	}
+	return f, info, nil
+}
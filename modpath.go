@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/mod/module"
+)
+
+// validateModulePath makes sure a module path given to add is valid before
+// anything is written, so a typo gets a clear error instead of go mod edit
+// failing later. Paths in a module without a dot in their first element,
+// which only work with a replace, are held to the import path rules rather
+// than the stricter ones for paths that can be downloaded.
+func validateModulePath(modulePath string) error {
+	checked := strings.TrimSuffix(modulePath, wildcardSuffix)
+
+	err := module.CheckPath(checked)
+	if err != nil && !strings.Contains(strings.SplitN(checked, "/", 2)[0], ".") {
+		err = module.CheckImportPath(checked)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid module path: %v", err)
+	}
+
+	return nil
+}
+
+// validateRemoteTarget makes sure a module@version target is a valid module
+// path and version
+func validateRemoteTarget(target string) error {
+	at := strings.LastIndexByte(target, '@')
+	if err := module.Check(target[:at], target[at+1:]); err != nil {
+		return fmt.Errorf("invalid target: %v", err)
+	}
+
+	return nil
+}
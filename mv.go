@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var mvCmd = &cobra.Command{
+	Use:   "mv [flags] <module> <path | module@version>",
+	Short: "Change where a stored replace points",
+	Long: `Change where a stored replace points
+
+Updates the path of a stored replace and keeps everything else about it, like
+its profiles, note and the version go.mod required before it. If the replace
+is installed go.mod is pointed at the new path right away. A go.mod gomr
+generated in the old directory is deleted, and one is generated in the new
+directory when it needs one.`,
+	RunE:         mvRun,
+	Args:         cobra.ExactArgs(2),
+	SilenceUsage: true,
+}
+
+func mvRun(cmd *cobra.Command, args []string) error {
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
+
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	lock, err := lockModule(modRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return err
+	}
+	stored, err := readGomrFile(gomrFilePath)
+	if err != nil {
+		return err
+	}
+
+	i := lookupReplace(stored, args[0])
+	if i < 0 {
+		return fmt.Errorf("could not find stored replace for module: %s", args[0])
+	}
+	old := stored[i]
+
+	r := old
+	r.AbsPath, r.Target, r.AddGoMod, r.mapped = "", "", false, false
+	if isRemoteTarget(args[1]) {
+		if err = validateRemoteTarget(args[1]); err != nil {
+			return err
+		}
+		r.Target, r.relative = args[1], false
+	} else {
+		if err = resolveAddPath(&r, args[1], missingPolicy{}); err != nil {
+			return err
+		}
+		resolvePathSymlinks(&r)
+		if err = checkModuleMatch(r, force); err != nil {
+			return err
+		}
+		if old.relative {
+			r.relative = false
+			storeRelative(modRoot, &r, false)
+		}
+	}
+
+	if r.replacement() == old.replacement() {
+		infof("%s already points at %s", old.ModuleName, old.replacement())
+		return nil
+	}
+	stored[i] = r
+
+	files, err := moduleFiles(modRoot, []replace{old, r})
+	if err != nil {
+		return err
+	}
+	tx, err := beginTransaction(files...)
+	if err != nil {
+		return err
+	}
+
+	var repointed []string
+	err = recordOperation(modRoot, operationName("mv", []replace{r}), files, func() error {
+		return tx.run(func() error {
+			var err error
+			if !old.Disabled {
+				if repointed, err = repointReplace(modRoot, old, r); err != nil {
+					return err
+				}
+			}
+			if err = removeStubs(modRoot, []replace{old}, false); err != nil {
+				return err
+			}
+			return writeGomrFile(gomrFilePath, stored)
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	infof("moved replace: %s => %s (was %s)", r.ModuleName, r.replacement(), old.replacement())
+	for _, dir := range repointed {
+		infof("%s now replaces it with %s", filepath.Join(dir, "go.mod"), r.replacement())
+	}
+	return nil
+}
+
+// repointReplace changes the replace lines for old to point where r does in
+// every go.mod that has them installed, generating a go.mod in r's directory
+// if it needs one. It returns the directories of the modules it changed.
+func repointReplace(modRoot string, old, r replace) ([]string, error) {
+	var dirs []string
+	if old.targetsMain() {
+		dirs = append(dirs, modRoot)
+	}
+	targets, _, err := targetModules(modRoot, []replace{old})
+	if err != nil {
+		return nil, err
+	}
+	dirs = append(dirs, targets...)
+
+	var changed []string
+	for _, dir := range dirs {
+		mod, err := readGoMod(dir)
+		if err != nil {
+			return nil, err
+		}
+
+		applied := appliedReplaces(mod, []replace{old})
+		if len(applied) == 0 {
+			continue
+		}
+
+		install := expandWildcards(mod, []replace{r})
+		if err = createStubs(modRoot, install); err != nil {
+			return nil, err
+		}
+
+		flags := append(dropReplaceFlags(applied), replaceFlags(install)...)
+		if err = gomod(dir, append([]string{"edit"}, flags...)...); err != nil {
+			return nil, errors.Wrapf(err, "failed to point %s at %s", old.ModuleName, r.replacement())
+		}
+		changed = append(changed, dir)
+	}
+
+	return changed, nil
+}
+
+// completeMvArgs completes the stored modules for the first argument and
+// directories for the second
+func completeMvArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 0 {
+		return completeStoredModules(cmd, args, toComplete)
+	}
+	return nil, cobra.ShellCompDirectiveFilterDirs
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gdamore/tcell"
+)
+
+// fuzzyScore matches query against str as a case insensitive subsequence.
+// Lower scores are better matches: the matched characters are closer
+// together and start earlier.
+func fuzzyScore(query, str string) (int, bool) {
+	if len(query) == 0 {
+		return 0, true
+	}
+
+	q := []rune(strings.ToLower(query))
+	first, last, qi := -1, -1, 0
+	for i, r := range []rune(strings.ToLower(str)) {
+		if r != q[qi] {
+			continue
+		}
+
+		if first < 0 {
+			first = i
+		}
+		last = i
+		qi++
+		if qi == len(q) {
+			return (last-first)*2 + first, true
+		}
+	}
+
+	return 0, false
+}
+
+// fuzzyFilter returns the items matching query, best matches first
+func fuzzyFilter(query string, items []string) []string {
+	type match struct {
+		item  string
+		score int
+		index int
+	}
+
+	var matches []match
+	for i, item := range items {
+		if score, ok := fuzzyScore(query, item); ok {
+			matches = append(matches, match{item: item, score: score, index: i})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score < matches[j].score
+		}
+		return matches[i].index < matches[j].index
+	})
+
+	filtered := make([]string, len(matches))
+	for i, m := range matches {
+		filtered[i] = m.item
+	}
+	return filtered
+}
+
+// fuzzyPick lets the user pick one of items by typing to narrow them down.
+// When allowCustom is set the typed text itself can be picked as well with
+// tab. ok is false if the user cancelled with escape.
+func fuzzyPick(screen tcell.Screen, title string, items []string, allowCustom bool) (string, bool) {
+	var query []rune
+	cursor, offset := 0, 0
+
+	for {
+		matches := fuzzyFilter(string(query), items)
+		if cursor >= len(matches) {
+			cursor = len(matches) - 1
+		}
+		if cursor < 0 {
+			cursor = 0
+		}
+
+		screen.Clear()
+		width, height := screen.Size()
+		drawText(screen, 0, 0, width, tcell.StyleDefault.Bold(true), title)
+		help := "type to search, up/down to move, enter to pick, esc to cancel"
+		if allowCustom {
+			help = "type to search, up/down to move, enter to pick, tab to use what was typed, esc to cancel"
+		}
+		drawText(screen, 0, 1, width, tcell.StyleDefault.Dim(true), help)
+		drawText(screen, 0, 2, width, tcell.StyleDefault, "> "+string(query))
+
+		listHeight := height - 4
+		if cursor < offset {
+			offset = cursor
+		}
+		if listHeight > 0 && cursor >= offset+listHeight {
+			offset = cursor - listHeight + 1
+		}
+		for i := offset; i < len(matches) && i-offset < listHeight; i++ {
+			style := tcell.StyleDefault
+			if i == cursor {
+				style = style.Reverse(true)
+			}
+			drawText(screen, 2, 4+i-offset, width, style, matches[i])
+		}
+		screen.Show()
+
+		ev, isKey := screen.PollEvent().(*tcell.EventKey)
+		if !isKey {
+			screen.Sync()
+			continue
+		}
+
+		switch ev.Key() {
+		case tcell.KeyEscape, tcell.KeyCtrlC:
+			return "", false
+		case tcell.KeyEnter:
+			if len(matches) != 0 {
+				return matches[cursor], true
+			}
+		case tcell.KeyTab:
+			if allowCustom && len(query) != 0 {
+				return strings.TrimSpace(string(query)), true
+			}
+		case tcell.KeyUp:
+			cursor--
+		case tcell.KeyDown:
+			cursor++
+		case tcell.KeyBackspace, tcell.KeyBackspace2:
+			if len(query) != 0 {
+				query = query[:len(query)-1]
+				cursor = 0
+			}
+		case tcell.KeyRune:
+			if !unicode.IsControl(ev.Rune()) {
+				query = append(query, ev.Rune())
+				cursor = 0
+			}
+		}
+	}
+}
+
+// pickAddTarget asks the user for a module from the require list of the
+// module in modRoot and a directory to replace it with, the checkouts of the
+// chosen module under the source roots are listed first.
+func pickAddTarget(modRoot string) (addTarget, bool, error) {
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		return addTarget{}, false, err
+	}
+
+	modules := make([]string, 0, len(mod.Require))
+	for _, req := range mod.Require {
+		modules = append(modules, req.Path)
+	}
+
+	roots, err := sourceRoots(nil)
+	if err != nil {
+		return addTarget{}, false, err
+	}
+	found := findModuleDirs(roots, modRoot)
+
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return addTarget{}, false, err
+	}
+	if err = screen.Init(); err != nil {
+		return addTarget{}, false, err
+	}
+	defer screen.Fini()
+
+	moduleName, ok := fuzzyPick(screen, "module to replace", modules, true)
+	if !ok {
+		return addTarget{}, false, nil
+	}
+
+	var dirs, others []string
+	for _, d := range found {
+		if d.module == moduleName {
+			dirs = append(dirs, d.dir)
+		} else {
+			others = append(others, d.dir)
+		}
+	}
+	dir, ok := fuzzyPick(screen, "directory to replace "+moduleName+" with", append(dirs, others...), true)
+	if !ok {
+		return addTarget{}, false, nil
+	}
+
+	return addTarget{Module: moduleName, Target: dir}, true, nil
+}
+
+// multiPick lets the user choose any number of items, typing narrows the
+// list down and space toggles the item under the cursor. ok is false if the
+// user cancelled with escape.
+func multiPick(screen tcell.Screen, title string, items []string) ([]string, bool) {
+	var query []rune
+	chosen := make(map[string]bool)
+	cursor, offset := 0, 0
+
+	for {
+		matches := fuzzyFilter(string(query), items)
+		if cursor >= len(matches) {
+			cursor = len(matches) - 1
+		}
+		if cursor < 0 {
+			cursor = 0
+		}
+
+		screen.Clear()
+		width, height := screen.Size()
+		drawText(screen, 0, 0, width, tcell.StyleDefault.Bold(true), title)
+		drawText(screen, 0, 1, width, tcell.StyleDefault.Dim(true), "type to search, up/down to move, space to select, enter to confirm, esc to cancel")
+		drawText(screen, 0, 2, width, tcell.StyleDefault, "> "+string(query))
+
+		listHeight := height - 4
+		if cursor < offset {
+			offset = cursor
+		}
+		if listHeight > 0 && cursor >= offset+listHeight {
+			offset = cursor - listHeight + 1
+		}
+		for i := offset; i < len(matches) && i-offset < listHeight; i++ {
+			mark := "[ ] "
+			if chosen[matches[i]] {
+				mark = "[x] "
+			}
+			style := tcell.StyleDefault
+			if i == cursor {
+				style = style.Reverse(true)
+			}
+			drawText(screen, 2, 4+i-offset, width, style, mark+matches[i])
+		}
+		screen.Show()
+
+		ev, isKey := screen.PollEvent().(*tcell.EventKey)
+		if !isKey {
+			screen.Sync()
+			continue
+		}
+
+		switch ev.Key() {
+		case tcell.KeyEscape, tcell.KeyCtrlC:
+			return nil, false
+		case tcell.KeyEnter:
+			var picked []string
+			for _, item := range items {
+				if chosen[item] {
+					picked = append(picked, item)
+				}
+			}
+			return picked, true
+		case tcell.KeyUp:
+			cursor--
+		case tcell.KeyDown:
+			cursor++
+		case tcell.KeyBackspace, tcell.KeyBackspace2:
+			if len(query) != 0 {
+				query = query[:len(query)-1]
+				cursor = 0
+			}
+		case tcell.KeyRune:
+			switch r := ev.Rune(); {
+			case r == ' ':
+				if len(matches) != 0 {
+					chosen[matches[cursor]] = !chosen[matches[cursor]]
+				}
+			case !unicode.IsControl(r):
+				query = append(query, r)
+				cursor = 0
+			}
+		}
+	}
+}
+
+// pickStoredReplaces asks the user which of the stored replaces of the
+// module in modRoot to act on.
+func pickStoredReplaces(modRoot, title string) ([]string, error) {
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return nil, err
+	}
+	replaces, err := readGomrFile(gomrFilePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(replaces) == 0 {
+		return nil, nil
+	}
+
+	items := make([]string, len(replaces))
+	for i, r := range replaces {
+		items[i] = r.ModuleName
+	}
+
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return nil, err
+	}
+	if err = screen.Init(); err != nil {
+		return nil, err
+	}
+	defer screen.Fini()
+
+	picked, _ := multiPick(screen, title, items)
+	return picked, nil
+}
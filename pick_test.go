@@ -0,0 +1,54 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFuzzyScore(t *testing.T) {
+	tests := []struct {
+		query string
+		str   string
+		score int
+		ok    bool
+	}{
+		{query: "", str: "example.com/lib", score: 0, ok: true},
+		{query: "abc", str: "abc", score: 4, ok: true},
+		{query: "abc", str: "xabc", score: 5, ok: true},
+		{query: "ac", str: "abc", score: 4, ok: true},
+		{query: "AB", str: "ab", score: 2, ok: true},
+		{query: "ab", str: "AB", score: 2, ok: true},
+		{query: "gomr", str: "github.com/aarondl/gomr", score: 26, ok: true},
+		{query: "日本", str: "x日y本", score: 5, ok: true},
+		{query: "abd", str: "abc", ok: false},
+		{query: "ba", str: "ab", ok: false},
+		{query: "abc", str: "", ok: false},
+	}
+
+	for _, test := range tests {
+		score, ok := fuzzyScore(test.query, test.str)
+		if ok != test.ok || score != test.score {
+			t.Errorf("fuzzyScore(%q, %q) = %d, %t, want %d, %t", test.query, test.str, score, ok, test.score, test.ok)
+		}
+	}
+}
+
+func TestFuzzyFilter(t *testing.T) {
+	items := []string{"github.com/aarondl/gomr", "github.com/spf13/cobra", "gomr", "example.com/go-mirror"}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{query: "", want: items},
+		{query: "gomr", want: []string{"gomr", "example.com/go-mirror", "github.com/aarondl/gomr", "github.com/spf13/cobra"}},
+		{query: "cobra", want: []string{"github.com/spf13/cobra"}},
+		{query: "zzz", want: []string{}},
+	}
+
+	for _, test := range tests {
+		if got := fuzzyFilter(test.query, items); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("fuzzyFilter(%q) = %q, want %q", test.query, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var promptCmd = &cobra.Command{
+	Use:   "prompt [flags]",
+	Short: "Print a marker for the shell prompt when replaces are applied",
+	Long: `Print a marker for the shell prompt when replaces are applied
+
+Prints something like gomr:3↑ when three of the stored replaces are applied
+to go.mod, and nothing when none are or outside of a module, so it can be put
+in PS1 or a starship custom command. --format changes the marker, %d is the
+number of applied replaces.
+
+It runs on every prompt so it reads the files itself instead of running go,
+and it never fails: problems are only shown with --verbose.
+
+  PS1='$(gomr prompt) '"$PS1"`,
+	RunE:         promptRun,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+}
+
+func promptRun(cmd *cobra.Command, args []string) error {
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return err
+	}
+
+	applied, err := countApplied()
+	if err != nil {
+		debugf("%v", err)
+		return nil
+	}
+	if applied != 0 {
+		outputf(format, applied)
+	}
+	return nil
+}
+
+// countApplied returns how many of the stored replaces of the module in the
+// current directory are applied, 0 outside of a module
+func countApplied() (int, error) {
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return 0, nil
+	}
+
+	replaces, err := storedReplaces(modRoot)
+	if err != nil || len(replaces) == 0 {
+		return 0, err
+	}
+
+	mod, err := parseGoMod(modRoot)
+	if err != nil {
+		return 0, err
+	}
+	return len(appliedReplaces(mod, enabledReplaces(replaces))), nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune [flags]",
+	Short: "Remove stored replaces whose directories no longer exist",
+	RunE:  pruneRun,
+}
+
+func pruneRun(cmd *cobra.Command, args []string) error {
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	lock, err := lockModule(modRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return err
+	}
+	replaces, err := readGomrFile(gomrFilePath)
+	if err != nil {
+		return err
+	}
+
+	var kept, dead []replace
+	for _, r := range replaces {
+		if r.isRemote() {
+			kept = append(kept, r)
+			continue
+		}
+
+		_, err := os.Stat(r.rootPath())
+		switch {
+		case os.IsNotExist(err):
+			dead = append(dead, r)
+		case err != nil:
+			return err
+		default:
+			kept = append(kept, r)
+		}
+	}
+
+	if len(dead) == 0 {
+		infof("nothing to prune")
+		return nil
+	}
+
+	for _, r := range dead {
+		if dryRun {
+			infof("would prune replace: %s => %s", r.ModuleName, r.AbsPath)
+		} else {
+			infof("pruned replace: %s => %s", r.ModuleName, r.AbsPath)
+		}
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		return err
+	}
+
+	files, err := moduleFiles(modRoot, nil)
+	if err != nil {
+		return err
+	}
+
+	tx, err := beginTransaction(files...)
+	if err != nil {
+		return err
+	}
+
+	return tx.run(func() error {
+		if applied := appliedReplaces(mod, dead); len(applied) != 0 {
+			if err := gomod(modRoot, append([]string{"edit"}, dropReplaceFlags(applied)...)...); err != nil {
+				return err
+			}
+			if err := restoreRequires(modRoot, applied); err != nil {
+				return err
+			}
+		}
+
+		if err := writeGomrFile(gomrFilePath, kept); err != nil {
+			return err
+		}
+
+		return restoreGoSum(modRoot)
+	})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/spf13/cobra"
+)
+
+var pullCmd = &cobra.Command{
+	Use:   "pull [flags] [module...]",
+	Short: "Update the checkouts of the stored replaces with git pull --ff-only",
+	Long: `Update the checkouts of the stored replaces with git pull --ff-only
+
+The command is run once in every git repository a stored replace points into,
+all of them unless modules are given. --command, or pull_command in the
+project config, runs a different command with the shell instead.`,
+	RunE:         pullRun,
+	SilenceUsage: true,
+}
+
+func pullRun(cmd *cobra.Command, args []string) error {
+	command, err := cmd.Flags().GetString("command")
+	if err != nil {
+		return err
+	}
+
+	modRoot, replaces, err := loadReplaces(cmd)
+	if err != nil {
+		return err
+	}
+	if replaces, err = selectReplaces(replaces, args); err != nil {
+		return err
+	}
+
+	if len(command) == 0 {
+		cfg, err := loadConfig(modRoot)
+		if err != nil {
+			return err
+		}
+		command = cfg.PullCommand
+	}
+
+	checkouts, err := replacedCheckouts(modRoot, replaces, true)
+	if err != nil {
+		return err
+	}
+	if len(checkouts) == 0 {
+		infof("no checkouts to pull")
+		return nil
+	}
+
+	results := runInCheckouts(checkouts, gitWorkers, func(c checkout) *exec.Cmd {
+		if len(command) != 0 {
+			return shellCommand(command)
+		}
+		return exec.Command("git", "pull", "--ff-only")
+	})
+
+	// git pull's summary is on its last line, the rest only matters when
+	// something went wrong
+	failed := reportCheckoutResults(results, len(command) == 0)
+	if failed != 0 {
+		return fmt.Errorf("pull failed in %d of %d checkout(s)", failed, len(results))
+	}
+	return nil
+}
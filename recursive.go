@@ -0,0 +1,111 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// nestedModules returns the root of every module other than modRoot in the
+// repository containing modRoot, or under modRoot if it isn't in a git
+// repository.
+func nestedModules(modRoot string) ([]string, error) {
+	root := modRoot
+	if isGitRepo(modRoot) {
+		topLevel, err := gitOutput(modRoot, "rev-parse", "--show-toplevel")
+		if err != nil {
+			return nil, err
+		}
+		root = filepath.Clean(topLevel)
+	}
+
+	var modules []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			name := info.Name()
+			if path != root && (strings.HasPrefix(name, ".") || name == "vendor" || name == "testdata" || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if dir := filepath.Dir(path); info.Name() == "go.mod" && dir != modRoot {
+			modules = append(modules, dir)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return modules, nil
+}
+
+// nestedFiles returns the go.mod and go.sum of each module so they can be
+// part of a transaction.
+func nestedFiles(modules []string) []string {
+	var files []string
+	for _, m := range modules {
+		files = append(files, filepath.Join(m, "go.mod"), filepath.Join(m, "go.sum"))
+	}
+	return files
+}
+
+// installNested adds the replace lines to every module that requires the
+// replaced module and returns how many modules were changed. Only the main
+// module keeps track of required versions and go.sum backups, the others only
+// get replace lines.
+func installNested(modules []string, replaces []replace) (int, error) {
+	changed := 0
+	for _, m := range modules {
+		mod, err := readGoMod(m)
+		if err != nil {
+			return changed, err
+		}
+
+		var install []replace
+		for _, r := range expandWildcards(mod, replaces) {
+			if r.ModuleName != mod.Module.Path && len(mod.requiredVersion(r.ModuleName)) != 0 {
+				install = append(install, r)
+			}
+		}
+		if len(install) == 0 {
+			continue
+		}
+
+		if err = gomod(m, append([]string{"edit"}, replaceFlags(install)...)...); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+
+	return changed, nil
+}
+
+// uninstallNested drops the replace lines installNested added and returns
+// how many modules were changed
+func uninstallNested(modules []string, replaces []replace) (int, error) {
+	changed := 0
+	for _, m := range modules {
+		mod, err := readGoMod(m)
+		if err != nil {
+			return changed, err
+		}
+
+		applied := appliedReplaces(mod, replaces)
+		if len(applied) == 0 {
+			continue
+		}
+
+		if err = gomod(m, append([]string{"edit"}, dropReplaceFlags(applied)...)...); err != nil {
+			return changed, err
+		}
+		changed++
+	}
+
+	return changed, nil
+}
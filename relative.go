@@ -0,0 +1,36 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// storeRelative marks a local replace's path to be stored relative to the
+// gomr file, as long as it's inside the repository modRoot is in or beside
+// it in the same parent directory. Anything further away is unlikely to be
+// in the same place on another machine so its absolute path is kept, with a
+// warning when the user asked for a relative path with explicit.
+func storeRelative(modRoot string, r *replace, explicit bool) {
+	report := debugf
+	if explicit {
+		report = warnf
+	}
+
+	if globalStore {
+		report("paths are always stored absolute in the global store")
+		return
+	}
+
+	base := modRoot
+	if top, err := gitOutput(modRoot, "rev-parse", "--show-toplevel"); err == nil {
+		base = filepath.FromSlash(top)
+	}
+
+	rel, err := filepath.Rel(filepath.Dir(base), r.rootPath())
+	if err != nil || strings.HasPrefix(rel, "..") {
+		report("%s is not inside or beside %s, storing its absolute path", r.rootPath(), base)
+		return
+	}
+
+	r.relative = true
+}
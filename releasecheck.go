@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var releaseCheckCmd = &cobra.Command{
+	Use:   "release-check",
+	Short: "Fail if the module isn't ready to be released",
+	Long: `Fail if the module isn't ready to be released
+
+Intended for tagging and release scripts. Fails on everything check --local
+fails on, which is any replace of a local directory in go.mod and checksums
+missing from go.sum, and also if the checkout of any stored replace has
+commits that aren't on a remote branch, since a release shouldn't depend on
+work that only exists locally. Exits with 2 if anything was found.`,
+	RunE:         releaseCheckRun,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+}
+
+func releaseCheckRun(cmd *cobra.Command, args []string) error {
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return err
+	}
+	replaces, err := readGomrFile(gomrFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		return err
+	}
+
+	problems, err := checkModule(modRoot, mod, replaces, true)
+	if err != nil {
+		return err
+	}
+
+	checkouts, err := replacedCheckouts(modRoot, enabledReplaces(replaces), true)
+	if err != nil {
+		return err
+	}
+	for _, c := range checkouts {
+		if !isGitRepo(c.dir) {
+			continue
+		}
+
+		pushed, err := commitPushed(c.dir, "HEAD")
+		if err != nil {
+			return err
+		}
+		if !pushed {
+			problems = append(problems, fmt.Sprintf("%s has unpushed commits in %s", c.module, c.dir))
+		}
+	}
+
+	if len(problems) == 0 {
+		infof("ready to release")
+		return nil
+	}
+
+	outputf("%s:", modRoot)
+	for _, p := range problems {
+		outputf("  %s", p)
+	}
+
+	return withExitCode(exitDrift, fmt.Errorf("release check failed with %d problem(s)", len(problems)))
+}
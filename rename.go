@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var renameCmd = &cobra.Command{
+	Use:   "rename [flags] <old module> <new module>",
+	Short: "Change the module path of a stored replace",
+	Long: `Change the module path of a stored replace
+
+For when a module moves to a new import path. The stored replace is renamed,
+keeping its path and everything else, and if it's installed go.mod's replace
+line for the old path is swapped for one for the new path. A go.mod gomr
+generated for the replace is generated again with the new path.
+
+With --require the require line for the old path is swapped for one for the
+new path as well, at its latest version or, if it has none, a version that
+only resolves while it's replaced. The imports in the code still need to be
+changed by hand.`,
+	RunE:         renameRun,
+	Args:         cobra.ExactArgs(2),
+	SilenceUsage: true,
+}
+
+func renameRun(cmd *cobra.Command, args []string) error {
+	require, err := cmd.Flags().GetBool("require")
+	if err != nil {
+		return err
+	}
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
+
+	newModule := args[1]
+	if err = checkWildcard(newModule); err != nil {
+		return err
+	}
+	if err = validateModulePath(newModule); err != nil {
+		return err
+	}
+
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	lock, err := lockModule(modRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return err
+	}
+	stored, err := readGomrFile(gomrFilePath)
+	if err != nil {
+		return err
+	}
+
+	i := lookupReplace(stored, args[0])
+	if i < 0 {
+		return fmt.Errorf("could not find stored replace for module: %s", args[0])
+	}
+	old := stored[i]
+	if old.isWildcard() || strings.HasSuffix(newModule, wildcardSuffix) {
+		return errors.New("wildcard replaces can't be renamed, remove the replace and add the new one")
+	}
+	if j := findReplace(stored, newModule); j >= 0 {
+		return fmt.Errorf("%s already has a stored replace", stored[j].ModuleName)
+	}
+
+	r := old
+	r.ModuleName, r.Require = newModule, ""
+	if !r.isRemote() {
+		if err = checkModuleMatch(r, force); err != nil {
+			return err
+		}
+	}
+	stored[i] = r
+
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		return err
+	}
+	required := require && len(mod.requiredVersion(old.ModuleName)) != 0
+
+	files, err := moduleFiles(modRoot, []replace{old, r})
+	if err != nil {
+		return err
+	}
+	tx, err := beginTransaction(files...)
+	if err != nil {
+		return err
+	}
+
+	var repointed []string
+	err = recordOperation(modRoot, "rename "+old.ModuleName+" "+r.ModuleName, files, func() error {
+		return tx.run(func() error {
+			// The old stub declares the old path, it's generated again with
+			// the new one when the replace is installed
+			err := removeStubs(modRoot, []replace{old}, false)
+			if err != nil {
+				return err
+			}
+			if !old.Disabled {
+				if repointed, err = repointReplace(modRoot, old, r); err != nil {
+					return err
+				}
+			}
+
+			if required {
+				if err = gomod(modRoot, "edit", "-droprequire="+old.ModuleName); err != nil {
+					return err
+				}
+				if err = requireModules(modRoot, []replace{r}); err != nil {
+					return err
+				}
+			}
+
+			return writeGomrFile(gomrFilePath, stored)
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	infof("renamed replace: %s => %s (was %s)", r.ModuleName, r.replacement(), old.ModuleName)
+	for _, dir := range repointed {
+		infof("%s now replaces %s instead of %s", filepath.Join(dir, "go.mod"), r.ModuleName, old.ModuleName)
+	}
+	if require && !required {
+		infof("go.mod doesn't require %s, no require line to change", old.ModuleName)
+	}
+	return nil
+}
+
+// completeRenameArgs completes the stored modules for the old module, the
+// new one is up to the user
+func completeRenameArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 0 {
+		return completeStoredModules(cmd, args, toComplete)
+	}
+	return nil, cobra.ShellCompDirectiveNoFileComp
+}
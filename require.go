@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// zeroPseudoVersion is the version go requires a module at when its only
+// source is a replace
+const zeroPseudoVersion = "v0.0.0-00010101000000-000000000000"
+
+// noVersionErrors are what go get says, lowercased, when a module has no
+// published version or can't be found at all, as opposed to failing to
+// reach it or anything else going wrong
+var noVersionErrors = []string{
+	"no matching versions",
+	"not found",
+	"410 gone",
+	"unrecognized import path",
+	"cannot find module",
+}
+
+// requireModules makes the module in modRoot require each of the replaces'
+// modules at its latest version, so the replaces have an effect. A module
+// without a published version is required at the zero pseudo-version that
+// only resolves while it's replaced, any other go get failure is returned.
+func requireModules(modRoot string, replaces []replace) error {
+	for _, r := range replaces {
+		err := goGet(modRoot, r.ModuleName+"@latest")
+		if err == nil {
+			infof("required %s at its latest version", r.ModuleName)
+			continue
+		}
+
+		if !isNoVersionError(err) {
+			return errors.Wrapf(err, "failed to require %s", r.ModuleName)
+		}
+
+		debugf("%v", err)
+		warnf("%s has no published version, requiring %s which only works while it's replaced", r.ModuleName, zeroPseudoVersion)
+		if err = gomod(modRoot, "edit", fmt.Sprintf("-require=%s@%s", r.ModuleName, zeroPseudoVersion)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isNoVersionError reports whether err from goGet means the module has no
+// published version, see noVersionErrors
+func isNoVersionError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	for _, s := range noVersionErrors {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// goGet runs go get -d with the args in dir
+func goGet(dir string, args ...string) error {
+	if dryRun {
+		infof("would run: go get -d %s (in %s)", strings.Join(args, " "), dir)
+		return nil
+	}
+
+	arguments := append([]string{"get", "-d"}, args...)
+	cmd := exec.Command(goCommand(), arguments...)
+	cmd.Dir = dir
+	debugf("running: go %s (in %s)", strings.Join(arguments, " "), cmd.Dir)
+	if b, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("go %s failed: %s", strings.Join(arguments, " "), strings.TrimSpace(string(b)))
+	} else if out := strings.TrimSpace(string(b)); len(out) != 0 {
+		debugf("%s", out)
+	}
+
+	return nil
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// savedSetsDirname is the directory inside gomrDirname that holds the named
+// copies of the gomr files made by snapshot save, one directory per name
+const savedSetsDirname = "saved"
+
+var savedSetCmd = &cobra.Command{
+	Use:   "snapshot <command>",
+	Short: "Save and load named sets of stored replaces",
+	Long: `Save and load named sets of stored replaces
+
+snapshot save copies the gomr file, and the personal local file if there is
+one, under a name and snapshot load puts them back, so you can switch between
+sets of replaces like "full local stack" and "only the SDK". These are
+separate from the go.mod snapshots restore uses.`,
+}
+
+var savedSetSaveCmd = &cobra.Command{
+	Use:          "save [flags] <name>",
+	Short:        "Save the stored replaces under a name",
+	RunE:         savedSetSaveRun,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+}
+
+var savedSetLoadCmd = &cobra.Command{
+	Use:   "load <name>",
+	Short: "Replace the stored replaces with a saved set",
+	Long: `Replace the stored replaces with a saved set
+
+When replaces are installed the current ones are removed from go.mod and the
+saved ones in the default profile are installed instead, so go.mod follows
+the switch. Otherwise only the gomr files change. undo switches back.`,
+	RunE:         savedSetLoadRun,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+}
+
+var savedSetListCmd = &cobra.Command{
+	Use:          "list",
+	Short:        "List the saved sets",
+	RunE:         savedSetListRun,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+}
+
+var savedSetDeleteCmd = &cobra.Command{
+	Use:          "delete <name>",
+	Short:        "Delete a saved set",
+	RunE:         savedSetDeleteRun,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+}
+
+func savedSetSaveRun(cmd *cobra.Command, args []string) error {
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
+
+	modRoot, dir, err := savedSetDir(args[0])
+	if err != nil {
+		return err
+	}
+
+	lock, err := lockModule(modRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	if _, err = os.Stat(dir); err == nil && !force {
+		return fmt.Errorf("a set named %s is already saved, use --force to overwrite it", args[0])
+	}
+
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return err
+	}
+	stored, err := readGomrFile(gomrFilePath)
+	if err != nil {
+		return err
+	}
+
+	if !dryRun {
+		if err = os.RemoveAll(dir); err != nil {
+			return errors.Wrapf(err, "failed to replace saved set %s", args[0])
+		}
+	}
+	for _, path := range []string{gomrFilePath, gomrFilePath + gomrLocalSuffix} {
+		b, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "failed to read %s", path)
+		}
+		if err = writeFile(filepath.Join(dir, filepath.Base(path)), b, 0664); err != nil {
+			return errors.Wrapf(err, "failed to save %s", path)
+		}
+	}
+
+	infof("saved %d replace(s) as %s", len(stored), args[0])
+	return nil
+}
+
+func savedSetLoadRun(cmd *cobra.Command, args []string) error {
+	modRoot, dir, err := savedSetDir(args[0])
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(dir); os.IsNotExist(err) {
+		return fmt.Errorf("no set named %s is saved, snapshot list shows the saved sets", args[0])
+	} else if err != nil {
+		return err
+	}
+
+	lock, err := lockModule(modRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return err
+	}
+	current, err := readGomrFile(gomrFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	saved, err := readGomrFile(filepath.Join(dir, gomrFilename))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// Relative paths were resolved against the saved copy, they're relative
+	// to the gomr file once it's loaded
+	for i, r := range saved {
+		if rel, err := filepath.Rel(dir, r.AbsPath); r.relative && err == nil {
+			saved[i].AbsPath = filepath.Join(filepath.Dir(gomrFilePath), rel)
+		}
+	}
+
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		return err
+	}
+	installed := len(appliedReplaces(mod, enabledReplaces(current))) != 0
+
+	cfg, err := loadConfig(modRoot)
+	if err != nil {
+		return err
+	}
+	installs := enabledReplaces(filterProfile(saved, cfg.Profile))
+
+	files, err := moduleFiles(modRoot, append(append([]replace{}, current...), saved...))
+	if err != nil {
+		return err
+	}
+	tx, err := beginTransaction(files...)
+	if err != nil {
+		return err
+	}
+
+	err = recordOperation(modRoot, "snapshot load "+args[0], files, func() error {
+		return tx.run(func() error {
+			if installed {
+				applied := enabledReplaces(current)
+				if err := uninstallReplaces(modRoot, applied, false); err != nil {
+					return err
+				}
+				if err := restoreRequires(modRoot, applied); err != nil {
+					return err
+				}
+				if err := restoreGoSum(modRoot); err != nil {
+					return err
+				}
+			}
+
+			for _, path := range []string{gomrFilePath, gomrFilePath + gomrLocalSuffix} {
+				b, err := ioutil.ReadFile(filepath.Join(dir, filepath.Base(path)))
+				if os.IsNotExist(err) {
+					if err = removeFile(path); err != nil && !os.IsNotExist(err) {
+						return err
+					}
+					continue
+				} else if err != nil {
+					return err
+				}
+				if err = writeFile(path, b, 0664); err != nil {
+					return err
+				}
+			}
+
+			if !installed || len(installs) == 0 {
+				return nil
+			}
+			if err := recordRequires(modRoot, installs); err != nil {
+				return err
+			}
+			if err := backupGoSum(modRoot); err != nil {
+				return err
+			}
+			return installReplaces(modRoot, installs)
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	infof("loaded %d replace(s) from %s", len(saved), args[0])
+	if installed {
+		infof("installed %d replace(s) in place of the ones from before", len(installs))
+	}
+	return nil
+}
+
+func savedSetListRun(cmd *cobra.Command, args []string) error {
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	names, err := savedSetNames(modRoot)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		infof("no saved sets")
+	}
+
+	state, err := stateDir(modRoot)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		saved, err := readGomrFile(filepath.Join(state, savedSetsDirname, name, gomrFilename))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		modules := make([]string, len(saved))
+		for i, r := range saved {
+			modules[i] = r.ModuleName
+		}
+		outputf("%s: %s", name, strings.Join(modules, ", "))
+	}
+	return nil
+}
+
+func savedSetDeleteRun(cmd *cobra.Command, args []string) error {
+	_, dir, err := savedSetDir(args[0])
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(dir); os.IsNotExist(err) {
+		return fmt.Errorf("no set named %s is saved", args[0])
+	}
+
+	if dryRun {
+		infof("would delete: %s", dir)
+		return nil
+	}
+	if err = os.RemoveAll(dir); err != nil {
+		return errors.Wrapf(err, "failed to delete saved set %s", args[0])
+	}
+
+	infof("deleted saved set %s", args[0])
+	return nil
+}
+
+// savedSetDir returns the module root and the directory a set saved under
+// name is kept in
+func savedSetDir(name string) (string, string, error) {
+	if len(name) == 0 || strings.HasPrefix(name, ".") || strings.ContainsAny(name, `/\`) {
+		return "", "", fmt.Errorf("invalid name %q, names can't start with a dot or contain slashes", name)
+	}
+
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return "", "", err
+	}
+	state, err := stateDir(modRoot)
+	if err != nil {
+		return "", "", err
+	}
+
+	return modRoot, filepath.Join(state, savedSetsDirname, name), nil
+}
+
+// savedSetNames returns the names of the saved sets, sorted
+func savedSetNames(modRoot string) ([]string, error) {
+	state, err := stateDir(modRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := ioutil.ReadDir(filepath.Join(state, savedSetsDirname))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to read the saved sets")
+	}
+
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,590 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	// rpcCommandFailed is returned when the gomr command behind a method
+	// fails, its exit code is in the error's data
+	rpcCommandFailed = -32000
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve [flags]",
+	Short: "Serve gomr to editors over JSON-RPC",
+	Long: `Serve gomr to editors over JSON-RPC
+
+Speaks JSON-RPC 2.0 on stdin and stdout, or on a unix socket with --socket,
+one message per line. The methods are:
+
+  list    {"profile"}                         the stored replaces
+  status  {"profile"}                         list with the git state of checkouts
+  add     {"module", "path", "profiles", "require"}
+  remove  {"modules"}
+  up      {"modules", "profile"}
+  down    {"modules", "profile"}
+  events  {}                                  sends a "changed" notification with
+                                              the file whenever go.mod or the gomr
+                                              file changes
+
+add, remove, up and down work like the commands and return the messages they
+print. When one fails the error's data has its exit code and messages.`,
+	RunE:         serveRun,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+}
+
+// rpcRequest is a JSON-RPC request, or a notification when it has no id
+type rpcRequest struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Method  string           `json:"method"`
+	Params  json.RawMessage  `json:"params"`
+}
+
+// rpcResponse is the answer to a request with an id, it has either a result
+// or an error
+type rpcResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  interface{}      `json:"result,omitempty"`
+	Error   *rpcError        `json:"error,omitempty"`
+}
+
+// rpcNotification is a message sent without being asked for
+type rpcNotification struct {
+	JSONRPC string      `json:"jsonrpc"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type rpcError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// serveMessage is a message a command printed
+type serveMessage struct {
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+// serveOutput is the result of add, remove, up and down, and the data of
+// their errors
+type serveOutput struct {
+	ExitCode int            `json:"exit_code"`
+	Messages []serveMessage `json:"messages"`
+}
+
+// serveReplace is a stored replace for list and status
+type serveReplace struct {
+	Module      string        `json:"module"`
+	Replacement string        `json:"replacement"`
+	Applied     bool          `json:"applied"`
+	Disabled    bool          `json:"disabled"`
+	Missing     bool          `json:"missing"`
+	Dirty       bool          `json:"dirty"`
+	Conflict    string        `json:"conflict,omitempty"`
+	Ref         string        `json:"ref,omitempty"`
+	Profiles    []string      `json:"profiles,omitempty"`
+	Modules     []string      `json:"modules,omitempty"`
+	Note        string        `json:"note,omitempty"`
+	Git         *serveGitInfo `json:"git,omitempty"`
+}
+
+// serveGitInfo is the git state of a checkout for status
+type serveGitInfo struct {
+	Branch   string `json:"branch"`
+	Upstream bool   `json:"upstream"`
+	Ahead    int    `json:"ahead"`
+	Behind   int    `json:"behind"`
+	Error    string `json:"error,omitempty"`
+}
+
+type serveParams struct {
+	Module   string   `json:"module"`
+	Path     string   `json:"path"`
+	Modules  []string `json:"modules"`
+	Profile  string   `json:"profile"`
+	Profiles []string `json:"profiles"`
+	Require  bool     `json:"require"`
+}
+
+// server is the state shared by the connections of serve
+type server struct {
+	modRoot string
+	// flags are the values of the persistent flags serve was started with,
+	// every command runs with them
+	flags map[string]savedFlag
+
+	// run is held while a command runs, they change global state like the
+	// flags and how messages are emitted. Everything else that logs or reads
+	// the flags holds it too.
+	run sync.Mutex
+
+	events  sync.Mutex
+	watcher *fsnotify.Watcher
+	subs    map[*serveConn]bool
+}
+
+// savedFlag is the value of a flag to put back after a command ran
+type savedFlag struct {
+	value   string
+	slice   []string
+	changed bool
+}
+
+// serveConn is a connection to a client, messages to it are written whole
+// since notifications are sent from another goroutine
+type serveConn struct {
+	s   *server
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (c *serveConn) send(v interface{}) {
+	c.mu.Lock()
+	err := c.enc.Encode(v)
+	c.mu.Unlock()
+	if err != nil {
+		c.s.debugf("failed to send to client: %v", err)
+	}
+}
+
+func serveRun(cmd *cobra.Command, args []string) error {
+	socket, err := cmd.Flags().GetString("socket")
+	if err != nil {
+		return err
+	}
+
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	s := &server{
+		modRoot: modRoot,
+		flags:   saveFlags(rootCmd.PersistentFlags()),
+		subs:    make(map[*serveConn]bool),
+	}
+	defer s.stopEvents()
+
+	if len(socket) == 0 {
+		// Anything the commands print or read besides the messages, like the
+		// output of hooks, must stay out of the JSON-RPC stream
+		in, out := os.Stdin, os.Stdout
+		devNull, err := os.Open(os.DevNull)
+		if err != nil {
+			return err
+		}
+		defer devNull.Close()
+		os.Stdin, os.Stdout = devNull, os.Stderr
+		defer func() { os.Stdin, os.Stdout = in, out }()
+
+		s.serveConn(in, out)
+		return nil
+	}
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return errors.Wrapf(err, "failed to listen on %s, if no gomr serve is using it delete it", socket)
+	}
+	defer listener.Close()
+
+	trap := trapSignals()
+	defer trap.stop()
+	go func() {
+		<-trap.signals
+		listener.Close()
+	}()
+
+	infof("serving %s on %s", modRoot, socket)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			// Closing the listener on a signal is how serving stops
+			s.debugf("%v", err)
+			return nil
+		}
+
+		go func() {
+			defer conn.Close()
+			s.serveConn(conn, conn)
+		}()
+	}
+}
+
+// serveConn answers the requests read from r until it's closed
+func (s *server) serveConn(r io.Reader, w io.Writer) {
+	conn := &serveConn{s: s, enc: json.NewEncoder(w)}
+	defer s.unsubscribe(conn)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+
+		var req rpcRequest
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			conn.send(rpcResponse{JSONRPC: "2.0", Error: &rpcError{Code: rpcParseError, Message: err.Error()}})
+			continue
+		}
+		if req.JSONRPC != "2.0" || len(req.Method) == 0 {
+			conn.send(rpcResponse{JSONRPC: "2.0", ID: req.ID, Error: &rpcError{Code: rpcInvalidRequest, Message: "not a JSON-RPC 2.0 request"}})
+			continue
+		}
+
+		result, rpcErr := s.call(conn, req.Method, req.Params)
+		if req.ID == nil {
+			continue
+		}
+		conn.send(rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result, Error: rpcErr})
+	}
+
+	if err := scanner.Err(); err != nil {
+		s.debugf("failed to read from client: %v", err)
+	}
+}
+
+// call runs a method for conn
+func (s *server) call(conn *serveConn, method string, raw json.RawMessage) (interface{}, *rpcError) {
+	var params serveParams
+	if len(raw) != 0 && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &params); err != nil {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: err.Error()}
+		}
+	}
+
+	switch method {
+	case "list", "status":
+		s.run.Lock()
+		replaces, err := s.replaces(params.Profile, method == "status")
+		s.run.Unlock()
+		if err != nil {
+			return nil, &rpcError{Code: rpcCommandFailed, Message: err.Error(), Data: serveOutput{ExitCode: exitCode(err)}}
+		}
+		return map[string]interface{}{"replaces": replaces}, nil
+
+	case "add":
+		if len(params.Module) == 0 {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: "add needs a module"}
+		}
+		args := []string{"add"}
+		for _, p := range params.Profiles {
+			args = append(args, "--profile", p)
+		}
+		if params.Require {
+			args = append(args, "--require")
+		}
+		args = append(args, "--", params.Module)
+		if len(params.Path) != 0 {
+			args = append(args, params.Path)
+		}
+		return s.runCommand(args)
+
+	case "remove":
+		if len(params.Modules) == 0 {
+			return nil, &rpcError{Code: rpcInvalidParams, Message: "remove needs modules"}
+		}
+		return s.runCommand(append([]string{"remove", "--"}, params.Modules...))
+
+	case "up", "down":
+		args := []string{method}
+		if len(params.Profile) != 0 {
+			args = append(args, "--profile", params.Profile)
+		}
+		return s.runCommand(append(append(args, "--"), params.Modules...))
+
+	case "events":
+		s.run.Lock()
+		err := s.subscribe(conn)
+		s.run.Unlock()
+		if err != nil {
+			return nil, &rpcError{Code: rpcCommandFailed, Message: err.Error()}
+		}
+		return true, nil
+	}
+
+	return nil, &rpcError{Code: rpcMethodNotFound, Message: fmt.Sprintf("unknown method %q", method)}
+}
+
+// runCommand runs gomr with args the way it runs from the command line and
+// collects the messages it prints instead of printing them
+func (s *server) runCommand(args []string) (interface{}, *rpcError) {
+	s.run.Lock()
+	defer s.run.Unlock()
+
+	// Flags keep their values between runs, they're put back to their
+	// defaults so a run only has the flags it was given. The command's flags
+	// include the persistent ones once it has run, those are put back to
+	// what serve was started with instead.
+	if c, _, err := rootCmd.Find(args); err == nil {
+		resetFlags(c.Flags())
+	}
+	restoreFlags(rootCmd.PersistentFlags(), s.flags)
+
+	output := serveOutput{Messages: []serveMessage{}}
+	printEntry := emit
+	emit = func(e logEntry) {
+		output.Messages = append(output.Messages, serveMessage{Level: serveLevel(e.Level), Message: e.Message})
+	}
+	defer func() { emit = printEntry }()
+
+	rootCmd.SetArgs(append([]string{"--no-color"}, args...))
+	rootCmd.SetOut(ioutil.Discard)
+	rootCmd.SetErr(ioutil.Discard)
+	defer rootCmd.SetOut(nil)
+	defer rootCmd.SetErr(nil)
+
+	if _, err := rootCmd.ExecuteC(); err != nil {
+		output.ExitCode = exitCode(err)
+		return nil, &rpcError{Code: rpcCommandFailed, Message: err.Error(), Data: output}
+	}
+	return output, nil
+}
+
+// resetFlags puts every flag in flags back to its default
+func resetFlags(flags *pflag.FlagSet) {
+	flags.VisitAll(func(f *pflag.Flag) {
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			slice.Replace(nil)
+		} else if err := f.Value.Set(f.DefValue); err != nil {
+			debugf("failed to reset --%s: %v", f.Name, err)
+		}
+		f.Changed = false
+	})
+}
+
+// saveFlags returns the current value of every flag in flags
+func saveFlags(flags *pflag.FlagSet) map[string]savedFlag {
+	saved := make(map[string]savedFlag)
+	flags.VisitAll(func(f *pflag.Flag) {
+		sf := savedFlag{value: f.Value.String(), changed: f.Changed}
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			sf.slice = slice.GetSlice()
+		}
+		saved[f.Name] = sf
+	})
+	return saved
+}
+
+// restoreFlags puts the flags in flags back to the values saved by saveFlags
+func restoreFlags(flags *pflag.FlagSet, saved map[string]savedFlag) {
+	flags.VisitAll(func(f *pflag.Flag) {
+		sf, ok := saved[f.Name]
+		if !ok {
+			return
+		}
+
+		if slice, ok := f.Value.(pflag.SliceValue); ok {
+			slice.Replace(sf.slice)
+		} else if err := f.Value.Set(sf.value); err != nil {
+			debugf("failed to restore --%s: %v", f.Name, err)
+		}
+		f.Changed = sf.changed
+	})
+}
+
+// debugf logs while no command is running, commands change where messages
+// go and which are shown
+func (s *server) debugf(format string, args ...interface{}) {
+	s.run.Lock()
+	defer s.run.Unlock()
+	debugf(format, args...)
+}
+
+// serveLevel names a message's level for clients
+func serveLevel(level logLevel) string {
+	switch level {
+	case levelDebug:
+		return "debug"
+	case levelWarn:
+		return "warning"
+	case levelOutput:
+		return "output"
+	}
+	return "info"
+}
+
+// replaces describes the stored replaces in profile, or the project's
+// default profile, with the git state of their checkouts when details is set
+func (s *server) replaces(profile string, details bool) ([]serveReplace, error) {
+	if len(profile) == 0 {
+		cfg, err := loadConfig(s.modRoot)
+		if err != nil {
+			return nil, err
+		}
+		profile = cfg.Profile
+	}
+
+	stored, err := storedReplaces(s.modRoot)
+	if err != nil {
+		return nil, err
+	}
+	replaces := filterProfile(stored, profile)
+
+	mod, err := readGoMod(s.modRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts := make(map[string]string)
+	for _, c := range conflictingReplaces(s.modRoot, mod, enabledReplaces(replaces)) {
+		conflicts[strings.ToLower(c.ModuleName)] = c.current
+	}
+
+	states := readGitStates(replaces, details)
+	infos := make([]serveReplace, 0, len(replaces))
+	for i, r := range replaces {
+		info := serveReplace{
+			Module:      r.ModuleName,
+			Replacement: r.replacement(),
+			Applied:     !r.Disabled && len(appliedReplaces(mod, []replace{r})) != 0,
+			Disabled:    r.Disabled,
+			Dirty:       states[i].dirty,
+			Conflict:    conflicts[strings.ToLower(r.ModuleName)],
+			Ref:         r.Ref,
+			Profiles:    r.Profiles,
+			Modules:     r.Modules,
+			Note:        r.Note,
+		}
+		if !r.isRemote() {
+			_, err := os.Stat(r.rootPath())
+			info.Missing = err != nil
+		}
+		if details && states[i].repo {
+			info.Git = &serveGitInfo{
+				Branch:   states[i].branch,
+				Upstream: states[i].upstream,
+				Ahead:    states[i].ahead,
+				Behind:   states[i].behind,
+			}
+			if states[i].err != nil {
+				info.Git.Error = states[i].err.Error()
+			}
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+// subscribe sends conn a changed notification for each change to go.mod or
+// the gomr file, go.mod is watched once the first client subscribes
+func (s *server) subscribe(conn *serveConn) error {
+	s.events.Lock()
+	defer s.events.Unlock()
+
+	if s.watcher == nil {
+		gomrFilePath, err := storeFilePath(s.modRoot)
+		if err != nil {
+			return err
+		}
+
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return errors.Wrap(err, "failed to start watching go.mod")
+		}
+		dirs := []string{s.modRoot}
+		if dir := filepath.Dir(gomrFilePath); !sameDir(dir, s.modRoot) {
+			dirs = append(dirs, dir)
+		}
+		for _, dir := range dirs {
+			if err = watcher.Add(dir); err != nil {
+				watcher.Close()
+				return errors.Wrapf(err, "failed to watch %s", dir)
+			}
+		}
+
+		s.watcher = watcher
+		go s.sendEvents(watcher, []string{filepath.Join(s.modRoot, "go.mod"), gomrFilePath})
+	}
+
+	s.subs[conn] = true
+	return nil
+}
+
+func (s *server) unsubscribe(conn *serveConn) {
+	s.events.Lock()
+	defer s.events.Unlock()
+	delete(s.subs, conn)
+}
+
+func (s *server) stopEvents() {
+	s.events.Lock()
+	defer s.events.Unlock()
+	if s.watcher != nil {
+		s.watcher.Close()
+	}
+}
+
+// sendEvents notifies the subscribers about changes to the files once
+// they've settled, until the watcher is closed
+func (s *server) sendEvents(watcher *fsnotify.Watcher, files []string) {
+	changed := make(map[string]bool)
+	var settle <-chan time.Time
+
+	for {
+		select {
+		case e, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if e.Op&^fsnotify.Chmod == 0 {
+				continue
+			}
+			for _, f := range files {
+				if filepath.Clean(e.Name) == f {
+					changed[f] = true
+					settle = time.After(watchSettle)
+				}
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			s.debugf("watching for events: %v", err)
+		case <-settle:
+			settle = nil
+			// Sending can log, which waits for a running command, so the
+			// subscribers aren't locked meanwhile
+			s.events.Lock()
+			subs := make([]*serveConn, 0, len(s.subs))
+			for conn := range s.subs {
+				subs = append(subs, conn)
+			}
+			s.events.Unlock()
+			for f := range changed {
+				for _, conn := range subs {
+					conn.send(rpcNotification{JSONRPC: "2.0", Method: "changed", Params: map[string]string{"file": f}})
+				}
+			}
+			changed = make(map[string]bool)
+		}
+	}
+}
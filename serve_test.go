@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+var setupOnce sync.Once
+
+// testModule makes a module with a checkout of a library next to it and
+// changes into it, the returned func changes back and deletes them
+func testModule(t *testing.T) (string, string, func()) {
+	t.Helper()
+	setupOnce.Do(setupCommands)
+
+	dir, err := ioutil.TempDir("", "gomr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err = filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app, lib := filepath.Join(dir, "app"), filepath.Join(dir, "lib")
+	files := map[string]string{
+		filepath.Join(app, "go.mod"): "module example.com/app\n\ngo 1.13\n",
+		filepath.Join(lib, "go.mod"): "module example.com/lib\n\ngo 1.13\n",
+	}
+	for path, contents := range files {
+		if err = os.MkdirAll(filepath.Dir(path), 0775); err != nil {
+			t.Fatal(err)
+		}
+		if err = ioutil.WriteFile(path, []byte(contents), 0664); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(app); err != nil {
+		t.Fatal(err)
+	}
+
+	return app, lib, func() {
+		os.Chdir(wd)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestServeConcurrentRequests(t *testing.T) {
+	app, lib, cleanup := testModule(t)
+	defer cleanup()
+
+	// Debug messages are logged on every path, which is what races
+	verbose = true
+	defer func() { verbose = false }()
+
+	s := &server{modRoot: app, flags: saveFlags(rootCmd.PersistentFlags()), subs: make(map[*serveConn]bool)}
+	conn := &serveConn{s: s, enc: json.NewEncoder(ioutil.Discard)}
+
+	add, _ := json.Marshal(serveParams{Module: "example.com/lib", Path: lib})
+	remove, _ := json.Marshal(serveParams{Modules: []string{"example.com/lib"}})
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 5; i++ {
+			if _, err := s.call(conn, "add", add); err != nil {
+				t.Errorf("add failed: %s", err.Message)
+			}
+			if _, err := s.call(conn, "remove", remove); err != nil {
+				t.Errorf("remove failed: %s", err.Message)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			if _, err := s.call(conn, "list", nil); err != nil {
+				t.Errorf("list failed: %s", err.Message)
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+func TestServeKeepsPersistentFlags(t *testing.T) {
+	app, lib, cleanup := testModule(t)
+	defer cleanup()
+
+	// serve started with --dry-run, every command it runs is a dry run
+	if err := rootCmd.PersistentFlags().Set("dry-run", "true"); err != nil {
+		t.Fatal(err)
+	}
+	s := &server{modRoot: app, flags: saveFlags(rootCmd.PersistentFlags()), subs: make(map[*serveConn]bool)}
+	defer restoreFlags(rootCmd.PersistentFlags(), map[string]savedFlag{"dry-run": {value: "false"}})
+	conn := &serveConn{s: s, enc: json.NewEncoder(ioutil.Discard)}
+
+	add, _ := json.Marshal(serveParams{Module: "example.com/lib", Path: lib})
+	for i := 0; i < 2; i++ {
+		if _, err := s.call(conn, "add", add); err != nil {
+			t.Fatalf("add failed: %s", err.Message)
+		}
+		if !dryRun {
+			t.Fatalf("run %d: --dry-run was reset", i)
+		}
+		if _, err := os.Stat(filepath.Join(app, gomrFilename)); !os.IsNotExist(err) {
+			t.Fatalf("run %d: the gomr file was written, err: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/spf13/cobra"
+)
+
+var shellCmd = &cobra.Command{
+	Use:   "shell [flags]",
+	Short: "Start a subshell with the stored replaces applied",
+	Long: `Start a subshell with the stored replaces applied
+
+When the shell exits the replaces are removed and go.mod and go.sum are put
+back exactly as they were before the shell started.`,
+	RunE:         shellRun,
+	SilenceUsage: true,
+}
+
+func shellRun(cmd *cobra.Command, args []string) error {
+	modRoot, replaces, err := loadReplaces(cmd)
+	if err != nil {
+		return err
+	}
+
+	return withReplaces(modRoot, replaces, func() error {
+		infof("replace lines installed, exit the shell to remove them")
+
+		c := exec.Command(userShell())
+		c.Stdin = os.Stdin
+		c.Stdout = os.Stdout
+		c.Stderr = os.Stderr
+		c.Env = append(os.Environ(), "GOMR_SHELL="+modRoot)
+		err := runForwardingSignals(c)
+
+		// The exit status of the shell is whatever the last command run in it
+		// returned, that's not a failure of ours.
+		if _, ok := err.(*exec.ExitError); ok {
+			err = nil
+		}
+
+		infof("replace lines removed")
+		return err
+	})
+}
+
+// userShell returns the user's preferred shell
+func userShell() string {
+	if runtime.GOOS == "windows" {
+		if sh := os.Getenv("COMSPEC"); len(sh) != 0 {
+			return sh
+		}
+		return "cmd.exe"
+	}
+
+	if sh := os.Getenv("SHELL"); len(sh) != 0 {
+		return sh
+	}
+	return "/bin/sh"
+}
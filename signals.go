@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+)
+
+// signalTrap keeps SIGINT and SIGTERM from killing gomr while it has the
+// module half modified, so it can put the module back before exiting.
+type signalTrap struct {
+	signals chan os.Signal
+	caught  os.Signal
+}
+
+// trapSignals starts trapping signals until stop is called
+func trapSignals() *signalTrap {
+	t := &signalTrap{signals: make(chan os.Signal, 1)}
+	signal.Notify(t.signals, os.Interrupt, syscall.SIGTERM)
+	return t
+}
+
+// signal returns the signal that was trapped, or nil if there wasn't one
+func (t *signalTrap) signal() os.Signal {
+	if t.caught == nil {
+		select {
+		case t.caught = <-t.signals:
+		default:
+		}
+	}
+	return t.caught
+}
+
+// stop stops trapping signals, one that arrives afterwards kills gomr as
+// usual
+func (t *signalTrap) stop() {
+	signal.Stop(t.signals)
+}
+
+// runForwardingSignals runs c, passing a SIGTERM sent to gomr on to it. A
+// Ctrl-C in the terminal already reaches c since it's in the same process
+// group. gomr keeps running until c exits so it can clean up after it.
+func runForwardingSignals(c *exec.Cmd) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	if err := c.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case s := <-signals:
+				c.Process.Signal(s)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return c.Wait()
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// snapshotsDirname is the directory inside gomrDirname that holds the
+	// go.mod and go.sum snapshots, one directory per snapshot named after
+	// when it was taken.
+	snapshotsDirname = "backups"
+	// snapshotTimeFormat is the format of the snapshot directory names
+	snapshotTimeFormat = "20060102-150405"
+	// maxSnapshots is how many snapshots are kept, older ones are deleted
+	maxSnapshots = 50
+)
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore [timestamp]",
+	Short: "Restore go.mod and go.sum from a snapshot taken before gomr edited them",
+	Long: `Restore go.mod and go.sum from a snapshot taken before gomr edited them.
+
+Without a timestamp the most recent snapshot that differs from the current
+go.mod and go.sum is restored. --list shows the snapshots.`,
+	RunE:         restoreRun,
+	Args:         cobra.MaximumNArgs(1),
+	SilenceUsage: true,
+}
+
+func restoreRun(cmd *cobra.Command, args []string) error {
+	list, err := cmd.Flags().GetBool("list")
+	if err != nil {
+		return err
+	}
+
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	if list {
+		names, err := snapshotNames(modRoot)
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			infof("no snapshots")
+		}
+		for _, name := range names {
+			outputf("%s", name)
+		}
+		return nil
+	}
+
+	// Taking the lock snapshots the current state so the restore itself can
+	// be undone with another restore
+	lock, err := lockModule(modRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	name := ""
+	if len(args) != 0 {
+		name = args[0]
+	} else if name, err = previousSnapshot(modRoot); err != nil {
+		return err
+	}
+
+	if err = restoreSnapshot(modRoot, name); err != nil {
+		return err
+	}
+
+	infof("restored go.mod and go.sum from %s", name)
+	return nil
+}
+
+// snapshotsDir returns the directory the snapshots for modRoot are kept in
+func snapshotsDir(modRoot string) (string, error) {
+	dir, err := stateDir(modRoot)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, snapshotsDirname), nil
+}
+
+// snapshotNames returns the names of the snapshots of modRoot, oldest first
+func snapshotNames(modRoot string) ([]string, error) {
+	dir, err := snapshotsDir(modRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	infos, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to read snapshots")
+	}
+
+	var names []string
+	for _, info := range infos {
+		if info.IsDir() {
+			names = append(names, info.Name())
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// readGoFiles reads the go.mod and go.sum in dir, a go.sum that doesn't
+// exist is nil
+func readGoFiles(dir string) (goMod, goSum []byte, err error) {
+	goMod, err = ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	goSum, err = ioutil.ReadFile(filepath.Join(dir, "go.sum"))
+	if os.IsNotExist(err) {
+		return goMod, nil, nil
+	}
+	return goMod, goSum, err
+}
+
+// snapshotGoMod saves a copy of the go.mod and go.sum in modRoot unless
+// they're the same as in the latest snapshot, and deletes the oldest
+// snapshots once there are more than maxSnapshots.
+func snapshotGoMod(modRoot string) error {
+	if dryRun {
+		return nil
+	}
+
+	goMod, goSum, err := readGoFiles(modRoot)
+	if err != nil {
+		return errors.Wrap(err, "failed to read go.mod for snapshot")
+	}
+
+	names, err := snapshotNames(modRoot)
+	if err != nil {
+		return err
+	}
+	dir, err := snapshotsDir(modRoot)
+	if err != nil {
+		return err
+	}
+
+	if len(names) != 0 {
+		lastMod, lastSum, err := readGoFiles(filepath.Join(dir, names[len(names)-1]))
+		if err == nil && bytes.Equal(goMod, lastMod) && bytes.Equal(goSum, lastSum) {
+			return nil
+		}
+	}
+
+	// Snapshots taken in the same second get a counter so none are lost
+	name := time.Now().Format(snapshotTimeFormat)
+	for i := 2; containsString(names, name); i++ {
+		name = fmt.Sprintf("%s-%02d", time.Now().Format(snapshotTimeFormat), i)
+	}
+
+	snapDir := filepath.Join(dir, name)
+	if err = os.MkdirAll(snapDir, 0775); err != nil {
+		return errors.Wrap(err, "failed to create snapshot dir")
+	}
+	if err = ioutil.WriteFile(filepath.Join(snapDir, "go.mod"), goMod, 0664); err != nil {
+		return errors.Wrap(err, "failed to snapshot go.mod")
+	}
+	if goSum != nil {
+		if err = ioutil.WriteFile(filepath.Join(snapDir, "go.sum"), goSum, 0664); err != nil {
+			return errors.Wrap(err, "failed to snapshot go.sum")
+		}
+	}
+
+	names = append(names, name)
+	for len(names) > maxSnapshots {
+		if err = os.RemoveAll(filepath.Join(dir, names[0])); err != nil {
+			return errors.Wrap(err, "failed to remove old snapshot")
+		}
+		names = names[1:]
+	}
+
+	return nil
+}
+
+// previousSnapshot finds the most recent snapshot that's different from the
+// current go.mod and go.sum in modRoot
+func previousSnapshot(modRoot string) (string, error) {
+	goMod, goSum, err := readGoFiles(modRoot)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read go.mod")
+	}
+
+	names, err := snapshotNames(modRoot)
+	if err != nil {
+		return "", err
+	}
+	dir, err := snapshotsDir(modRoot)
+	if err != nil {
+		return "", err
+	}
+
+	for i := len(names) - 1; i >= 0; i-- {
+		snapMod, snapSum, err := readGoFiles(filepath.Join(dir, names[i]))
+		if err != nil {
+			continue
+		}
+		if !bytes.Equal(goMod, snapMod) || !bytes.Equal(goSum, snapSum) {
+			return names[i], nil
+		}
+	}
+
+	return "", errors.New("no snapshot differs from the current go.mod and go.sum")
+}
+
+// restoreSnapshot writes the go.mod and go.sum from the named snapshot to
+// modRoot. A go.sum is deleted if there wasn't one when the snapshot was
+// taken.
+func restoreSnapshot(modRoot, name string) error {
+	dir, err := snapshotsDir(modRoot)
+	if err != nil {
+		return err
+	}
+
+	goMod, goSum, err := readGoFiles(filepath.Join(dir, filepath.Base(name)))
+	if os.IsNotExist(err) {
+		return errors.Errorf("no snapshot named %s, see restore --list", name)
+	} else if err != nil {
+		return errors.Wrapf(err, "failed to read snapshot %s", name)
+	}
+
+	if err = writeFile(filepath.Join(modRoot, "go.mod"), goMod, 0664); err != nil {
+		return errors.Wrap(err, "failed to restore go.mod")
+	}
+
+	goSumPath := filepath.Join(modRoot, "go.sum")
+	if goSum == nil {
+		err = removeFile(goSumPath)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	} else {
+		err = writeFile(goSumPath, goSum, 0664)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to restore go.sum")
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status [flags]",
+	Short: "Show the stored replaces with the git state of their checkouts",
+	Long: `Show the stored replaces with the git state of their checkouts
+
+With --porcelain each replace is printed on one tab separated line for
+scripts, with the same fields as list --porcelain followed by the git state
+of the checkout:
+
+  <state> <module> <replacement> <path> <profiles> <branch> <tree> <ahead> <behind>
+
+tree is clean, dirty or error, and ahead and behind count the commits
+compared to the branch's upstream. Fields that don't apply, like the branch
+of a checkout that isn't a git repository, are -. Replaces in go.mod that
+gomr doesn't manage follow as:
+
+  unmanaged <module> <replacement>
+
+New fields are only ever added at the end.`,
+	RunE: statusRun,
+}
+
+func statusRun(cmd *cobra.Command, args []string) error {
+	return printReplaces(cmd, true)
+}
+
+// gitStatus describes the branch of a checkout and how far it is from its
+// upstream for status
+func gitStatus(state gitState) string {
+	if !state.repo {
+		return ""
+	}
+	if state.err != nil {
+		return colorize(colorRed, state.err.Error())
+	}
+
+	parts := []string{"on " + state.branch}
+	if state.dirty {
+		parts = append(parts, colorize(colorYellow, "dirty"))
+	} else {
+		parts = append(parts, "clean")
+	}
+
+	switch {
+	case !state.upstream:
+		parts = append(parts, "no upstream")
+	case state.ahead == 0 && state.behind == 0:
+		parts = append(parts, "up to date")
+	default:
+		if state.ahead != 0 {
+			parts = append(parts, fmt.Sprintf("%d ahead", state.ahead))
+		}
+		if state.behind != 0 {
+			parts = append(parts, colorize(colorYellow, fmt.Sprintf("%d behind", state.behind)))
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
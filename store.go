@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"golang.org/x/mod/modfile"
+)
+
+const (
+	// storeDirname is the directory in the user config dir that the gomr
+	// files are kept in when using the global store.
+	storeDirname = "store"
+)
+
+// globalStore is set by the --global-store flag
+var globalStore bool
+
+// storeDir returns the directory that gomr's files for the module in modRoot
+// are kept in. Normally that's the module root itself, with --global-store
+// it's a directory in the user config dir named after the module's path so
+// that gomr leaves nothing behind in the working tree.
+func storeDir(modRoot string) (string, error) {
+	if !globalStore {
+		return modRoot, nil
+	}
+
+	// This runs for nearly every file gomr touches, so only the module line
+	// is read instead of running go mod edit
+	b, err := ioutil.ReadFile(filepath.Join(modRoot, "go.mod"))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read go.mod in dir: %s", modRoot)
+	}
+	modPath := modfile.ModulePath(b)
+	if len(modPath) == 0 {
+		return "", errors.Errorf("go.mod in %s has no module path", modRoot)
+	}
+
+	configDir, err := userConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(configDir, storeDirname, filepath.FromSlash(modPath))
+	if err = os.MkdirAll(dir, 0775); err != nil {
+		return "", errors.Wrap(err, "failed to create global store dir")
+	}
+
+	return dir, nil
+}
+
+// storeFilePath returns the path of the gomr file for the module in modRoot
+func storeFilePath(modRoot string) (string, error) {
+	dir, err := storeDir(modRoot)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, gomrFilename), nil
+}
+
+// stateDir returns the directory gomr keeps state for the module in modRoot
+// in, other than the gomr file itself.
+func stateDir(modRoot string) (string, error) {
+	dir, err := storeDir(modRoot)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, gomrDirname), nil
+}
+
+// storeFlag returns the flag needed to make gomr use the same store as the
+// current invocation, for commands gomr writes into hooks or git config.
+func storeFlag() string {
+	if globalStore {
+		return " --global-store"
+	}
+	return ""
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pkg/errors"
+)
+
+// stubsFilename is the file inside gomrDirname that records the hash of each
+// go.mod gomr generated, so gomr never deletes one that was changed or
+// replaced by a real go.mod later on.
+const stubsFilename = "stubs.toml"
+
+// stubWorkers is how many go mod inits createStubs runs at once
+const stubWorkers = 8
+
+// stubSums is the structure of the stubs file, it maps the directory of each
+// generated go.mod to the sha256 of its contents. GoSums has the sha256 of
+// the go.sum in the same directory when the stub was generated, or nothing
+// if there was none.
+type stubSums struct {
+	Stubs  map[string]string `toml:"stubs"`
+	GoSums map[string]string `toml:"go_sums"`
+}
+
+// stubsFilePath returns the path of the stubs file for the module in modRoot
+func stubsFilePath(modRoot string) (string, error) {
+	dir, err := stateDir(modRoot)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, stubsFilename), nil
+}
+
+// readStubSums reads the recorded stub hashes, a missing file has none
+func readStubSums(modRoot string) (stubSums, error) {
+	sums := stubSums{Stubs: make(map[string]string), GoSums: make(map[string]string)}
+
+	path, err := stubsFilePath(modRoot)
+	if err != nil {
+		return sums, err
+	}
+
+	if _, err = toml.DecodeFile(path, &sums); err != nil {
+		if os.IsNotExist(errors.Cause(err)) {
+			return sums, nil
+		}
+		return sums, errors.Wrapf(err, "failed to read %s", path)
+	}
+	if sums.Stubs == nil {
+		sums.Stubs = make(map[string]string)
+	}
+	if sums.GoSums == nil {
+		sums.GoSums = make(map[string]string)
+	}
+
+	return sums, nil
+}
+
+// writeStubSums stores the stub hashes, removing the file when there are none
+func writeStubSums(modRoot string, sums stubSums) error {
+	path, err := stubsFilePath(modRoot)
+	if err != nil {
+		return err
+	}
+
+	if len(sums.Stubs) == 0 {
+		if err = removeFile(path); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "failed to remove %s", path)
+		}
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err = toml.NewEncoder(&buf).Encode(sums); err != nil {
+		return err
+	}
+
+	return writeFile(path, buf.Bytes(), 0664)
+}
+
+// fileSum returns the hex sha256 of b
+func fileSum(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// createStubs runs go mod init for every replace that needs a go.mod added
+// and doesn't already have one, recording a hash of each one it creates. The
+// go mod inits run stubWorkers at a time, and every one that fails is
+// reported in the error.
+func createStubs(modRoot string, replaces []replace) error {
+	var pending []replace
+	seen := make(map[string]bool)
+	for _, r := range replaces {
+		if !r.AddGoMod || seen[r.AbsPath] {
+			continue
+		}
+		seen[r.AbsPath] = true
+
+		if _, err := os.Stat(filepath.Join(r.AbsPath, "go.mod")); err == nil {
+			continue
+		} else if !os.IsNotExist(err) {
+			return errors.Wrapf(err, "failed to go mod init in dir: %s", r.AbsPath)
+		}
+		pending = append(pending, r)
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	errs := make([]error, len(pending))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < stubWorkers && w < len(pending); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				r := pending[i]
+				if err := gomod(r.AbsPath, "init", r.ModuleName); err != nil {
+					errs[i] = errors.Wrapf(err, "failed to go mod init in dir: %s", r.AbsPath)
+				}
+			}
+		}()
+	}
+
+	for i := range pending {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+
+	var failures []string
+	for _, err := range errs {
+		if err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	if len(failures) == 1 {
+		return errs[0]
+	} else if len(failures) != 0 {
+		return fmt.Errorf("%d stubs failed:\n  %s", len(failures), strings.Join(failures, "\n  "))
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	sums, err := readStubSums(modRoot)
+	if err != nil {
+		return err
+	}
+	for _, r := range pending {
+		b, err := ioutil.ReadFile(filepath.Join(r.AbsPath, "go.mod"))
+		if err != nil {
+			return err
+		}
+		sums.Stubs[r.AbsPath] = fileSum(b)
+
+		sums.GoSums[r.AbsPath] = ""
+		if b, err = ioutil.ReadFile(filepath.Join(r.AbsPath, "go.sum")); err == nil {
+			sums.GoSums[r.AbsPath] = fileSum(b)
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return writeStubSums(modRoot, sums)
+}
+
+// removeStubs deletes the go.mod and go.sum gomr generated for each of the
+// replaces. A go.mod that doesn't match what gomr generated is left alone
+// with a warning unless force is set, since it may be a real go.mod that was
+// created after the replace was added. The same goes for a go.sum that
+// changed since the stub was generated, and a go.sum that was there before
+// the stub isn't deleted at all.
+func removeStubs(modRoot string, replaces []replace, force bool) error {
+	var sums stubSums
+	loaded, changed := false, false
+
+	for _, r := range replaces {
+		if !r.AddGoMod {
+			continue
+		}
+
+		goModPath := filepath.Join(r.AbsPath, "go.mod")
+		b, err := ioutil.ReadFile(goModPath)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return errors.Wrap(err, "failed to read the added go.mod")
+		}
+
+		if !loaded {
+			if sums, err = readStubSums(modRoot); err != nil {
+				return err
+			}
+			loaded = true
+		}
+
+		if !force && !isGeneratedStub(b, sums.Stubs[r.AbsPath]) {
+			warnf("%s was changed since gomr generated it, not deleting it (use --force to delete it anyway)", goModPath)
+			continue
+		}
+
+		if err = removeFile(goModPath); err != nil && !os.IsNotExist(err) {
+			return errors.Wrap(err, "something went wrong when trying to delete the added go.mod")
+		}
+		if err = removeStubGoSum(r.AbsPath, sums, force); err != nil {
+			return err
+		}
+
+		delete(sums.Stubs, r.AbsPath)
+		delete(sums.GoSums, r.AbsPath)
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+	return writeStubSums(modRoot, sums)
+}
+
+// removeStubGoSum deletes the go.sum next to a stub that's being removed
+// from dir, see removeStubs. Stubs recorded before go.sum hashes were have
+// their go.sum deleted.
+func removeStubGoSum(dir string, sums stubSums, force bool) error {
+	goSumPath := filepath.Join(dir, "go.sum")
+	b, err := ioutil.ReadFile(goSumPath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "failed to read the added go.sum")
+	}
+
+	if sum, ok := sums.GoSums[dir]; ok {
+		switch {
+		case len(sum) != 0 && fileSum(b) == sum:
+			return nil
+		case !force:
+			warnf("%s was changed since gomr generated the go.mod next to it, not deleting it (use --force to delete it anyway)", goSumPath)
+			return nil
+		}
+	}
+
+	if err = removeFile(goSumPath); err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "something went wrong when trying to delete the added go.sum")
+	}
+	return nil
+}
+
+// isGeneratedStub checks if the go.mod contents in b are what gomr
+// generated. Stubs created before hashes were recorded are recognised by
+// having nothing but the module and go lines that go mod init writes.
+func isGeneratedStub(b []byte, sum string) bool {
+	if len(sum) != 0 {
+		return fileSum(b) == sum
+	}
+
+	for _, line := range strings.Split(string(b), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "//") {
+			continue
+		}
+		if fields[0] != "module" && fields[0] != "go" {
+			return false
+		}
+	}
+	return true
+}
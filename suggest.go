@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// suggestMaxDepth is how many directories deep suggest looks below a root,
+// deep enough for GOPATH style github.com/owner/repo/v2 layouts.
+const suggestMaxDepth = 4
+
+var suggestCmd = &cobra.Command{
+	Use:   "suggest [flags]",
+	Short: "Find local checkouts of the current module's dependencies",
+	Long: `Find local checkouts of the current module's dependencies
+
+The source roots are searched for go.mod files that declare a module the
+current module requires and isn't already replaced by gomr. The roots are
+GOPATH/src, ~/src, the directories in the path mappings, the roots listed in
+paths.toml and any given with --root. With --interactive each one found can
+be added as a replace.`,
+	RunE:         suggestRun,
+	SilenceUsage: true,
+}
+
+func suggestRun(cmd *cobra.Command, args []string) error {
+	extraRoots, err := cmd.Flags().GetStringSlice("root")
+	if err != nil {
+		return err
+	}
+	interactive, err := cmd.Flags().GetBool("interactive")
+	if err != nil {
+		return err
+	}
+
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		return err
+	}
+
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return err
+	}
+	stored, err := readGomrFile(gomrFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	wanted := make(map[string]bool)
+	for _, req := range mod.Require {
+		if findReplace(stored, req.Path) < 0 {
+			wanted[req.Path] = true
+		}
+	}
+	if len(wanted) == 0 {
+		infof("no dependencies to look for")
+		return nil
+	}
+
+	roots, err := sourceRoots(extraRoots)
+	if err != nil {
+		return err
+	}
+
+	found := findCheckouts(roots, wanted, modRoot)
+	if len(found) == 0 {
+		infof("no local checkouts of dependencies found")
+		return nil
+	}
+
+	modules := make([]string, 0, len(found))
+	for module := range found {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+
+	if !interactive {
+		for _, module := range modules {
+			outputf("%s => %s", module, found[module])
+		}
+		infof("add them with: gomr add <module> <path>, or run gomr suggest -i")
+		return nil
+	}
+
+	var replaces []replace
+	in := bufio.NewReader(os.Stdin)
+	for _, module := range modules {
+		fmt.Printf("add replace %s => %s? [y/N] ", module, found[module])
+		answer, err := in.ReadString('\n')
+		if err != nil && len(answer) == 0 {
+			fmt.Println()
+			break
+		}
+
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			continue
+		}
+
+		r := replace{ModuleName: module, Added: time.Now()}
+		if err = resolveAddTarget(&r, found[module], addOptions{resolveSymlinks: true}); err != nil {
+			return err
+		}
+		replaces = append(replaces, r)
+	}
+
+	if len(replaces) == 0 {
+		infof("nothing added")
+		return nil
+	}
+
+	return storeReplaces(replaces, false, false)
+}
+
+// sourceRoots returns the directories to look for checkouts in, in order of
+// preference and without duplicates or directories that don't exist.
+func sourceRoots(extra []string) ([]string, error) {
+	config, err := readPathsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, err := loadCurrentConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := append([]string{}, extra...)
+	candidates = append(candidates, cfg.Roots...)
+	candidates = append(candidates, config.Roots...)
+
+	prefixes := make([]string, 0, len(config.Paths))
+	for prefix := range config.Paths {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		candidates = append(candidates, config.Paths[prefix])
+	}
+
+	gopathList, err := gopaths()
+	if err != nil {
+		return nil, err
+	}
+	for _, gopath := range gopathList {
+		candidates = append(candidates, filepath.Join(gopath, "src"))
+	}
+	candidates = append(candidates, "~/src")
+
+	var roots []string
+	seen := make(map[string]bool)
+	for _, c := range candidates {
+		if len(c) == 0 {
+			continue
+		}
+
+		root, err := filepath.Abs(expandHome(c))
+		if err != nil {
+			return nil, err
+		}
+		if seen[root] {
+			continue
+		}
+		seen[root] = true
+
+		if info, err := os.Stat(root); err == nil && info.IsDir() {
+			roots = append(roots, root)
+		}
+	}
+
+	return roots, nil
+}
+
+// findCheckouts walks the roots looking for go.mod files that declare one
+// of the wanted modules. The first checkout found for a module wins and
+// modRoot itself is never suggested.
+func findCheckouts(roots []string, wanted map[string]bool, modRoot string) map[string]string {
+	found := make(map[string]string)
+	for _, c := range findModuleDirs(roots, modRoot) {
+		if _, ok := found[c.module]; wanted[c.module] && !ok {
+			found[c.module] = c.dir
+		}
+	}
+
+	return found
+}
+
+// moduleDir is a directory with a go.mod and the module it declares
+type moduleDir struct {
+	module string
+	dir    string
+}
+
+// findModuleDirs walks the roots and returns every directory other than
+// modRoot with a go.mod in it, in the order the roots are given.
+func findModuleDirs(roots []string, modRoot string) []moduleDir {
+	var dirs []moduleDir
+
+	for _, root := range roots {
+		rootDepth := strings.Count(root, string(filepath.Separator))
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil || !info.IsDir() {
+				return nil
+			}
+
+			name := info.Name()
+			if path != root && (strings.HasPrefix(name, ".") || name == "vendor" || name == "node_modules" || name == "testdata") {
+				return filepath.SkipDir
+			}
+			if path == modRoot {
+				return nil
+			}
+
+			if b, err := ioutil.ReadFile(filepath.Join(path, "go.mod")); err == nil {
+				if module := parseModuleLine(b); len(module) != 0 {
+					dirs = append(dirs, moduleDir{module: module, dir: path})
+				}
+			}
+
+			if strings.Count(path, string(filepath.Separator))-rootDepth >= suggestMaxDepth {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+	}
+
+	return dirs
+}
+
+// parseModuleLine returns the module path declared in the contents of a
+// go.mod file without running the go tool, which is too slow to do for every
+// directory under the source roots.
+func parseModuleLine(b []byte) string {
+	for _, line := range bytes.Split(b, []byte("\n")) {
+		fields := strings.Fields(string(line))
+		if len(fields) < 2 || fields[0] != "module" {
+			continue
+		}
+
+		module := fields[1]
+		if unquoted, err := strconv.Unquote(module); err == nil {
+			module = unquoted
+		}
+		return module
+	}
+
+	return ""
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// mainModuleTarget is the entry in a replace's modules that stands for the
+// module the gomr file belongs to.
+const mainModuleTarget = "."
+
+// targetsMain checks if the replace goes in the go.mod of the module the
+// gomr file belongs to, which is the case unless it lists other modules only.
+func (r replace) targetsMain() bool {
+	if len(r.Modules) == 0 {
+		return true
+	}
+	for _, m := range r.Modules {
+		if filepath.Clean(m) == mainModuleTarget {
+			return true
+		}
+	}
+	return false
+}
+
+// mainReplaces returns the replaces that go in the main module's go.mod
+func mainReplaces(replaces []replace) []replace {
+	var main []replace
+	for _, r := range replaces {
+		if r.targetsMain() {
+			main = append(main, r)
+		}
+	}
+	return main
+}
+
+// untargetedReplaces returns the replaces that don't list any modules
+func untargetedReplaces(replaces []replace) []replace {
+	var untargeted []replace
+	for _, r := range replaces {
+		if len(r.Modules) == 0 {
+			untargeted = append(untargeted, r)
+		}
+	}
+	return untargeted
+}
+
+// targetModules groups the replaces by the directories of the modules other
+// than the main module that they list, the paths are relative to modRoot.
+func targetModules(modRoot string, replaces []replace) (dirs []string, byDir map[string][]replace, err error) {
+	byDir = make(map[string][]replace)
+	for _, r := range replaces {
+		for _, m := range r.Modules {
+			if filepath.Clean(m) == mainModuleTarget {
+				continue
+			}
+
+			dir := filepath.Join(modRoot, filepath.FromSlash(m))
+			if _, err := os.Stat(filepath.Join(dir, "go.mod")); err != nil {
+				return nil, nil, errors.Wrapf(err, "module %s listed for %s", m, r.ModuleName)
+			}
+
+			if _, ok := byDir[dir]; !ok {
+				dirs = append(dirs, dir)
+			}
+			byDir[dir] = append(byDir[dir], r)
+		}
+	}
+
+	return dirs, byDir, nil
+}
+
+// installTargeted adds the replace lines to the go.mod of every module other
+// than the main module that the replaces list.
+func installTargeted(modRoot string, replaces []replace) error {
+	dirs, byDir, err := targetModules(modRoot, replaces)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range dirs {
+		mod, err := readGoMod(dir)
+		if err != nil {
+			return err
+		}
+
+		install := expandWildcards(mod, byDir[dir])
+		if len(install) == 0 {
+			continue
+		}
+		if err = createStubs(modRoot, install); err != nil {
+			return err
+		}
+		if err = gomod(dir, append([]string{"edit"}, replaceFlags(install)...)...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// uninstallTargeted drops the replace lines installTargeted added
+func uninstallTargeted(modRoot string, replaces []replace) error {
+	dirs, byDir, err := targetModules(modRoot, replaces)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range dirs {
+		mod, err := readGoMod(dir)
+		if err != nil {
+			return err
+		}
+
+		applied := appliedReplaces(mod, byDir[dir])
+		if len(applied) == 0 {
+			continue
+		}
+
+		if err = gomod(dir, append([]string{"edit"}, dropReplaceFlags(applied)...)...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// gomrTemplateFilename is the committed file listing the replaces a team
+// works with, without the paths that differ from machine to machine
+const gomrTemplateFilename = gomrFilename + ".example"
+
+var applyTemplateCmd = &cobra.Command{
+	Use:   "apply-template [flags]",
+	Short: "Store replaces for the modules listed in " + gomrTemplateFilename,
+	Long: `Store replaces for the modules listed in ` + gomrTemplateFilename + `
+
+` + gomrTemplateFilename + ` is meant to be committed. It has the same [[replace]]
+tables as the gomr file with a module and optionally a note, profiles, modules
+or a module@version target, but no paths. apply-template finds a local
+checkout for each module, first with the path mappings in paths.toml and
+GOPATH and then by searching the source roots like suggest does, and stores
+the replaces in the personal gomr file. Modules that already have a stored
+replace are left alone. Nothing is installed, run gomr up afterwards.
+
+It exits with 3 when some modules have no checkout, after storing the rest.`,
+	RunE:         applyTemplateRun,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+}
+
+func applyTemplateRun(cmd *cobra.Command, args []string) error {
+	file, err := cmd.Flags().GetString("file")
+	if err != nil {
+		return err
+	}
+	extraRoots, err := cmd.Flags().GetStringSlice("root")
+	if err != nil {
+		return err
+	}
+
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	templatePath := file
+	if len(templatePath) == 0 {
+		templatePath = filepath.Join(modRoot, gomrTemplateFilename)
+	}
+	template, err := readTemplateFile(templatePath)
+	if err != nil {
+		return err
+	}
+
+	return storeTemplate(modRoot, templatePath, template, extraRoots, "apply-template")
+}
+
+// readTemplateFile reads a template file. Its replaces can't have paths,
+// those are found on each machine.
+func readTemplateFile(path string) ([]replace, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no template found at %s", path)
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", path)
+	}
+
+	file, err := parseGomrFile(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", path)
+	}
+	for _, r := range file.Replaces {
+		if len(r.AbsPath) != 0 {
+			return nil, fmt.Errorf("%s has a path for %s, templates only name the modules", path, r.ModuleName)
+		}
+		if r.AddGoMod || len(r.Require) != 0 || len(r.Fork) != 0 || len(r.Ref) != 0 {
+			return nil, fmt.Errorf("%s has machine specific keys for %s, templates only have module, note, profiles, modules, target and disabled", path, r.ModuleName)
+		}
+	}
+
+	return file.Replaces, nil
+}
+
+// storeTemplate finds local checkouts for the replaces in template, read
+// from source, and stores the ones it finds in the gomr file as operation.
+// Modules that already have a stored replace are skipped.
+func storeTemplate(modRoot, source string, template []replace, extraRoots []string, operation string) error {
+	lock, err := lockModule(modRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return err
+	}
+	stored, err := readGomrFile(gomrFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var pending []replace
+	for _, r := range template {
+		if i := findReplace(stored, r.ModuleName); i >= 0 {
+			debugf("%s already has a stored replace", stored[i].ModuleName)
+			continue
+		}
+		pending = append(pending, r)
+	}
+	if len(pending) == 0 {
+		infof("every module in %s already has a stored replace", source)
+		return nil
+	}
+
+	added, missing, err := resolveTemplate(modRoot, pending, extraRoots)
+	if err != nil {
+		return err
+	}
+	for _, r := range missing {
+		warnf("no local checkout found for %s", r.ModuleName)
+	}
+
+	if len(added) != 0 {
+		files, err := moduleFiles(modRoot, added)
+		if err != nil {
+			return err
+		}
+		tx, err := beginTransaction(files...)
+		if err != nil {
+			return err
+		}
+
+		err = recordOperation(modRoot, operationName(operation, added), files, func() error {
+			return tx.run(func() error {
+				return writeGomrFile(gomrFilePath, append(stored, added...))
+			})
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, r := range added {
+			infof("stored replace: %s => %s", r.ModuleName, r.replacement())
+		}
+		infof("install them with: gomr up")
+	}
+
+	if len(missing) != 0 {
+		return withExitCode(exitMissing, fmt.Errorf("%d module(s) in %s have no local checkout, add them with: gomr add <module> <path>", len(missing), source))
+	}
+	return nil
+}
+
+// resolveTemplate finds the local checkouts for the template's replaces.
+// The path mappings and GOPATH are tried first and the source roots are
+// searched for the rest. It returns the replaces ready to store and the ones
+// it found no checkout for.
+func resolveTemplate(modRoot string, template []replace, extraRoots []string) ([]replace, []replace, error) {
+	var resolved, unresolved []replace
+	now := time.Now()
+
+	for _, r := range template {
+		r.Added = now
+		if r.isRemote() {
+			if err := validateRemoteTarget(r.Target); err != nil {
+				return nil, nil, err
+			}
+			resolved = append(resolved, r)
+			continue
+		}
+
+		path, mapped, err := defaultModulePath(r.ModuleName)
+		if err != nil {
+			return nil, nil, err
+		}
+		if r.isWildcard() {
+			path = filepath.Dir(path)
+		}
+		if _, err = os.Stat(path); err != nil {
+			unresolved = append(unresolved, r)
+			continue
+		}
+
+		if err = resolveAddPath(&r, path, missingPolicy{}); err != nil {
+			return nil, nil, err
+		}
+		r.mapped = mapped
+		resolved = append(resolved, r)
+	}
+
+	if len(unresolved) == 0 {
+		return resolved, nil, nil
+	}
+
+	roots, err := sourceRoots(extraRoots)
+	if err != nil {
+		return nil, nil, err
+	}
+	wanted := make(map[string]bool)
+	for _, r := range unresolved {
+		wanted[r.ModuleName] = true
+	}
+	found := findCheckouts(roots, wanted, modRoot)
+
+	var missing []replace
+	for _, r := range unresolved {
+		dir, ok := found[r.ModuleName]
+		if !ok {
+			missing = append(missing, r)
+			continue
+		}
+
+		if err = resolveAddPath(&r, dir, missingPolicy{}); err != nil {
+			return nil, nil, err
+		}
+		resolved = append(resolved, r)
+	}
+
+	return resolved, missing, nil
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// tidyFlag returns the value of cmd's --tidy flag, or the project's tidy
+// setting if the flag wasn't given.
+func tidyFlag(cmd *cobra.Command, modRoot string) (bool, error) {
+	return configBoolFlag(cmd, "tidy", modRoot, func(cfg config) bool { return cfg.Tidy })
+}
+
+// tidyModule runs go mod tidy in modRoot when tidy is set. A failure is only
+// a warning, the replaces were changed fine and tidy often fails for reasons
+// of its own like being offline.
+func tidyModule(modRoot string, tidy bool) {
+	if !tidy {
+		return
+	}
+
+	if err := gomod(modRoot, "tidy"); err != nil {
+		warnf("go mod tidy failed: %v", err)
+		return
+	}
+	infof("ran go mod tidy")
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// transaction records the contents of a set of files before they're changed
+// so that they can all be put back if a later step fails.
+type transaction struct {
+	files []fileState
+}
+
+// fileState is the contents of a file at the start of a transaction
+type fileState struct {
+	path     string
+	contents []byte
+	exists   bool
+	mode     os.FileMode
+}
+
+// beginTransaction saves the current state of every path
+func beginTransaction(paths ...string) (*transaction, error) {
+	tx := &transaction{}
+
+	for _, path := range paths {
+		state := fileState{path: path}
+
+		info, err := os.Stat(path)
+		switch {
+		case err == nil:
+			state.exists = true
+			state.mode = info.Mode().Perm()
+			state.contents, err = ioutil.ReadFile(path)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to read %s", path)
+			}
+		case os.IsNotExist(err):
+		default:
+			return nil, errors.Wrapf(err, "failed to stat %s", path)
+		}
+
+		tx.files = append(tx.files, state)
+	}
+
+	return tx, nil
+}
+
+// rollback puts every file back the way it was when the transaction began,
+// deleting files that didn't exist then. It attempts every file even if one
+// fails and returns the first error. Nothing was changed with --dry-run so
+// nothing is put back either.
+func (t *transaction) rollback() error {
+	if dryRun {
+		return nil
+	}
+
+	var firstErr error
+	for _, f := range t.files {
+		var err error
+		if f.exists {
+			err = ioutil.WriteFile(f.path, f.contents, f.mode)
+		} else {
+			err = os.Remove(f.path)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		}
+
+		if err != nil && firstErr == nil {
+			firstErr = errors.Wrapf(err, "failed to roll back %s", f.path)
+		}
+	}
+
+	return firstErr
+}
+
+// run calls fn and rolls the transaction back if it fails
+func (t *transaction) run(fn func() error) error {
+	err := fn()
+	if err == nil {
+		return nil
+	}
+
+	if rbErr := t.rollback(); rbErr != nil {
+		return errors.Wrapf(err, "%v (rollback also failed)", rbErr)
+	}
+
+	return errors.Wrap(err, "all changes were rolled back")
+}
+
+// moduleFiles returns every file that up or down may change for the module
+// in modRoot and the replaces: the go files from goFiles, and gomr's own
+// files for the module.
+func moduleFiles(modRoot string, replaces []replace) ([]string, error) {
+	dir, err := storeDir(modRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(goFiles(modRoot, replaces),
+		filepath.Join(dir, gomrFilename),
+		filepath.Join(dir, gomrFilename+gomrLocalSuffix),
+		filepath.Join(dir, gomrDirname, goSumBackupFilename),
+		filepath.Join(dir, gomrDirname, stubsFilename),
+	), nil
+}
+
+// goFiles returns the go.mod and go.sum in modRoot and in the other modules
+// the replaces list, and the generated go.mod and go.sum in each replaced
+// directory.
+func goFiles(modRoot string, replaces []replace) []string {
+	paths := []string{
+		filepath.Join(modRoot, "go.mod"),
+		filepath.Join(modRoot, "go.sum"),
+	}
+
+	for _, r := range replaces {
+		for _, m := range r.Modules {
+			if filepath.Clean(m) != mainModuleTarget {
+				dir := filepath.Join(modRoot, filepath.FromSlash(m))
+				paths = append(paths, filepath.Join(dir, "go.mod"), filepath.Join(dir, "go.sum"))
+			}
+		}
+		if r.AddGoMod {
+			paths = append(paths,
+				filepath.Join(r.AbsPath, "go.mod"),
+				filepath.Join(r.AbsPath, "go.sum"),
+			)
+		}
+	}
+
+	return paths
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// addDependencyReplaces looks for modules required by the new replaces that
+// gomr already tracks a local checkout of somewhere else, either in the
+// replaced module's own gomr file or in the global store. Without a replace
+// for them too the build uses the published versions, which breaks local
+// changes that depend on each other. With all set they're added without
+// asking, otherwise the user is asked when stdin is a terminal and told
+// about them when it isn't.
+func addDependencyReplaces(newReplaces []replace, all bool) ([]replace, error) {
+	var dirs []string
+	for _, r := range newReplaces {
+		if !r.isRemote() && !r.isWildcard() {
+			dirs = append(dirs, r.AbsPath)
+		}
+	}
+	if len(dirs) == 0 {
+		return newReplaces, nil
+	}
+
+	known := knownCheckouts(dirs)
+	if len(known) == 0 {
+		return newReplaces, nil
+	}
+
+	stored, err := currentReplaces()
+	if err != nil {
+		return nil, err
+	}
+
+	ask := !all && stdinIsTerminal()
+	in := bufio.NewReader(os.Stdin)
+
+	// Go through the dependencies of every replace we add, including the
+	// ones added here, so the whole chain of local checkouts gets wired up
+	for i := 0; i < len(newReplaces); i++ {
+		r := newReplaces[i]
+		if r.isRemote() || r.isWildcard() || r.AddGoMod {
+			continue
+		}
+
+		mod, err := parseGoMod(r.AbsPath)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, req := range mod.Require {
+			path, ok := known[req.Path]
+			if !ok || findReplace(newReplaces, req.Path) >= 0 || findReplace(stored, req.Path) >= 0 {
+				continue
+			}
+
+			if !all && !ask {
+				infof("%s requires %s which has a local checkout at %s, add it with: gomr add %s %s",
+					r.ModuleName, req.Path, path, req.Path, path)
+				continue
+			}
+
+			if ask {
+				fmt.Printf("%s requires %s which has a local checkout at %s, add a replace for it too? [y/N] ",
+					r.ModuleName, req.Path, path)
+				answer, _ := in.ReadString('\n')
+				answer = strings.ToLower(strings.TrimSpace(answer))
+				if answer != "y" && answer != "yes" {
+					continue
+				}
+			}
+
+			dep := replace{
+				ModuleName: req.Path,
+				Profiles:   r.Profiles,
+				Added:      r.Added,
+				local:      r.local,
+			}
+			if err = resolveAddPath(&dep, path, missingPolicy{}); err != nil {
+				return nil, err
+			}
+			newReplaces = append(newReplaces, dep)
+		}
+	}
+
+	return newReplaces, nil
+}
+
+// knownCheckouts returns the local checkouts recorded in the gomr files in
+// dirs and in every gomr file in the global store, keyed by module path.
+// Problems with other projects' files are ignored, they're only a source of
+// hints.
+func knownCheckouts(dirs []string) map[string]string {
+	var files []string
+	for _, dir := range dirs {
+		files = append(files, filepath.Join(dir, gomrFilename))
+	}
+
+	if configDir, err := userConfigDir(); err == nil {
+		filepath.Walk(filepath.Join(configDir, storeDirname), func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() && info.Name() == gomrFilename {
+				files = append(files, path)
+			}
+			return nil
+		})
+	}
+
+	known := make(map[string]string)
+	for _, file := range files {
+		replaces, err := readGomrFile(file)
+		if err != nil {
+			continue
+		}
+
+		for _, r := range replaces {
+			if r.isRemote() || r.isWildcard() {
+				continue
+			}
+			if _, ok := known[r.ModuleName]; ok {
+				continue
+			}
+			if _, err := os.Stat(r.AbsPath); err == nil {
+				known[r.ModuleName] = r.AbsPath
+			}
+		}
+	}
+
+	return known
+}
+
+// stdinIsTerminal checks if stdin is an interactive terminal
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// inlineNestedReplaces warns about replace directives in the go.mod files of
+// the new replaces, go ignores replaces outside of the main module so the
+// build silently uses different code than the replaced module does. With
+// inline set an equivalent replace is added for each of them instead.
+func inlineNestedReplaces(newReplaces []replace, inline bool) ([]replace, error) {
+	stored, err := currentReplaces()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < len(newReplaces); i++ {
+		r := newReplaces[i]
+		if r.isRemote() || r.isWildcard() || r.AddGoMod {
+			continue
+		}
+
+		mod, err := parseGoMod(r.AbsPath)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rep := range mod.Replace {
+			if findReplace(newReplaces, rep.Old.Path) >= 0 || findReplace(stored, rep.Old.Path) >= 0 {
+				continue
+			}
+
+			replacement := rep.New.Path
+			if len(rep.New.Version) != 0 {
+				replacement += "@" + rep.New.Version
+			} else if !filepath.IsAbs(replacement) {
+				replacement = filepath.Join(r.AbsPath, replacement)
+			}
+
+			if !inline {
+				warnf("%s replaces %s => %s, go ignores it here (use --inline to add it)",
+					r.ModuleName, rep.Old.Path, replacement)
+				continue
+			}
+
+			if len(rep.Old.Version) != 0 {
+				warnf("%s replaces only %s@%s, gomr can't inline versioned replaces",
+					r.ModuleName, rep.Old.Path, rep.Old.Version)
+				continue
+			}
+			nested := replace{
+				ModuleName: rep.Old.Path,
+				Profiles:   r.Profiles,
+				Note:       fmt.Sprintf("inlined from %s", r.ModuleName),
+				Added:      r.Added,
+				local:      r.local,
+			}
+			if len(rep.New.Version) != 0 {
+				nested.Target = replacement
+			} else if err = resolveAddPath(&nested, replacement, missingPolicy{}); err != nil {
+				return nil, err
+			}
+			newReplaces = append(newReplaces, nested)
+		}
+	}
+
+	return newReplaces, nil
+}
+
+// currentReplaces reads the replaces already stored for the current module
+func currentReplaces() ([]replace, error) {
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return nil, err
+	}
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, err := readGomrFile(gomrFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return stored, nil
+}
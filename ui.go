@@ -0,0 +1,397 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell"
+	"github.com/spf13/cobra"
+)
+
+var uiCmd = &cobra.Command{
+	Use:   "ui",
+	Short: "Manage the stored replaces in an interactive terminal UI",
+	Long: `Manage the stored replaces in an interactive terminal UI
+
+Every stored replace is listed with whether it's in go.mod and whether its
+checkout has uncommitted changes. Keys:
+
+  up/down, j/k  move
+  space, enter  install or remove the replace (up/down for just that one)
+  e             enable or disable the replace
+  a             add a replace
+  d             remove the replace
+  r             refresh
+  q, esc        quit`,
+	RunE:         uiRun,
+	SilenceUsage: true,
+}
+
+// uiRow is a replace as shown in the ui
+type uiRow struct {
+	replace
+	applied bool
+	dirty   bool
+}
+
+// ui is the state of the gomr ui
+type ui struct {
+	screen  tcell.Screen
+	modRoot string
+	rows    []uiRow
+	cursor  int
+	offset  int
+	status  string
+}
+
+func uiRun(cmd *cobra.Command, args []string) error {
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return err
+	}
+	if err = screen.Init(); err != nil {
+		return err
+	}
+	defer screen.Fini()
+
+	u := &ui{screen: screen, modRoot: modRoot}
+	u.refresh()
+
+	for {
+		u.draw()
+
+		switch ev := screen.PollEvent().(type) {
+		case *tcell.EventResize:
+			screen.Sync()
+		case *tcell.EventKey:
+			if u.handleKey(ev) {
+				return nil
+			}
+		}
+	}
+}
+
+// refresh reloads the replaces and their status
+func (u *ui) refresh() {
+	u.rows = nil
+
+	gomrFilePath, err := storeFilePath(u.modRoot)
+	if err != nil {
+		u.status = err.Error()
+		return
+	}
+	replaces, err := readGomrFile(gomrFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		u.status = err.Error()
+		return
+	}
+
+	mod, err := readGoMod(u.modRoot)
+	if err != nil {
+		u.status = err.Error()
+		return
+	}
+
+	for _, r := range replaces {
+		row := uiRow{replace: r}
+		row.applied = len(appliedReplaces(mod, []replace{r})) != 0
+		if !r.isRemote() && !r.isWildcard() && isGitRepo(r.AbsPath) {
+			row.dirty, _ = gitDirty(r.AbsPath, r.AddGoMod)
+		}
+		u.rows = append(u.rows, row)
+	}
+
+	if u.cursor >= len(u.rows) {
+		u.cursor = len(u.rows) - 1
+	}
+	if u.cursor < 0 {
+		u.cursor = 0
+	}
+}
+
+// handleKey acts on a key press and reports whether the ui should exit
+func (u *ui) handleKey(ev *tcell.EventKey) bool {
+	switch ev.Key() {
+	case tcell.KeyEscape, tcell.KeyCtrlC:
+		return true
+	case tcell.KeyUp:
+		u.move(-1)
+		return false
+	case tcell.KeyDown:
+		u.move(1)
+		return false
+	case tcell.KeyEnter:
+		u.toggleApplied()
+		return false
+	case tcell.KeyRune:
+	default:
+		return false
+	}
+
+	switch ev.Rune() {
+	case 'q':
+		return true
+	case 'k':
+		u.move(-1)
+	case 'j':
+		u.move(1)
+	case ' ':
+		u.toggleApplied()
+	case 'e':
+		u.toggleDisabled()
+	case 'a':
+		u.add()
+	case 'd':
+		u.remove()
+	case 'r':
+		u.status = ""
+		u.refresh()
+	}
+
+	return false
+}
+
+// move moves the cursor by delta rows
+func (u *ui) move(delta int) {
+	u.cursor += delta
+	if u.cursor >= len(u.rows) {
+		u.cursor = len(u.rows) - 1
+	}
+	if u.cursor < 0 {
+		u.cursor = 0
+	}
+}
+
+// selected returns the row under the cursor
+func (u *ui) selected() (uiRow, bool) {
+	if len(u.rows) == 0 {
+		return uiRow{}, false
+	}
+	return u.rows[u.cursor], true
+}
+
+// toggleApplied installs or removes the selected replace
+func (u *ui) toggleApplied() {
+	row, ok := u.selected()
+	if !ok {
+		return
+	}
+	if row.Disabled {
+		u.status = "the replace is disabled, enable it first"
+		return
+	}
+
+	u.run(func() error {
+		lock, err := lockModule(u.modRoot)
+		if err != nil {
+			return err
+		}
+		defer lock.unlock()
+
+		if row.applied {
+			return downReplaces(u.modRoot, []replace{row.replace}, nil, false, false)
+		}
+		return upReplaces(u.modRoot, []replace{row.replace}, nil, false)
+	})
+}
+
+// toggleDisabled enables or disables the selected replace
+func (u *ui) toggleDisabled() {
+	row, ok := u.selected()
+	if !ok {
+		return
+	}
+
+	u.run(func() error {
+		return setDisabled([]string{row.ModuleName}, !row.Disabled)
+	})
+}
+
+// add asks for a module and path and adds a replace for them
+func (u *ui) add() {
+	moduleName, ok := u.prompt("module: ")
+	if !ok || len(moduleName) == 0 {
+		return
+	}
+	target, ok := u.prompt("path or module@version (empty for the default path): ")
+	if !ok {
+		return
+	}
+
+	u.run(func() error {
+		r := replace{ModuleName: moduleName, Added: time.Now()}
+		if err := resolveAddTarget(&r, target, addOptions{resolveSymlinks: true}); err != nil {
+			return err
+		}
+
+		return storeReplaces([]replace{r}, false, false)
+	})
+}
+
+// remove removes the selected replace after asking for confirmation
+func (u *ui) remove() {
+	row, ok := u.selected()
+	if !ok {
+		return
+	}
+
+	answer, ok := u.prompt(fmt.Sprintf("remove %s? [y/N] ", row.ModuleName))
+	if !ok || strings.ToLower(answer) != "y" {
+		return
+	}
+
+	u.run(func() error {
+		return removeRun(removeCmd, []string{row.ModuleName})
+	})
+}
+
+// run runs an action with its output captured, showing the last line of it
+// or the error in the status line, and refreshes the list.
+func (u *ui) run(fn func() error) {
+	output, err := captureOutput(fn)
+	if err != nil {
+		u.status = "error: " + err.Error()
+	} else {
+		u.status = output
+	}
+	u.refresh()
+}
+
+// prompt reads a line of input on the status line, ok is false if it was
+// cancelled with escape.
+func (u *ui) prompt(label string) (string, bool) {
+	var input []rune
+	for {
+		u.status = label + string(input)
+		u.draw()
+
+		ev, isKey := u.screen.PollEvent().(*tcell.EventKey)
+		if !isKey {
+			continue
+		}
+
+		switch ev.Key() {
+		case tcell.KeyEscape, tcell.KeyCtrlC:
+			u.status = ""
+			return "", false
+		case tcell.KeyEnter:
+			u.status = ""
+			return strings.TrimSpace(string(input)), true
+		case tcell.KeyBackspace, tcell.KeyBackspace2:
+			if len(input) != 0 {
+				input = input[:len(input)-1]
+			}
+		case tcell.KeyRune:
+			input = append(input, ev.Rune())
+		}
+	}
+}
+
+// draw renders the ui
+func (u *ui) draw() {
+	s := u.screen
+	s.Clear()
+	width, height := s.Size()
+
+	bold := tcell.StyleDefault.Bold(true)
+	u.text(0, 0, width, bold, "gomr: "+u.modRoot)
+	u.text(0, 1, width, tcell.StyleDefault.Dim(true), "space: up/down  e: enable/disable  a: add  d: remove  r: refresh  q: quit")
+
+	listHeight := height - 4
+	if u.cursor < u.offset {
+		u.offset = u.cursor
+	}
+	if listHeight > 0 && u.cursor >= u.offset+listHeight {
+		u.offset = u.cursor - listHeight + 1
+	}
+
+	if len(u.rows) == 0 {
+		u.text(0, 3, width, tcell.StyleDefault, "no replaces stored, press a to add one")
+	}
+
+	for i := u.offset; i < len(u.rows) && i-u.offset < listHeight; i++ {
+		row := u.rows[i]
+
+		mark := "[ ]"
+		if row.applied {
+			mark = "[x]"
+		}
+		line := fmt.Sprintf("%s %s => %s", mark, row.ModuleName, row.replacement())
+
+		var flags []string
+		if row.Disabled {
+			flags = append(flags, "disabled")
+		}
+		if row.dirty {
+			flags = append(flags, "dirty")
+		}
+		if len(flags) != 0 {
+			line += "  (" + strings.Join(flags, ", ") + ")"
+		}
+
+		style := tcell.StyleDefault
+		switch {
+		case row.Disabled:
+			style = style.Dim(true)
+		case row.applied:
+			style = style.Foreground(tcell.ColorGreen)
+		}
+		if i == u.cursor {
+			style = style.Reverse(true)
+		}
+
+		u.text(0, 3+i-u.offset, width, style, line)
+	}
+
+	u.text(0, height-1, width, tcell.StyleDefault, u.status)
+	s.Show()
+}
+
+// text draws str at x, y cut off at width
+func (u *ui) text(x, y, width int, style tcell.Style, str string) {
+	drawText(u.screen, x, y, width, style, str)
+}
+
+// drawText draws str on screen at x, y cut off at width
+func drawText(screen tcell.Screen, x, y, width int, style tcell.Style, str string) {
+	for _, r := range str {
+		if x >= width {
+			return
+		}
+		screen.SetContent(x, y, r, nil, style)
+		x++
+	}
+}
+
+// captureOutput runs fn with stdout and stderr going to a temporary file so
+// commands that print can run while the ui owns the terminal. It returns the
+// last line that was printed.
+func captureOutput(fn func() error) (string, error) {
+	f, err := ioutil.TempFile("", "gomr-ui")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = f, f
+	fnErr := fn()
+	os.Stdout, os.Stderr = stdout, stderr
+
+	b, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	return lines[len(lines)-1], fnErr
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// replaceConflict is a stored replace whose module go.mod already replaces
+// with something else
+type replaceConflict struct {
+	replace
+	// current is the replacement in go.mod
+	current string
+}
+
+// goModReplacement returns the right hand side of a replace line in the
+// go.mod in modRoot the way gomr stores it, with local paths made absolute.
+func goModReplacement(modRoot string, rep goModReplace) string {
+	if len(rep.New.Version) != 0 {
+		return rep.New.Path + "@" + rep.New.Version
+	}
+	if !filepath.IsAbs(rep.New.Path) {
+		return filepath.Join(modRoot, rep.New.Path)
+	}
+	return rep.New.Path
+}
+
+// unmanagedReplaces returns the replace lines in mod for modules none of the
+// replaces is for. gomr never touches these. Versioned replace lines are
+// always unmanaged since gomr only writes unversioned ones.
+func unmanagedReplaces(mod goModFile, replaces []replace) []goModReplace {
+	managed := make(map[string]bool)
+	for _, r := range expandWildcards(mod, replaces) {
+		managed[strings.ToLower(r.ModuleName)] = true
+	}
+
+	var unmanaged []goModReplace
+	for _, rep := range mod.Replace {
+		if len(rep.Old.Version) != 0 || !managed[strings.ToLower(rep.Old.Path)] {
+			unmanaged = append(unmanaged, rep)
+		}
+	}
+
+	return unmanaged
+}
+
+// conflictingReplaces returns the replaces that go.mod in modRoot has a
+// replace line for that points somewhere else than the replace does,
+// usually because the line was written by hand.
+func conflictingReplaces(modRoot string, mod goModFile, replaces []replace) []replaceConflict {
+	var conflicts []replaceConflict
+	for _, r := range expandWildcards(mod, mainReplaces(replaces)) {
+		rep, ok := mod.replacedModule(r.ModuleName)
+		if !ok {
+			continue
+		}
+
+		current := goModReplacement(modRoot, rep)
+		if r.isRemote() && current == r.Target || !r.isRemote() && sameDir(current, r.AbsPath) {
+			continue
+		}
+		conflicts = append(conflicts, replaceConflict{replace: r, current: current})
+	}
+
+	return conflicts
+}
+
+// warnUnmanaged tells the user about the replace lines in the go.mod in
+// modRoot that aren't gomr's and are left alone by command, and with
+// conflicts warns about the lines for the replaces that command overwrites.
+func warnUnmanaged(modRoot, command string, replaces []replace, conflicts bool) {
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		debugf("%v", err)
+		return
+	}
+
+	stored, err := storedReplaces(modRoot)
+	if err != nil {
+		debugf("%v", err)
+		return
+	}
+
+	if unmanaged := unmanagedReplaces(mod, stored); len(unmanaged) != 0 {
+		var lines []string
+		for _, rep := range unmanaged {
+			lines = append(lines, formatGoModReplace(rep))
+		}
+		infof("%s leaves the replace line(s) gomr doesn't manage alone (adopt local ones with --adopt): %s", command, strings.Join(lines, ", "))
+	}
+
+	if !conflicts {
+		return
+	}
+	for _, c := range conflictingReplaces(modRoot, mod, replaces) {
+		warnf("go.mod already replaces %s => %s, %s replaces it with %s", c.ModuleName, c.current, command, c.replacement())
+	}
+}
+
+// storedReplaces reads every replace stored for the module in modRoot,
+// regardless of profile or whether it's disabled. There are none if there's
+// no gomr file.
+func storedReplaces(modRoot string) ([]replace, error) {
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	replaces, err := readGomrFile(gomrFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return replaces, nil
+}
+
+// formatGoModReplace formats a replace line the way go.mod has it
+func formatGoModReplace(rep goModReplace) string {
+	old, replacement := rep.Old.Path, rep.New.Path
+	if len(rep.Old.Version) != 0 {
+		old += " " + rep.Old.Version
+	}
+	if len(rep.New.Version) != 0 {
+		replacement += " " + rep.New.Version
+	}
+	return fmt.Sprintf("%s => %s", old, replacement)
+}
+
+// adoptFlag adopts the local replaces that aren't in the gomr file yet when
+// cmd's --adopt flag is set, putting them in profile if there is one.
+func adoptFlag(cmd *cobra.Command, modRoot, profile string) error {
+	adopt, err := cmd.Flags().GetBool("adopt")
+	if err != nil || !adopt {
+		return err
+	}
+
+	var profiles []string
+	if len(profile) != 0 {
+		profiles = []string{profile}
+	}
+	_, err = adoptReplaces(modRoot, profiles)
+	return err
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// The checks here let up and down skip the transaction, journal entry and
+// go runs entirely when go.mod is already the way they'd leave it. They read
+// the go.mod files themselves since the point is to be fast.
+
+// replacesInstalled checks if up would change nothing: every replace has a
+// replace line pointing where it should in the main module, the modules it
+// lists and the nested modules, and every stub it needs exists.
+func replacesInstalled(modRoot string, replaces []replace, nested []string) (bool, error) {
+	mod, err := parseGoMod(modRoot)
+	if err != nil {
+		return false, err
+	}
+	main := expandWildcards(mod, mainReplaces(replaces))
+	if !replaceLinesMatch(mod, main) || !stubsExist(main) {
+		return false, nil
+	}
+
+	dirs, byDir, err := targetModules(modRoot, replaces)
+	if err != nil {
+		return false, err
+	}
+	for _, dir := range dirs {
+		mod, err := parseGoMod(dir)
+		if err != nil {
+			return false, err
+		}
+		install := expandWildcards(mod, byDir[dir])
+		if !replaceLinesMatch(mod, install) || !stubsExist(install) {
+			return false, nil
+		}
+	}
+
+	for _, m := range nested {
+		mod, err := parseGoMod(m)
+		if err != nil {
+			return false, err
+		}
+
+		var install []replace
+		for _, r := range expandWildcards(mod, untargetedReplaces(replaces)) {
+			if r.ModuleName != mod.Module.Path && len(mod.requiredVersion(r.ModuleName)) != 0 {
+				install = append(install, r)
+			}
+		}
+		if !replaceLinesMatch(mod, install) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// replacesRemoved checks if down would change nothing: none of the replaces
+// have replace lines anywhere, no required versions are waiting to be put
+// back, no stub it would delete exists and there's no go.sum backup left to
+// restore. See removeStubs for force.
+func replacesRemoved(modRoot string, replaces []replace, nested []string, force bool) (bool, error) {
+	for _, r := range replaces {
+		if len(r.Require) != 0 {
+			return false, nil
+		}
+	}
+
+	mod, err := parseGoMod(modRoot)
+	if err != nil {
+		return false, err
+	}
+	expanded := expandWildcards(mod, replaces)
+	if len(appliedReplaces(mod, mainReplaces(replaces))) != 0 {
+		return false, nil
+	}
+
+	dirs, byDir, err := targetModules(modRoot, replaces)
+	if err != nil {
+		return false, err
+	}
+	for _, dir := range append(dirs, nested...) {
+		mod, err := parseGoMod(dir)
+		if err != nil {
+			return false, err
+		}
+
+		check := untargetedReplaces(replaces)
+		if targeted, ok := byDir[dir]; ok {
+			check = targeted
+		}
+		if len(appliedReplaces(mod, check)) != 0 {
+			return false, nil
+		}
+	}
+
+	removable, err := removableStubs(modRoot, expanded, force)
+	if err != nil || removable {
+		return false, err
+	}
+
+	dir, err := stateDir(modRoot)
+	if err != nil {
+		return false, err
+	}
+	// restoreGoSum only puts go.sum back once nothing is applied
+	if _, err = os.Stat(filepath.Join(dir, goSumBackupFilename)); err == nil {
+		return anyApplied(modRoot)
+	}
+
+	return true, nil
+}
+
+// replaceLinesMatch checks if mod has a replace line for each of the
+// replaces with the replacement the replace would install
+func replaceLinesMatch(mod goModFile, replaces []replace) bool {
+	for _, r := range replaces {
+		rep, ok := mod.replacedModule(r.ModuleName)
+		if !ok {
+			return false
+		}
+
+		current := rep.New.Path
+		if len(rep.New.Version) != 0 {
+			current += "@" + rep.New.Version
+		}
+		if current != r.replacement() && !(isLocalPath(current) && filepath.Clean(current) == filepath.Clean(r.replacement())) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// stubsExist checks that every local replace that needs a generated go.mod
+// has one
+func stubsExist(replaces []replace) bool {
+	for _, r := range replaces {
+		if !r.AddGoMod || r.isRemote() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(r.AbsPath, "go.mod")); err != nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// removableStubs checks if removeStubs would delete a go.mod for any of the
+// replaces
+func removableStubs(modRoot string, replaces []replace, force bool) (bool, error) {
+	var sums stubSums
+	loaded := false
+	for _, r := range replaces {
+		if !r.AddGoMod || r.isRemote() {
+			continue
+		}
+
+		b, err := ioutil.ReadFile(filepath.Join(r.AbsPath, "go.mod"))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return false, err
+		}
+		if force {
+			return true, nil
+		}
+
+		if !loaded {
+			if sums, err = readStubSums(modRoot); err != nil {
+				return false, err
+			}
+			loaded = true
+		}
+		if isGeneratedStub(b, sums.Stubs[r.AbsPath]) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
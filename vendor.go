@@ -0,0 +1,22 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// vendorModule re-runs go mod vendor in modRoot if it has a vendor
+// directory. Builds use the vendored copies when there is one, so a replace
+// does nothing for them until the directory is brought up to date.
+func vendorModule(modRoot string) {
+	if _, err := os.Stat(filepath.Join(modRoot, "vendor", "modules.txt")); err != nil {
+		return
+	}
+
+	if err := gomod(modRoot, "vendor"); err != nil {
+		warnf("go mod vendor failed: %v", err)
+		warnf("the vendor directory in %s is out of date, builds using it will not see the replaces change until go mod vendor is run", modRoot)
+		return
+	}
+	infof("ran go mod vendor")
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify [flags]",
+	Short: "Check that every stored replace points at a usable module",
+	Long: `Check that every stored replace points at a usable module
+
+Each stored replace is checked: its path exists, it has a go.mod or gets a
+stub from gomr, and the go.mod declares the module being replaced. Wildcards
+are checked for every module go.mod requires under them. With --build
+go build ./... is run in each checkout that passed as well, several at a
+time. Prints a table with the result for each replace and exits with 3 if a
+path doesn't exist and 2 if anything else failed.`,
+	RunE:         verifyRun,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+}
+
+// verifyResult is the outcome of verifying one replace, an empty problem
+// means it passed
+type verifyResult struct {
+	r       replace
+	problem string
+	skipped string
+}
+
+func verifyRun(cmd *cobra.Command, args []string) error {
+	build, err := cmd.Flags().GetBool("build")
+	if err != nil {
+		return err
+	}
+	jobs, err := cmd.Flags().GetInt("jobs")
+	if err != nil {
+		return err
+	}
+
+	modRoot, replaces, err := loadReplaces(cmd)
+	if err != nil {
+		return err
+	}
+	if len(replaces) == 0 {
+		infof("no replaces to verify")
+		return nil
+	}
+
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		return err
+	}
+
+	var results []verifyResult
+	for _, r := range replaces {
+		if !r.isWildcard() || r.isRemote() {
+			results = append(results, verifyReplace(r))
+			continue
+		}
+
+		dir := filepath.Dir(r.AbsPath)
+		if _, err := os.Stat(dir); err != nil {
+			results = append(results, verifyResult{r: r, problem: missingPathFinding})
+			continue
+		}
+		matches := wildcardMatches(mod, r, replaces)
+		if len(matches) == 0 {
+			results = append(results, verifyResult{r: r, skipped: "go.mod requires nothing it matches"})
+		}
+		for _, m := range matches {
+			results = append(results, verifyReplace(m))
+		}
+	}
+
+	if build {
+		buildCheckouts(results, jobs)
+	}
+
+	moduleWidth, pathWidth := 0, 0
+	for _, res := range results {
+		if len(res.r.ModuleName) > moduleWidth {
+			moduleWidth = len(res.r.ModuleName)
+		}
+		if len(res.r.replacement()) > pathWidth {
+			pathWidth = len(res.r.replacement())
+		}
+	}
+
+	failed, missing := 0, false
+	for _, res := range results {
+		var result string
+		switch {
+		case len(res.problem) != 0:
+			failed++
+			missing = missing || res.problem == missingPathFinding
+			result = colorize(colorRed, "FAIL") + " " + res.problem
+		case len(res.skipped) != 0:
+			result = colorize(colorDim, "skip") + " " + res.skipped
+		default:
+			result = colorize(colorGreen, "ok")
+		}
+		outputf("%-*s  %-*s  %s", moduleWidth, res.r.ModuleName, pathWidth, res.r.replacement(), result)
+	}
+
+	if failed == 0 {
+		return nil
+	}
+
+	err = fmt.Errorf("%d of %d replace(s) failed verification", failed, len(results))
+	if missing {
+		return withExitCode(exitMissing, err)
+	}
+	return withExitCode(exitDrift, err)
+}
+
+// verifyReplace checks that r's directory exists and contains its module
+func verifyReplace(r replace) verifyResult {
+	if r.isRemote() {
+		return verifyResult{r: r, skipped: "replaced with a module@version"}
+	}
+
+	if _, err := os.Stat(r.AbsPath); os.IsNotExist(err) {
+		return verifyResult{r: r, problem: missingPathFinding}
+	} else if err != nil {
+		return verifyResult{r: r, problem: err.Error()}
+	}
+
+	return verifyResult{r: r, problem: checkModulePath(r)}
+}
+
+// buildCheckouts runs go build ./... in the directory of every result that
+// passed so far, marking the ones that fail to build. Stubbed checkouts only
+// build while the replace is installed since that's when they have a go.mod.
+func buildCheckouts(results []verifyResult, jobs int) {
+	var checkouts []checkout
+	var indexes []int
+	for i, res := range results {
+		if len(res.problem) != 0 || len(res.skipped) != 0 {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(res.r.AbsPath, "go.mod")); err != nil {
+			results[i].skipped = "no go.mod to build with, the stub is generated by gomr up"
+			continue
+		}
+
+		checkouts = append(checkouts, checkout{module: res.r.ModuleName, dir: res.r.AbsPath})
+		indexes = append(indexes, i)
+	}
+
+	built := runInCheckouts(checkouts, jobs, func(c checkout) *exec.Cmd {
+		return exec.Command(goCommand(), "build", "./...")
+	})
+	for j, b := range built {
+		if b.err == nil {
+			continue
+		}
+
+		results[indexes[j]].problem = "go build failed"
+		if output := strings.TrimSpace(string(b.output)); len(output) != 0 {
+			warnf("go build ./... failed in %s:\n  %s", b.dir, strings.Replace(output, "\n", "\n  ", -1))
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"os/exec"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// These are set when building a release with:
+//
+//	go build -ldflags "-X main.version=v1.0.0 -X main.commit=$(git rev-parse HEAD) -X main.date=$(date -u +%FT%TZ)"
+var (
+	version = ""
+	commit  = ""
+	date    = ""
+)
+
+var versionCmd = &cobra.Command{
+	Use:   "version",
+	Short: "Show the gomr version and the go toolchain it uses",
+	RunE:  versionRun,
+	Args:  cobra.NoArgs,
+}
+
+func versionRun(cmd *cobra.Command, args []string) error {
+	outputf("gomr %s", gomrVersion())
+	if len(commit) != 0 {
+		outputf("commit: %s", commit)
+	}
+	if len(date) != 0 {
+		outputf("built: %s", date)
+	}
+	outputf("built with: %s %s/%s", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+
+	// gomr runs the go from --go, GOMR_GO or the PATH, which may differ from
+	// the one it was built with
+	goVersion, err := exec.Command(goCommand(), "version").Output()
+	if err != nil {
+		outputf("go: not found (%v)", err)
+	} else {
+		outputf("go: %s", strings.TrimPrefix(strings.TrimSpace(string(goVersion)), "go version "))
+	}
+
+	return nil
+}
+
+// gomrVersion returns the version set with ldflags, or the module version
+// from the build info when installed with go install or go get
+func gomrVersion() string {
+	if len(version) != 0 {
+		return version
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok && len(info.Main.Version) != 0 {
+		return info.Main.Version
+	}
+
+	return "(devel)"
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// watchSettle is how long go.mod has to go without changing before watch
+// looks at it, tools often write it more than once in a row
+const watchSettle = 500 * time.Millisecond
+
+var watchCmd = &cobra.Command{
+	Use:   "watch [flags]",
+	Short: "Keep the replaces installed while other tools rewrite go.mod",
+	Long: `Keep the replaces installed while other tools rewrite go.mod
+
+Installs the replaces like up and then watches go.mod until interrupted.
+Whenever something other than gomr rewrites it and drops replace lines, like
+go get, go mod tidy or an IDE, they're installed again.
+
+Running up or down while watching changes which replaces are kept: the ones
+down removes stay removed.`,
+	RunE:         watchRun,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+}
+
+func watchRun(cmd *cobra.Command, args []string) error {
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	profile, err := profileFlag(cmd, modRoot)
+	if err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Wrap(err, "failed to start watching go.mod")
+	}
+	defer watcher.Close()
+
+	// The directory is watched rather than the file since editors and tools
+	// replace go.mod by renaming a new file over it
+	if err = watcher.Add(modRoot); err != nil {
+		return errors.Wrapf(err, "failed to watch %s", modRoot)
+	}
+
+	w := &goModWatch{modRoot: modRoot, profile: profile}
+	if err = w.start(); err != nil {
+		return err
+	}
+
+	trap := trapSignals()
+	defer trap.stop()
+
+	goModPath := filepath.Join(modRoot, "go.mod")
+	infof("watching %s, press Ctrl-C to stop", goModPath)
+
+	var settle <-chan time.Time
+	for {
+		select {
+		case s := <-trap.signals:
+			infof("stopped watching (%v)", s)
+			return nil
+		case e, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if filepath.Clean(e.Name) == goModPath && e.Op&^fsnotify.Chmod != 0 {
+				settle = time.After(watchSettle)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			warnf("watching go.mod: %v", err)
+		case <-settle:
+			settle = nil
+			if err := w.check(); err != nil {
+				warnf("%v", err)
+			}
+		}
+	}
+}
+
+// goModWatch is the state of watch between changes to go.mod
+type goModWatch struct {
+	modRoot string
+	profile string
+	// kept are the lowercased modules whose replace lines are put back
+	kept map[string]bool
+	// journal is the journal's size and modification time when kept was
+	// last updated, so changes made by gomr commands can be told apart
+	journal journalStamp
+}
+
+// journalStamp identifies a version of the journal, every gomr command that
+// changes go.mod appends to it
+type journalStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// equal reports whether s and o are the same version of the journal
+func (s journalStamp) equal(o journalStamp) bool {
+	return s.size == o.size && s.modTime.Equal(o.modTime)
+}
+
+// start installs the replaces that aren't installed yet and starts keeping
+// all of them
+func (w *goModWatch) start() error {
+	lock, err := lockModule(w.modRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	replaces, err := readReplaces(w.modRoot, w.profile)
+	if err != nil {
+		return err
+	}
+	if len(replaces) == 0 {
+		infof("no replace lines to keep installed, watching for ones added with up")
+	}
+
+	mod, err := readGoMod(w.modRoot)
+	if err != nil {
+		return err
+	}
+	if missing := unappliedReplaces(mod, replaces); len(missing) != 0 {
+		warnUnmanaged(w.modRoot, "watch", missing, true)
+		if err = upReplaces(w.modRoot, missing, nil, false); err != nil {
+			return err
+		}
+	}
+
+	return w.keepApplied()
+}
+
+// check puts back the kept replaces that are missing from go.mod, unless it
+// was a gomr command that removed them
+func (w *goModWatch) check() error {
+	mod, err := readGoMod(w.modRoot)
+	if err != nil {
+		// go.mod can be briefly missing while it's being replaced, it's
+		// looked at again when it's back
+		debugf("%v", err)
+		return nil
+	}
+	if len(w.missing(mod)) == 0 {
+		return w.keepApplied()
+	}
+
+	// Waiting for the lock lets a gomr command that is changing go.mod finish
+	// and record itself in the journal first
+	lock, err := lockModule(w.modRoot)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	stamp, err := readJournalStamp(w.modRoot)
+	if err != nil {
+		return err
+	}
+	if !stamp.equal(w.journal) {
+		debugf("go.mod was changed by gomr, keeping the replaces installed now")
+		return w.keepApplied()
+	}
+
+	if mod, err = readGoMod(w.modRoot); err != nil {
+		return err
+	}
+	missing := w.missing(mod)
+	if len(missing) == 0 {
+		return nil
+	}
+
+	var names []string
+	for _, r := range missing {
+		names = append(names, r.ModuleName)
+	}
+	infof("%s: go.mod lost the replace line(s) for %s, installing them again", time.Now().Format("15:04:05"), strings.Join(names, ", "))
+	if err = upReplaces(w.modRoot, missing, nil, false); err != nil {
+		return err
+	}
+
+	return w.keepApplied()
+}
+
+// missing returns the kept replaces that have no replace line in mod, read
+// from the gomr file again so edits to it are picked up
+func (w *goModWatch) missing(mod goModFile) []replace {
+	replaces, err := readReplaces(w.modRoot, w.profile)
+	if err != nil {
+		debugf("%v", err)
+		return nil
+	}
+
+	var missing []replace
+	for _, r := range unappliedReplaces(mod, replaces) {
+		if w.kept[strings.ToLower(r.ModuleName)] {
+			missing = append(missing, r)
+		}
+	}
+	return missing
+}
+
+// keepApplied starts keeping exactly the replaces that are installed now
+func (w *goModWatch) keepApplied() error {
+	stamp, err := readJournalStamp(w.modRoot)
+	if err != nil {
+		return err
+	}
+
+	replaces, err := readReplaces(w.modRoot, w.profile)
+	if err != nil {
+		return err
+	}
+	mod, err := readGoMod(w.modRoot)
+	if err != nil {
+		return err
+	}
+
+	w.kept = make(map[string]bool)
+	for _, r := range appliedReplaces(mod, replaces) {
+		w.kept[strings.ToLower(r.ModuleName)] = true
+	}
+	w.journal = stamp
+	return nil
+}
+
+// readJournalStamp returns the current journalStamp of the module in
+// modRoot, the zero value if there's no journal yet
+func readJournalStamp(modRoot string) (journalStamp, error) {
+	path, err := journalPath(modRoot)
+	if err != nil {
+		return journalStamp{}, err
+	}
+
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return journalStamp{}, nil
+	} else if err != nil {
+		return journalStamp{}, errors.Wrap(err, "failed to read journal")
+	}
+	return journalStamp{size: info.Size(), modTime: info.ModTime()}, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var whereCmd = &cobra.Command{
+	Use:   "where <module>",
+	Short: "Print the path of the checkout a module is replaced with",
+	Long: `Print the path of the checkout a module is replaced with
+
+Prints the stored path of the module's local replace, including modules
+matched by a wildcard replace. It fails when the module has no stored local
+replace, and exits with 3 when the path doesn't exist.
+
+gomr shell-init defines a gcd function that uses it to cd there.`,
+	RunE:         whereRun,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+}
+
+var shellInitCmd = &cobra.Command{
+	Use:   "shell-init [bash|zsh|fish]",
+	Short: "Print shell functions for working with the replaced checkouts",
+	Long: `Print shell functions for working with the replaced checkouts
+
+Defines gcd <module>, which cds into the checkout a module is replaced with
+and completes the stored modules. Add it to your shell's rc file with, for
+example:
+
+  eval "$(gomr shell-init bash)"
+
+The shell defaults to bash, which also works for zsh.`,
+	ValidArgs:             []string{"bash", "zsh", "fish"},
+	Args:                  cobra.MaximumNArgs(1),
+	DisableFlagsInUseLine: true,
+	RunE:                  shellInitRun,
+	SilenceUsage:          true,
+}
+
+func whereRun(cmd *cobra.Command, args []string) error {
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	stored, err := storedReplaces(modRoot)
+	if err != nil {
+		return err
+	}
+
+	path, err := replacePath(stored, args[0])
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(path); err != nil {
+		return withExitCode(exitMissing, fmt.Errorf("the path of %s doesn't exist: %s", args[0], path))
+	}
+
+	outputf("%s", path)
+	return nil
+}
+
+// replacePath returns the directory the stored replaces put moduleName at,
+// either its own local replace or the directory of a wildcard it's under
+func replacePath(replaces []replace, moduleName string) (string, error) {
+	if i := lookupReplace(replaces, moduleName); i >= 0 {
+		r := replaces[i]
+		if r.isRemote() {
+			return "", fmt.Errorf("%s is replaced with %s, it has no local path", r.ModuleName, r.Target)
+		}
+		return r.rootPath(), nil
+	}
+
+	for _, r := range replaces {
+		prefix := strings.TrimSuffix(r.ModuleName, "*")
+		if !r.isWildcard() || r.isRemote() || !strings.HasPrefix(moduleName, prefix) {
+			continue
+		}
+		return filepath.Join(r.rootPath(), filepath.FromSlash(strings.TrimPrefix(moduleName, prefix))), nil
+	}
+
+	return "", fmt.Errorf("could not find stored replace for module: %s", moduleName)
+}
+
+func shellInitRun(cmd *cobra.Command, args []string) error {
+	shell := "bash"
+	if len(args) != 0 {
+		shell = args[0]
+	}
+
+	gomrBin, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	gomr := shellQuote(gomrBin) + storeFlag()
+
+	switch shell {
+	case "bash", "zsh":
+		outputf(`gcd() {
+	local dir
+	dir="$(%[1]s where "$1")" && cd "$dir"
+}
+_gcd() {
+	local IFS=$'\n'
+	COMPREPLY=($(compgen -W "$(%[1]s __complete where "" 2>/dev/null | grep -v '^:')" -- "${COMP_WORDS[1]}"))
+}
+if [ -n "$ZSH_VERSION" ]; then
+	autoload -U +X bashcompinit && bashcompinit
+fi
+complete -F _gcd gcd`, gomr)
+	case "fish":
+		outputf(`function gcd --description 'cd into the checkout a module is replaced with'
+	set -l dir (%[1]s where $argv[1]); and cd $dir
+end
+function __gcd_modules
+	%[1]s __complete where "" 2>/dev/null | string match -v ':*'
+end
+complete -c gcd -f -a '(__gcd_modules)'`, gomr)
+	default:
+		return fmt.Errorf("unsupported shell %q, use bash, zsh or fish", shell)
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var whyCmd = &cobra.Command{
+	Use:   "why <module>",
+	Short: "Show why the module is needed and whether it's replaced",
+	Long: `Show why the module is needed and whether it's replaced
+
+Runs go mod why -m for the module and then says whether go.mod currently
+replaces it and where to, which helps explain why a local change isn't
+taking effect.`,
+	RunE:         whyRun,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+}
+
+func whyRun(cmd *cobra.Command, args []string) error {
+	modRoot, err := findModuleRoot()
+	if err != nil {
+		return err
+	}
+
+	gomrFilePath, err := storeFilePath(modRoot)
+	if err != nil {
+		return err
+	}
+	stored, err := readGomrFile(gomrFilePath)
+	if err != nil {
+		return err
+	}
+
+	i := lookupReplace(stored, args[0])
+	if i < 0 {
+		return fmt.Errorf("could not find stored replace for module: %s", args[0])
+	}
+	r := stored[i]
+
+	out, err := gomodOutput(modRoot, "why", "-m", r.ModuleName)
+	if err != nil {
+		return err
+	}
+	outputf("%s", strings.TrimSpace(string(out)))
+	outputf("")
+
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range whyAnnotations(mod, r) {
+		outputf("%s", line)
+	}
+
+	return nil
+}
+
+// whyAnnotations describes how go.mod and the stored replace r relate
+func whyAnnotations(mod goModFile, r replace) []string {
+	var lines []string
+
+	if version := mod.requiredVersion(r.ModuleName); len(version) != 0 {
+		lines = append(lines, fmt.Sprintf("go.mod requires %s %s", r.ModuleName, version))
+	} else {
+		lines = append(lines, fmt.Sprintf("go.mod doesn't require %s directly", r.ModuleName))
+	}
+
+	rep, replaced := mod.replacedModule(r.ModuleName)
+	switch {
+	case replaced && rep.New.Path != r.replacement():
+		lines = append(lines, fmt.Sprintf("go.mod replaces it => %s, not with the stored replace => %s", rep.New.Path, r.replacement()))
+	case replaced:
+		lines = append(lines, fmt.Sprintf("go.mod replaces it => %s", rep.New.Path))
+	case r.Disabled:
+		lines = append(lines, fmt.Sprintf("go.mod doesn't replace it, the stored replace => %s is disabled", r.replacement()))
+	case !r.targetsMain():
+		lines = append(lines, fmt.Sprintf("go.mod doesn't replace it, the stored replace => %s is only for %s", r.replacement(), strings.Join(r.Modules, ", ")))
+	default:
+		lines = append(lines, fmt.Sprintf("go.mod doesn't replace it, run gomr up %s to apply the stored replace => %s", r.ModuleName, r.replacement()))
+	}
+
+	return lines
+}
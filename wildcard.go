@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// wildcardSuffix marks a replace that covers every module under a prefix,
+// for example github.com/myorg/* => ~/src/myorg/*
+const wildcardSuffix = "/*"
+
+// isWildcard checks if the replace covers every module under a prefix
+func (r replace) isWildcard() bool {
+	return strings.HasSuffix(r.ModuleName, wildcardSuffix)
+}
+
+// rootPath returns the directory a local replace points at, for wildcards
+// this is the directory the matching modules are found in.
+func (r replace) rootPath() string {
+	if r.isWildcard() {
+		return filepath.Dir(r.AbsPath)
+	}
+	return r.AbsPath
+}
+
+// checkWildcard makes sure a module path only uses a wildcard as its last
+// element.
+func checkWildcard(moduleName string) error {
+	trimmed := strings.TrimSuffix(moduleName, wildcardSuffix)
+	if strings.Contains(trimmed, "*") || trimmed == moduleName && strings.Contains(moduleName, "*") {
+		return fmt.Errorf("%s: a wildcard is only allowed as the last element, like example.com/org/*", moduleName)
+	}
+	return nil
+}
+
+// expandWildcards replaces every wildcard with the modules it matches in
+// mod, see wildcardMatches.
+func expandWildcards(mod goModFile, replaces []replace) []replace {
+	var expanded []replace
+	seen := make(map[string]bool)
+	for _, r := range replaces {
+		if !r.isWildcard() {
+			expanded = append(expanded, r)
+			continue
+		}
+
+		for _, m := range wildcardMatches(mod, r, replaces) {
+			if !seen[strings.ToLower(m.ModuleName)] {
+				seen[strings.ToLower(m.ModuleName)] = true
+				expanded = append(expanded, m)
+			}
+		}
+	}
+
+	return expanded
+}
+
+// wildcardMatches returns one replace per module in mod's require list that
+// the wildcard w matches. Modules are only included when they're checked out
+// under the wildcard's directory or already replaced in mod, and modules with
+// a replace of their own in replaces are left to it.
+func wildcardMatches(mod goModFile, w replace, replaces []replace) []replace {
+	explicit := make(map[string]bool)
+	for _, r := range replaces {
+		if !r.isWildcard() {
+			explicit[strings.ToLower(r.ModuleName)] = true
+		}
+	}
+
+	var matches []replace
+	prefix := strings.TrimSuffix(w.ModuleName, "*")
+	for _, req := range mod.Require {
+		if !strings.HasPrefix(req.Path, prefix) || explicit[strings.ToLower(req.Path)] {
+			continue
+		}
+
+		dir := filepath.Join(w.rootPath(), filepath.FromSlash(strings.TrimPrefix(req.Path, prefix)))
+		_, replaced := mod.replacedModule(req.Path)
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err != nil && !replaced {
+			continue
+		}
+
+		matches = append(matches, replace{
+			ModuleName: req.Path,
+			AbsPath:    dir,
+			Profiles:   w.Profiles,
+			Note:       w.Note,
+			Added:      w.Added,
+			local:      w.local,
+		})
+	}
+
+	return matches
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// goWorkFile is the subset of the go work edit -json output that we use
+type goWorkFile struct {
+	Use []struct {
+		DiskPath string
+	}
+	Replace []goModReplace
+}
+
+// activeGoWork returns the path of the go.work file go uses in modRoot,
+// found from GOWORK or by searching the parent directories. It's empty when
+// there isn't one or GOWORK=off, and with versions of go that predate
+// workspaces.
+func activeGoWork(modRoot string) string {
+	out, err := goOutput(modRoot, "env", "GOWORK")
+	if err != nil {
+		debugf("go env GOWORK failed: %v", err)
+		return ""
+	}
+
+	goWork := strings.TrimSpace(string(out))
+	if goWork == "off" {
+		return ""
+	}
+	return goWork
+}
+
+// readGoWork parses the go.work file at path using go work edit -json
+func readGoWork(path string) (goWorkFile, error) {
+	var work goWorkFile
+
+	b, err := goOutput(filepath.Dir(path), "work", "edit", "-json", path)
+	if err != nil {
+		return work, errors.Wrapf(err, "failed to read %s", path)
+	}
+
+	if err = json.Unmarshal(b, &work); err != nil {
+		return work, errors.Wrapf(err, "failed to parse %s", path)
+	}
+
+	return work, nil
+}
+
+// warnWorkspace warns when a go.work is active for the module in modRoot,
+// since its use and replace directives take precedence over the replaces
+// gomr puts in go.mod, and about each of the replaces it conflicts with.
+func warnWorkspace(modRoot string, replaces []replace) {
+	goWork := activeGoWork(modRoot)
+	if len(goWork) == 0 {
+		return
+	}
+
+	warnGoWorkActive(goWork)
+
+	overrides, err := workspaceOverrides(goWork, replaces)
+	if err != nil {
+		debugf("%v", err)
+		return
+	}
+	for _, o := range overrides {
+		warnf("%s, so the replace with %s has no effect", o, o.replacement())
+	}
+}
+
+// warnGoWorkActive warns that the go.work at goWork decides where modules
+// come from before go.mod does
+func warnGoWorkActive(goWork string) {
+	warnf("%s is active, its use and replace directives take precedence over go.mod's replaces (up and down --workspace put the replaces in it instead)", goWork)
+}
+
+// workspaceOverride is a stored replace that a go.work directive overrides
+type workspaceOverride struct {
+	replace
+	// by is where go.work gets the module from instead
+	by string
+	// use is set when a use directive overrides the replace rather than a
+	// replace directive
+	use bool
+}
+
+// String describes the directive in go.work that does the overriding
+func (o workspaceOverride) String() string {
+	if o.use {
+		return fmt.Sprintf("go.work uses %s from %s", o.ModuleName, o.by)
+	}
+	return fmt.Sprintf("go.work replaces %s => %s", o.ModuleName, o.by)
+}
+
+// workspaceOverrides finds the replaces that the use and replace directives
+// in the go.work at goWork take precedence over
+func workspaceOverrides(goWork string, replaces []replace) ([]workspaceOverride, error) {
+	overrides, _, err := resolveWorkspace(goWork, replaces)
+	return overrides, err
+}
+
+// resolveWorkspace works out what the build gets each of the replaces from
+// given the go.work at goWork, whose directives win over go.mod's. It
+// returns the replaces go.work points somewhere else, and the ones go.work
+// already points where they do, by a replace directive or by using the
+// checkout.
+func resolveWorkspace(goWork string, replaces []replace) ([]workspaceOverride, []replace, error) {
+	work, err := readGoWork(goWork)
+	if err != nil {
+		return nil, nil, err
+	}
+	workDir := filepath.Dir(goWork)
+
+	used := make(map[string]string)
+	for _, u := range work.Use {
+		dir := u.DiskPath
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(workDir, dir)
+		}
+		if modulePath, err := readModulePath(dir); err == nil {
+			used[strings.ToLower(modulePath)] = dir
+		}
+	}
+	replaced := make(map[string]string)
+	for _, rep := range work.Replace {
+		if len(rep.Old.Version) == 0 {
+			replaced[strings.ToLower(rep.Old.Path)] = goModReplacement(workDir, rep)
+		}
+	}
+
+	var overrides []workspaceOverride
+	var applied []replace
+	for _, r := range replaces {
+		if by, ok := replaced[strings.ToLower(r.ModuleName)]; ok {
+			if r.isRemote() && by == r.Target || !r.isRemote() && sameDir(by, r.AbsPath) {
+				applied = append(applied, r)
+			} else {
+				overrides = append(overrides, workspaceOverride{replace: r, by: by})
+			}
+			continue
+		}
+		if dir, ok := used[strings.ToLower(r.ModuleName)]; ok {
+			if !r.isRemote() && sameDir(dir, r.AbsPath) {
+				applied = append(applied, r)
+			} else {
+				overrides = append(overrides, workspaceOverride{replace: r, by: dir, use: true})
+			}
+		}
+	}
+
+	return overrides, applied, nil
+}
+
+// sameDir checks if a and b are the same directory once cleaned
+func sameDir(a, b string) bool {
+	return filepath.Clean(a) == filepath.Clean(b)
+}
+
+// workspaceGoWork returns the go.work that up and down --workspace edit
+func workspaceGoWork(modRoot string) (string, error) {
+	goWork := activeGoWork(modRoot)
+	if len(goWork) == 0 {
+		return "", fmt.Errorf("--workspace needs a go.work but none is active for %s", modRoot)
+	}
+	return goWork, nil
+}
+
+// workspaceFiles returns the files up and down --workspace change
+func workspaceFiles(modRoot, goWork string, replaces []replace) ([]string, error) {
+	files, err := moduleFiles(modRoot, replaces)
+	if err != nil {
+		return nil, err
+	}
+	return append(files, goWork, goWork+".sum"), nil
+}
+
+// upWorkspace installs the replaces in goWork instead of go.mod
+func upWorkspace(modRoot, goWork string, replaces []replace) error {
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		return err
+	}
+
+	files, err := workspaceFiles(modRoot, goWork, replaces)
+	if err != nil {
+		return err
+	}
+	tx, err := beginTransaction(files...)
+	if err != nil {
+		return err
+	}
+
+	err = recordOperation(modRoot, operationName("up --workspace", replaces), files, func() error {
+		return tx.run(func() error {
+			installs := expandWildcards(mod, mainReplaces(replaces))
+			if err := createStubs(modRoot, installs); err != nil {
+				return err
+			}
+			return gowork(goWork, append([]string{"edit"}, replaceFlags(installs)...)...)
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	infof("replace lines installed in %s", goWork)
+	return nil
+}
+
+// downWorkspace removes the replaces from goWork, see removeStubs for force
+func downWorkspace(modRoot, goWork string, replaces []replace, force bool) error {
+	mod, err := readGoMod(modRoot)
+	if err != nil {
+		return err
+	}
+
+	files, err := workspaceFiles(modRoot, goWork, replaces)
+	if err != nil {
+		return err
+	}
+	tx, err := beginTransaction(files...)
+	if err != nil {
+		return err
+	}
+
+	err = recordOperation(modRoot, operationName("down --workspace", replaces), files, func() error {
+		return tx.run(func() error {
+			installed := expandWildcards(mod, mainReplaces(replaces))
+			if err := gowork(goWork, append([]string{"edit"}, dropReplaceFlags(installed)...)...); err != nil {
+				return err
+			}
+			return removeStubs(modRoot, installed, force)
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	infof("replace lines removed from %s", goWork)
+	return nil
+}
+
+// gowork runs go work with the args on the go.work file at path
+func gowork(path string, args ...string) error {
+	if dryRun {
+		infof("would run: go work %s %s", strings.Join(args, " "), path)
+		return nil
+	}
+
+	arguments := append(append([]string{"work"}, args...), path)
+	cmd := exec.Command(goCommand(), arguments...)
+	cmd.Dir = filepath.Dir(path)
+	debugf("running: go %s (in %s)", strings.Join(arguments, " "), cmd.Dir)
+	if b, err := cmd.CombinedOutput(); err != nil {
+		return errors.Errorf("go work %s failed: %s", strings.Join(args, " "), strings.TrimSpace(string(b)))
+	}
+
+	return nil
+}